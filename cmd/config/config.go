@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"upgrade-cli/service"
+	"upgrade-cli/util/shellwords"
+
+	"github.com/spf13/cobra"
+)
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show the configuration of the CLI",
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the resolved kubectl command and the namespace and context it targets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		config, err := service.GetKubectlConfig()
+		if err != nil {
+			return err
+		}
+
+		timeout := config.Timeout.String()
+		if config.Timeout == 0 {
+			timeout = "none"
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(writer, "Command:\t%s\n", shellwords.Join(config.Command))
+		fmt.Fprintf(writer, "Executable:\t%s\n", config.Path)
+		fmt.Fprintf(writer, "Context:\t%s\n", config.Context)
+		fmt.Fprintf(writer, "Namespace:\t%s\n", config.Namespace)
+		fmt.Fprintf(writer, "Timeout:\t%s\n", timeout)
+		return writer.Flush()
+	},
+}
+
+func init() {
+	ConfigCmd.AddCommand(showCmd)
+}
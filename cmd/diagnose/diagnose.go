@@ -0,0 +1,40 @@
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputDirFlag = "output-dir"
+	crFileFlag    = "cr-file"
+)
+
+var DiagnoseCmd = &cobra.Command{
+	Use:   "diagnose",
+	Short: "Collect a diagnostics bundle of the Entando app",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		outputDir, _ := cmd.Flags().GetString(outputDirFlag)
+		crFile, _ := cmd.Flags().GetString(crFileFlag)
+
+		archive, err := service.CollectDiagnostics(service.DiagnosticsOptions{Directory: outputDir, CRFile: crFile})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Diagnostics bundle saved to %s\n", archive)
+		return nil
+	},
+}
+
+func init() {
+	DiagnoseCmd.Flags().StringP(outputDirFlag, "o", ".", "directory where the diagnostics archive is created")
+	DiagnoseCmd.Flags().String(crFileFlag, "", "path to the applied CR file, to include it in the bundle")
+}
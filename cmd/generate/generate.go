@@ -2,13 +2,16 @@ package generate
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	imagesettype "upgrade-cli/flag/image_set_type"
 	operatormode "upgrade-cli/flag/operator_mode"
+	pinmode "upgrade-cli/flag/pin_mode"
 	"upgrade-cli/service"
 	"upgrade-cli/util/images"
 
 	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/spf13/cobra"
 )
 
@@ -19,10 +22,25 @@ const (
 	ImageSetTypeFlag  = "image-set-type"
 	OperatorModeFlag  = "operator-mode"
 
+	// Bulk image override flags shared with the upgrade command
+	ImagesFileFlag             = "images-file"
+	AllImagesTagFlag           = "all-images-tag"
+	ImagesFromReleaseNotesFlag = "images-from-release-notes"
+	SbomFlag                   = "sbom"
+
+	// Digest pinning flags shared with the upgrade command
+	PinFlag      = "pin"
+	PlatformFlag = "platform"
+
 	// Flag specific of the generate command
 	outputFlag = "output"
+
+	defaultPlatform = "linux/amd64"
 )
 
+// commands having the CR flags
+var crCommands []*cobra.Command
+
 var GenerateCRCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generate EntandoAppV2 CR file",
@@ -41,10 +59,25 @@ var GenerateCRCmd = &cobra.Command{
 			return err
 		}
 
-		needsFix := service.AdaptImagesOverride(entandoApp, olm)
+		needsFix, err := AdaptImages(cmd, entandoApp, olm)
+		if err != nil {
+			return err
+		}
 
 		fileName, _ := cmd.Flags().GetString(outputFlag)
-		return service.GenerateCustomResource(fileName, entandoApp, needsFix)
+		if sbom, _ := cmd.Flags().GetBool(SbomFlag); sbom && fileName == "" {
+			return fmt.Errorf("the --%s flag requires the --%s flag", SbomFlag, outputFlag)
+		}
+
+		if err := service.GenerateCustomResource(fileName, entandoApp, needsFix); err != nil {
+			return err
+		}
+
+		if sbom, _ := cmd.Flags().GetBool(SbomFlag); sbom {
+			sbomFile := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".sbom.cdx.json"
+			_, err = service.WriteUpgradeSbom(sbomFile, entandoApp)
+		}
+		return err
 	},
 }
 
@@ -52,9 +85,10 @@ func init() {
 	AddCRFlags(GenerateCRCmd)
 
 	GenerateCRCmd.Flags().StringP(outputFlag, "o", "", "path to CR file")
+	AddSbomFlag(GenerateCRCmd)
 }
 
-func ParseEntandoAppFromCmd(cmd *cobra.Command) (*v1alpha1.EntandoAppV2, bool, error) {
+func ParseEntandoAppFromCmd(cmd *cobra.Command) (*images.EntandoApp, bool, error) {
 
 	var version string
 	if latest, _ := cmd.Flags().GetBool(LatestVersionFlag); latest {
@@ -63,28 +97,65 @@ func ParseEntandoAppFromCmd(cmd *cobra.Command) (*v1alpha1.EntandoAppV2, bool, e
 		version, _ = cmd.Flags().GetString(VersionFlag)
 	}
 
-	olm, err := isOlm(cmd)
+	olm, err := IsOlm(cmd)
 	if err != nil {
 		return nil, false, err
 	}
 
 	imageSetType := getImageSetType(cmd, olm)
 
-	entandoApp := v1alpha1.EntandoAppV2{}
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 	entandoApp.Spec.Version = version
 	entandoApp.Spec.ImageSetType = string(imageSetType)
 
+	bulkOverrides, err := parseBulkImageOverrides(cmd, imageSetType)
+	if err != nil {
+		return nil, false, err
+	}
+
 	for _, imageInfo := range images.EntandoImages {
-		err := parseComponentFlag(cmd, imageInfo, &entandoApp)
+		err := parseComponentFlag(cmd, imageInfo, bulkOverrides, entandoApp)
 		if err != nil {
 			return nil, false, err
 		}
 	}
 
-	return &entandoApp, olm, nil
+	return entandoApp, olm, nil
+}
+
+// AdaptImages adapts the image overrides, pinning the digests according to the pin and platform flags
+func AdaptImages(cmd *cobra.Command, entandoApp *images.EntandoApp, olm bool) (bool, error) {
+	// digests are pinned only in OLM installations
+	if !olm && (cmd.Flags().Changed(PinFlag) || cmd.Flags().Changed(PlatformFlag)) {
+		return false, fmt.Errorf("--%s and --%s are supported only for OLM installations", PinFlag, PlatformFlag)
+	}
+
+	pinOptions, err := getPinOptions(cmd)
+	if err != nil {
+		return false, err
+	}
+	return service.AdaptImagesOverrideWithPinning(entandoApp, olm, pinOptions)
 }
 
-func isOlm(cmd *cobra.Command) (bool, error) {
+func getPinOptions(cmd *cobra.Command) (service.PinOptions, error) {
+	mode, _ := cmd.Flags().GetString(PinFlag)
+	pinOptions := service.PinOptions{Mode: pinmode.PinMode(mode)}
+
+	platform, _ := cmd.Flags().GetString(PlatformFlag)
+	if platform == "" && pinOptions.Mode == pinmode.Platform {
+		platform = defaultPlatform
+	}
+	if platform != "" {
+		parsedPlatform, err := v1.ParsePlatform(platform)
+		if err != nil {
+			return pinOptions, fmt.Errorf("invalid platform '%s'. It should be <os>/<arch>[/<variant>]", platform)
+		}
+		pinOptions.Platform = parsedPlatform
+	}
+	return pinOptions, nil
+}
+
+func IsOlm(cmd *cobra.Command) (bool, error) {
 	flagValue, _ := cmd.Flags().GetString(OperatorModeFlag)
 	if flagValue == string(operatormode.Auto) {
 		mode, err := service.GetOperatorMode()
@@ -99,6 +170,9 @@ func isOlm(cmd *cobra.Command) (bool, error) {
 func getImageSetType(cmd *cobra.Command, olm bool) imagesettype.ImageSetType {
 	flagValue, _ := cmd.Flags().GetString(ImageSetTypeFlag)
 	if flagValue == string(imagesettype.Auto) {
+		if imageSetType := service.GetInstalledCustomImageSetType(); imageSetType != "" {
+			return imageSetType
+		}
 		if olm {
 			return imagesettype.RedhatCertified
 		} else {
@@ -108,11 +182,61 @@ func getImageSetType(cmd *cobra.Command, olm bool) imagesettype.ImageSetType {
 	return imagesettype.ImageSetType(flagValue)
 }
 
-func parseComponentFlag(cmd *cobra.Command, imageInfo images.EntandoImageInfo, entandoApp *v1alpha1.EntandoAppV2) error {
+// imageOverrideSource is a bulk source of image overrides, indexed by component name
+type imageOverrideSource struct {
+	name      string
+	overrides map[string]string
+}
+
+// parseBulkImageOverrides returns the bulk sources of image overrides, from the lowest to the highest precedence.
+// The images of the selected image set are taken from the release notes.
+func parseBulkImageOverrides(cmd *cobra.Command, imageSetType imagesettype.ImageSetType) ([]imageOverrideSource, error) {
+	sources := []imageOverrideSource{}
+
+	if tag, _ := cmd.Flags().GetString(AllImagesTagFlag); tag != "" {
+		overrides := map[string]string{}
+		for _, imageInfo := range images.EntandoImages {
+			overrides[imageInfo.ComponentName] = tag
+		}
+		sources = append(sources, imageOverrideSource{name: AllImagesTagFlag, overrides: overrides})
+	}
+
+	if location, _ := cmd.Flags().GetString(ImagesFromReleaseNotesFlag); location != "" {
+		overrides, err := service.LoadReleaseNotesImages(location, imageSetType)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, imageOverrideSource{name: ImagesFromReleaseNotesFlag, overrides: overrides})
+	}
+
+	if fileName, _ := cmd.Flags().GetString(ImagesFileFlag); fileName != "" {
+		overrides, err := service.LoadImagesFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, imageOverrideSource{name: ImagesFileFlag, overrides: overrides})
+	}
+
+	return sources, nil
+}
+
+// parseComponentFlag sets the image override of the component. The component flag takes precedence over the
+// images file, that takes precedence over the release notes, that take precedence over the tag for all images.
+func parseComponentFlag(cmd *cobra.Command, imageInfo images.EntandoImageInfo, bulkOverrides []imageOverrideSource, entandoApp *images.EntandoApp) error {
 	parsedImageOverride, _ := cmd.Flags().GetString(imageInfo.ImageOverrideFlag)
+	source := ""
+
+	for i := len(bulkOverrides) - 1; i >= 0 && parsedImageOverride == ""; i-- {
+		parsedImageOverride = bulkOverrides[i].overrides[imageInfo.ComponentName]
+		source = bulkOverrides[i].name
+	}
 
 	if parsedImageOverride != "" {
 		if !images.IsValidImageOverride(parsedImageOverride) {
+			if source != "" {
+				return fmt.Errorf("invalid format for image override '%s' of %s from %s. It should be <image>:<tag> or <tag>",
+					parsedImageOverride, imageInfo.ComponentName, source)
+			}
 			return fmt.Errorf("invalid format for image override flag '%s'. It should be <image>:<tag> or <tag>", parsedImageOverride)
 		}
 
@@ -124,20 +248,53 @@ func parseComponentFlag(cmd *cobra.Command, imageInfo images.EntandoImageInfo, e
 }
 
 func AddCRFlags(cmd *cobra.Command) {
+	crCommands = append(crCommands, cmd)
 
 	cmd.PersistentFlags().StringP(VersionFlag, "v", "", "Entando version")
 	cmd.PersistentFlags().Bool(LatestVersionFlag, false, "Automatically select the latest version from entando-releases repository")
 	cmd.MarkFlagsMutuallyExclusive(VersionFlag, LatestVersionFlag)
 
 	imageSetTypeFlagValue := imagesettype.GetImageSetTypeFlag()
-	imageSetTypeFlagUsage := "Set specific images for DeApp or Keycloak. Possible values: " + strings.Join(imagesettype.GetImageSetTypeValues(), ", ")
-	cmd.PersistentFlags().VarP(imageSetTypeFlagValue, ImageSetTypeFlag, "t", imageSetTypeFlagUsage)
+	cmd.PersistentFlags().VarP(imageSetTypeFlagValue, ImageSetTypeFlag, "t", getImageSetTypeFlagUsage())
 
 	operatorModeFlagValue := operatormode.GetOperatorModeFlag()
 	operatorModeFlagUsage := "Generate CR for an OLM or plain installation. Possible values: " + strings.Join(operatormode.GetOperatorModeValues(), ", ")
 	cmd.PersistentFlags().VarP(operatorModeFlagValue, OperatorModeFlag, "m", operatorModeFlagUsage)
 
+	addComponentFlags(cmd)
+
+	cmd.PersistentFlags().String(ImagesFileFlag, "", "YAML file mapping component names to image overrides")
+	cmd.PersistentFlags().String(AllImagesTagFlag, "", "Tag to use as image override for all the components")
+	cmd.PersistentFlags().String(ImagesFromReleaseNotesFlag, "", "File or URL of the image list published with the Entando release notes")
+
+	pinFlagValue := pinmode.GetPinModeFlag()
+	pinFlagUsage := "Pin the digest of the manifest list or of the platform manifest in OLM installations. Possible values: " + strings.Join(pinmode.GetPinModeValues(), ", ")
+	cmd.PersistentFlags().Var(pinFlagValue, PinFlag, pinFlagUsage)
+	cmd.PersistentFlags().String(PlatformFlag, "", "Platform that the pinned images must provide in OLM installations, e.g. linux/arm64 (default "+defaultPlatform+" with --pin platform)")
+}
+
+// AddRegisteredComponentFlags adds to the commands having the CR flags the flags of the components and the image
+// set types registered after their creation, i.e. the ones defined in the components descriptor
+func AddRegisteredComponentFlags() {
+	for _, cmd := range crCommands {
+		addComponentFlags(cmd)
+		cmd.PersistentFlags().Lookup(ImageSetTypeFlag).Usage = getImageSetTypeFlagUsage()
+	}
+}
+
+func addComponentFlags(cmd *cobra.Command) {
 	for _, imageInfo := range images.EntandoImages {
-		cmd.PersistentFlags().String(imageInfo.ImageOverrideFlag, "", "Image override for "+imageInfo.ComponentName)
+		if cmd.PersistentFlags().Lookup(imageInfo.ImageOverrideFlag) == nil {
+			cmd.PersistentFlags().String(imageInfo.ImageOverrideFlag, "", "Image override for "+imageInfo.ComponentName)
+		}
 	}
 }
+
+func getImageSetTypeFlagUsage() string {
+	return "Set specific images for DeApp or Keycloak. Possible values: " + strings.Join(imagesettype.GetImageSetTypeValues(), ", ")
+}
+
+// AddSbomFlag adds the flag used to merge the SBOMs attached to the images in a single document
+func AddSbomFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool(SbomFlag, false, "Merge the SBOMs attached to the images in a CycloneDX document stored alongside the CR")
+}
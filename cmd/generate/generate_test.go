@@ -6,10 +6,21 @@ import (
 	"strings"
 	"testing"
 	"upgrade-cli/service"
+	"upgrade-cli/util/sys/spawn"
 
 	"github.com/google/go-containerregistry/pkg/crane"
 )
 
+func TestMain(m *testing.M) {
+	// no cluster is available to the tests
+	_, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		return spawn.Res{Stderr: "The connection to the server localhost:8080 was refused"}, errors.New("exit status 1")
+	})
+	code := m.Run()
+	restore()
+	os.Exit(code)
+}
+
 func TestGenerateSimpleCR(t *testing.T) {
 
 	os.Setenv(service.EntandoAppNameEnv, "my-entando-app")
@@ -55,7 +66,7 @@ func TestGenerateOlmCRWithPlaceholders(t *testing.T) {
 		if strings.HasSuffix(ref, "invalid-tag") {
 			return "", errors.New("manifest unknown")
 		} else {
-			return "sha256:94af0fb4525", nil
+			return "sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", nil
 		}
 	}
 
@@ -80,7 +91,7 @@ func TestGenerateOlmCRWithPlaceholders(t *testing.T) {
 		t.Fatalf("Generated doesn't contain placeholders warning")
 	}
 
-	assertYamlField(t, fileContent, "imageOverride", "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525")
+	assertYamlField(t, fileContent, "imageOverride", "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f")
 }
 
 func assertYamlField(t *testing.T, fileContent, key, expectedValue string) {
@@ -102,3 +113,80 @@ func TestInvalidImageOverrideFormat(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err.Error())
 	}
 }
+
+func TestGenerateCRWithBulkImageOverrides(t *testing.T) {
+
+	os.Setenv(service.EntandoAppNameEnv, "my-entando-app")
+	os.Setenv(service.EntandoIngressHostNameEnv, "quickstart.10.11.91.88.nip.io")
+
+	testFile, _ := os.CreateTemp("", "generate-cr-test")
+	defer os.Remove(testFile.Name())
+
+	imagesFile, _ := os.CreateTemp("", "images-file-test")
+	defer os.Remove(imagesFile.Name())
+	os.WriteFile(imagesFile.Name(), []byte("AppBuilder: entando/app-builder:7.1.2-fix1\nimage-de-app: 7.1.2-fix2\n"), 0600)
+
+	// flags set by previous tests are retained by the command
+	GenerateCRCmd.Flags().Set("image-app-builder", "")
+
+	defer func() {
+		GenerateCRCmd.Flags().Set(ImagesFileFlag, "")
+		GenerateCRCmd.Flags().Set(AllImagesTagFlag, "")
+		GenerateCRCmd.Flags().Set("image-de-app", "")
+	}()
+
+	GenerateCRCmd.SetArgs([]string{"generate", "-o", testFile.Name(), "-v", "7.1.2", "--operator-mode", "Plain",
+		"--all-images-tag", "7.1.2", "--images-file", imagesFile.Name(), "--image-de-app", "7.1.2-fix3"})
+
+	err := GenerateCRCmd.Execute()
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bytes, err := os.ReadFile(testFile.Name())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	fileContent := string(bytes)
+
+	assertYamlField(t, fileContent, "imageOverride", "registry.hub.docker.com/entando/app-builder:7.1.2-fix1")
+	assertYamlField(t, fileContent, "imageOverride", "registry.hub.docker.com/entando/entando-de-app-wildfly:7.1.2-fix3")
+	assertYamlField(t, fileContent, "imageOverride", "registry.hub.docker.com/entando/entando-keycloak:7.1.2")
+	if strings.Contains(fileContent, "7.1.2-fix2") {
+		t.Fatalf("component flag should take precedence over the images file\n%s", fileContent)
+	}
+}
+
+func TestInvalidBulkImageOverride(t *testing.T) {
+	defer GenerateCRCmd.Flags().Set(AllImagesTagFlag, "")
+
+	GenerateCRCmd.SetArgs([]string{"generate", "-v", "v7.1.0", "--operator-mode", "Plain", "--all-images-tag", "-7.1.0"})
+
+	err := GenerateCRCmd.Execute()
+
+	if err == nil {
+		t.Fatalf("an error was expected")
+	} else if !strings.Contains(err.Error(), "from all-images-tag") {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestPinFlagsInPlainInstallation(t *testing.T) {
+	defer func() {
+		pinFlag := GenerateCRCmd.PersistentFlags().Lookup(PinFlag)
+		pinFlag.Value.Set(pinFlag.DefValue)
+		pinFlag.Changed = false
+	}()
+
+	GenerateCRCmd.SetArgs([]string{"generate", "-v", "7.1.0", "--operator-mode", "Plain", "--pin", "platform"})
+
+	err := GenerateCRCmd.Execute()
+
+	if err == nil {
+		t.Fatalf("an error was expected")
+	} else if !strings.Contains(err.Error(), "only for OLM installations") {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,99 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"upgrade-cli/service"
+	"upgrade-cli/util/images"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Flag shared with the upgrade command
+	ValuesPatchFlag = "helm-values-patch"
+
+	crFileFlag = "cr-file"
+)
+
+var HelmCmd = &cobra.Command{
+	Use:   "helm",
+	Short: "Show the Helm release of a plain Entando installation",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		release, err := service.GetHelmRelease()
+		if err != nil {
+			return err
+		}
+		if release == nil {
+			return fmt.Errorf("no Helm release of an Entando chart found in the namespace")
+		}
+
+		if err := PrintRelease(os.Stdout, release); err != nil {
+			return err
+		}
+
+		crFile, _ := cmd.Flags().GetString(crFileFlag)
+		if crFile == "" {
+			return nil
+		}
+		entandoApp, err := service.ReadCustomResource(crFile)
+		if err != nil {
+			return err
+		}
+		return CheckDrift(cmd, release, entandoApp)
+	},
+}
+
+// PrintRelease writes the release, the chart and the values set by the user
+func PrintRelease(out io.Writer, release *service.HelmRelease) error {
+	chart := release.Chart.Metadata
+	fmt.Fprintf(out, "Release: %s (revision %d, %s)\n", release.Name, release.Revision, release.Info.Status)
+	fmt.Fprintf(out, "Chart: %s %s (app version %s)\n", chart.Name, chart.Version, chart.AppVersion)
+
+	values, err := yaml.Marshal(release.Values)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Values:\n%s", values)
+	return nil
+}
+
+// CheckDrift warns about the release values not matching the EntandoAppV2 and writes the values patch if requested
+func CheckDrift(cmd *cobra.Command, release *service.HelmRelease, entandoApp *images.EntandoApp) error {
+	drifts := service.CheckHelmDrift(release, entandoApp)
+	for _, drift := range drifts {
+		fmt.Fprintf(os.Stderr, "WARNING: Helm release %s value %s\n", release.Name, drift)
+	}
+
+	patchFile, _ := cmd.Flags().GetString(ValuesPatchFlag)
+	if patchFile == "" {
+		return nil
+	}
+
+	patch, err := yaml.Marshal(service.HelmValuesPatch(drifts))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(patchFile, patch, 0644); err != nil {
+		return fmt.Errorf("unable to write Helm values patch: %s", err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "Helm values patch saved to %s, it can be applied using 'helm upgrade %s <chart> --reuse-values -f %s'\n",
+		patchFile, release.Name, patchFile)
+	return nil
+}
+
+// AddValuesPatchFlag adds the flag used to write the Helm values patch
+func AddValuesPatchFlag(cmd *cobra.Command) {
+	cmd.Flags().String(ValuesPatchFlag, "", "write the Helm values aligning the Helm release with the EntandoAppV2 to this file")
+}
+
+func init() {
+	HelmCmd.Flags().String(crFileFlag, "", "path to the EntandoAppV2 CR file to compare with the Helm values")
+	AddValuesPatchFlag(HelmCmd)
+}
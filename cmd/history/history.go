@@ -0,0 +1,74 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the upgrades performed from this machine",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		records, err := service.ReadUpgradeRecords()
+		if err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			fmt.Fprintln(os.Stderr, "No upgrades found")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(writer, "ID\tDATE\tUSER\tFROM\tTO\tOUTCOME\tDURATION")
+		for _, record := range records {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.ID, record.Timestamp.Local().Format(time.RFC3339),
+				record.User, valueOrDash(record.SourceVersion), valueOrDash(record.TargetVersion), record.Outcome, record.Duration)
+		}
+		return writer.Flush()
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the details of an upgrade",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		record, err := service.FindUpgradeRecord(args[0])
+		if err != nil {
+			return err
+		}
+
+		output, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(output))
+		return nil
+	},
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	HistoryCmd.AddCommand(showCmd)
+}
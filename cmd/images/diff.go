@@ -0,0 +1,98 @@
+package images
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/service"
+	"upgrade-cli/util/bytesize"
+	"upgrade-cli/util/images"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	fromFlag               = "from"
+	toFlag                 = "to"
+	imageSetTypeFlag       = "image-set-type"
+	releaseManifestUrlFlag = "release-manifest-url"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the images of two Entando versions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		imageSetType, _ := cmd.Flags().GetString(imageSetTypeFlag)
+		if imagesettype.ImageSetType(imageSetType) == imagesettype.Auto {
+			imageSetType = string(imagesettype.Community)
+		}
+		manifestUrl, _ := cmd.Flags().GetString(releaseManifestUrlFlag)
+
+		resolved := []map[string]service.ResolvedImage{}
+		for _, flagName := range []string{fromFlag, toFlag} {
+			value, _ := cmd.Flags().GetString(flagName)
+			imageSet, err := service.GetImageSet(value, imagesettype.ImageSetType(imageSetType), manifestUrl)
+			if err != nil {
+				return err
+			}
+			resolved = append(resolved, service.ResolveImageSet(imageSet))
+		}
+
+		return PrintImageChanges(os.Stdout, service.DiffImageSets(resolved[0], resolved[1]))
+	},
+}
+
+// PrintImageChanges writes the added, removed and changed components with their images and sizes
+func PrintImageChanges(out io.Writer, changes []service.ImageChange) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tCHANGE\tFROM\tTO\tSIZE")
+	for _, change := range changes {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", change.Component, change.Change,
+			formatResolvedImage(change.From), formatResolvedImage(change.To), formatSizeChange(change.From, change.To))
+	}
+	return writer.Flush()
+}
+
+// formatResolvedImage returns the tag and the short digest of the image
+func formatResolvedImage(image *service.ResolvedImage) string {
+	if image == nil {
+		return "-"
+	}
+	imageRef, err := images.ParseImage(image.Image)
+	if err != nil {
+		return image.Image
+	}
+	value := imageRef.Repo()
+	if imageRef.Tag != "" {
+		value += ":" + imageRef.Tag
+	}
+	if digest := image.Digest; digest != "" {
+		_, hex, _ := strings.Cut(digest, ":")
+		if len(hex) > 12 {
+			hex = hex[:12]
+		}
+		value += "@" + hex
+	}
+	return value
+}
+
+func formatSizeChange(from, to *service.ResolvedImage) string {
+	switch {
+	case from != nil && to != nil:
+		if from.Size == to.Size {
+			return bytesize.Format(to.Size)
+		}
+		return bytesize.Format(from.Size) + " -> " + bytesize.Format(to.Size)
+	case from != nil:
+		return bytesize.Format(from.Size)
+	default:
+		return bytesize.Format(to.Size)
+	}
+}
@@ -0,0 +1,100 @@
+package images
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	imagesformat "upgrade-cli/flag/images_format"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	formatFlag = "format"
+	outputFlag = "output"
+)
+
+var ImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Inspect the images of the Entando components",
+}
+
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the images currently running the Entando components, pinned to their digests",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		currentImages, err := service.GetCurrentImages()
+		if err != nil {
+			return err
+		}
+		if len(currentImages) == 0 {
+			return fmt.Errorf("no deployments of Entando components found in the namespace")
+		}
+
+		for _, currentImage := range currentImages {
+			if currentImage.Digest == "" {
+				fmt.Fprintf(os.Stderr, "WARNING: unable to resolve the digest of %s, no running pods found\n", currentImage.Component)
+			} else if currentImage.MixedDigests {
+				fmt.Fprintf(os.Stderr, "WARNING: the pods of %s run different digests, a rollout may be in progress. The digest of the updated revision is used\n", currentImage.Component)
+			}
+		}
+
+		out := io.Writer(os.Stdout)
+		if fileName, _ := cmd.Flags().GetString(outputFlag); fileName != "" {
+			file, err := os.Create(fileName)
+			if err != nil {
+				return fmt.Errorf("unable to create output file %s", err.Error())
+			}
+			defer file.Close()
+			out = file
+		}
+
+		format, _ := cmd.Flags().GetString(formatFlag)
+		if imagesformat.ImagesFormat(format) == imagesformat.Overrides {
+			return PrintOverrides(out, service.CurrentImagesOverrides(currentImages))
+		}
+		return PrintCurrentImages(out, currentImages)
+	},
+}
+
+// PrintCurrentImages writes the current images as a table
+func PrintCurrentImages(out io.Writer, currentImages []service.CurrentImage) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tDEPLOYMENT\tIMAGE\tDIGEST")
+	for _, currentImage := range currentImages {
+		digest := currentImage.Digest
+		if digest == "" {
+			digest = "-"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", currentImage.Component, currentImage.Deployment, currentImage.Image, digest)
+	}
+	return writer.Flush()
+}
+
+// PrintOverrides writes the image overrides in the format of the images file accepted by the generate command
+func PrintOverrides(out io.Writer, overrides map[string]string) error {
+	content, err := yaml.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(content)
+	return err
+}
+
+func init() {
+	formatFlagValue := imagesformat.GetImagesFormatFlag()
+	formatFlagUsage := "Output format, Overrides can be used as --images-file of the generate command. Possible values: " +
+		strings.Join(imagesformat.GetImagesFormatValues(), ", ")
+	currentCmd.Flags().Var(formatFlagValue, formatFlag, formatFlagUsage)
+	currentCmd.Flags().StringP(outputFlag, "o", "", "path to the output file")
+
+	ImagesCmd.AddCommand(currentCmd)
+}
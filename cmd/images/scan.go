@@ -0,0 +1,135 @@
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"upgrade-cli/cmd/generate"
+	"upgrade-cli/flag/severity"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	severityThresholdFlag = "severity-threshold"
+	trivyCommandFlag      = "trivy-command"
+	offlineDbFlag         = "offline-db"
+	reportFlag            = "report"
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan the images of the target Entando version for vulnerabilities",
+	Args:  cobra.NoArgs,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		generate.GenerateCRCmd.PreRun(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		entandoApp, olm, err := generate.ParseEntandoAppFromCmd(cmd)
+		if err != nil {
+			return err
+		}
+		if _, err := generate.AdaptImages(cmd, entandoApp, olm); err != nil {
+			return err
+		}
+
+		trivyCommand, _ := cmd.Flags().GetString(trivyCommandFlag)
+		offlineDb, _ := cmd.Flags().GetString(offlineDbFlag)
+		scanner := service.TrivyScanner{Command: trivyCommand, DbDir: offlineDb}
+
+		upgradeImages, unresolved := service.GetUpgradeImages(entandoApp)
+		if len(unresolved) > 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to determine the images of %s, they were not scanned\n", strings.Join(unresolved, ", "))
+		}
+		if len(upgradeImages) == 0 {
+			return fmt.Errorf("no images to scan")
+		}
+
+		results := service.ScanImages(scanner, upgradeImages)
+
+		if err := PrintScanSummary(os.Stdout, results); err != nil {
+			return err
+		}
+
+		if reportFile, _ := cmd.Flags().GetString(reportFlag); reportFile != "" {
+			if err := writeScanReport(reportFile, results); err != nil {
+				return err
+			}
+		}
+
+		failed := []string{}
+		for _, result := range results {
+			if result.Error != "" {
+				fmt.Fprintf(os.Stderr, "WARNING: unable to scan %s image %s: %s\n", result.Component, result.Image, result.Error)
+				failed = append(failed, result.Component)
+			}
+		}
+
+		threshold, _ := cmd.Flags().GetString(severityThresholdFlag)
+		if err := service.CheckScanThreshold(results, severity.Severity(threshold)); err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("unable to scan the images of %s", strings.Join(failed, ", "))
+		}
+		return nil
+	},
+}
+
+// PrintScanSummary writes the number of findings of each component by severity
+func PrintScanSummary(out io.Writer, results []service.ImageScanResult) error {
+	severities := severity.GetOrderedSeverities()
+
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	header := []string{"COMPONENT", "IMAGE"}
+	for _, s := range severities {
+		header = append(header, strings.ToUpper(string(s)))
+	}
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+
+	for _, result := range results {
+		row := []string{result.Component, result.Image}
+		counts := result.CountBySeverity()
+		for _, s := range severities {
+			if result.Error != "" {
+				row = append(row, "-")
+			} else {
+				row = append(row, fmt.Sprint(counts[s]))
+			}
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+func writeScanReport(fileName string, results []service.ImageScanResult) error {
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("unable to write scan report: %s", err.Error())
+	}
+	return nil
+}
+
+func init() {
+	generate.AddCRFlags(scanCmd)
+
+	thresholdFlagValue := severity.GetSeverityThresholdFlag()
+	thresholdFlagUsage := "Fail when vulnerabilities with this severity or higher are found. Possible values: " +
+		strings.Join(severity.GetSeverityThresholdValues(), ", ")
+	scanCmd.Flags().Var(thresholdFlagValue, severityThresholdFlag, thresholdFlagUsage)
+	scanCmd.Flags().String(trivyCommandFlag, "trivy", "path to the Trivy executable")
+	scanCmd.Flags().String(offlineDbFlag, "", "directory containing the Trivy vulnerability DB, used without updating it")
+	scanCmd.Flags().String(reportFlag, "", "write the findings of each component to this JSON file")
+
+	ImagesCmd.AddCommand(scanCmd)
+}
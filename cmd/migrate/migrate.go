@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"upgrade-cli/cmd/generate"
+	operatormode "upgrade-cli/flag/operator_mode"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputFlag         = "output"
+	applyFlag          = "apply"
+	ignoreUnmappedFlag = "ignore-unmapped"
+)
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the legacy EntandoApp (v1) resource to an EntandoAppV2 CR",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		targetVersion, _ := cmd.Flags().GetString(generate.VersionFlag)
+		olm, err := generate.IsOlm(cmd)
+		if err != nil {
+			return err
+		}
+
+		migration, err := service.GetMigration(targetVersion, olm)
+		if err != nil {
+			return err
+		}
+
+		PrintMigration(os.Stderr, migration)
+
+		apply, _ := cmd.Flags().GetBool(applyFlag)
+		ignoreUnmapped, _ := cmd.Flags().GetBool(ignoreUnmappedFlag)
+		if apply && len(migration.Unmapped) > 0 && !ignoreUnmapped {
+			return fmt.Errorf("migration not applied because some fields can't be mapped. Use the --%s flag to apply it anyway", ignoreUnmappedFlag)
+		}
+
+		needsFix := service.AdaptImagesOverride(migration.EntandoApp, olm)
+
+		fileName, _ := cmd.Flags().GetString(outputFlag)
+		if apply && fileName == "" {
+			file, err := os.CreateTemp("", "entandoapp-cr")
+			if err != nil {
+				return err
+			}
+			file.Close()
+			fileName = file.Name()
+			defer os.Remove(fileName)
+		}
+
+		if err := service.GenerateCustomResource(fileName, migration.EntandoApp, needsFix); err != nil {
+			return err
+		}
+
+		if !apply {
+			return nil
+		}
+		if needsFix {
+			return fmt.Errorf("migration not applied because the generated CR needs to be fixed")
+		}
+		if err := service.CreateEntandoApp(fileName, false); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Changes applied\n")
+		return nil
+	},
+}
+
+func init() {
+	MigrateCmd.Flags().StringP(generate.VersionFlag, "v", "", "Entando version (default the version of the Entando DeApp image or of the entando-operator)")
+
+	operatorModeFlagValue := operatormode.GetOperatorModeFlag()
+	operatorModeFlagUsage := "Generate CR for an OLM or plain installation. Possible values: " + strings.Join(operatormode.GetOperatorModeValues(), ", ")
+	MigrateCmd.Flags().VarP(operatorModeFlagValue, generate.OperatorModeFlag, "m", operatorModeFlagUsage)
+
+	MigrateCmd.Flags().StringP(outputFlag, "o", "", "path to CR file")
+	MigrateCmd.Flags().Bool(applyFlag, false, "Create the EntandoAppV2 resource in the cluster")
+	MigrateCmd.Flags().Bool(ignoreUnmappedFlag, false, "Apply the migration even if some fields can't be mapped")
+}
+
+// PrintMigration writes the mapped values and the fields that can't be mapped
+func PrintMigration(out io.Writer, migration *service.Migration) {
+	spec := migration.EntandoApp.Spec
+	fmt.Fprintf(out, "Migrating EntandoApp %s to EntandoAppV2\n", migration.Source.Name)
+
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(writer, "  Version:\t%s\n", spec.Version)
+	fmt.Fprintf(writer, "  Image set type:\t%s\n", spec.ImageSetType)
+	fmt.Fprintf(writer, "  Ingress host name:\t%s\n", spec.IngressHostName)
+	if spec.DeApp.ImageOverride != "" {
+		fmt.Fprintf(writer, "  DeApp image:\t%s\n", spec.DeApp.ImageOverride)
+	}
+	writer.Flush()
+
+	if len(migration.Unmapped) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "WARNING: the following fields can't be mapped to EntandoAppV2:\n")
+	writer = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	for _, field := range migration.Unmapped {
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", field.Field, field.Value, field.Reason)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,121 @@
+package operator
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"upgrade-cli/cmd/generate"
+	operatormode "upgrade-cli/flag/operator_mode"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Flags shared with the upgrade command
+	CompatibilityMatrixFlag = "compatibility-matrix"
+	OperatorManifestUrlFlag = "operator-manifest-url"
+	OperatorChannelFlag     = "operator-channel"
+)
+
+var OperatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Check and upgrade the Entando operators",
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the installed operators support the target Entando version",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		targetVersion, _ := cmd.Flags().GetString(generate.VersionFlag)
+		check, err := CheckOperators(cmd, targetVersion)
+		if err != nil {
+			return err
+		}
+		if service.HasBlockingIssues(check.Issues) {
+			return fmt.Errorf("the installed operators don't support Entando %s, use 'operator upgrade' to upgrade them", targetVersion)
+		}
+		return nil
+	},
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the Entando operators to a version supporting the target Entando version",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		targetVersion, _ := cmd.Flags().GetString(generate.VersionFlag)
+		check, err := CheckOperators(cmd, targetVersion)
+		if err != nil {
+			return err
+		}
+
+		olm, err := generate.IsOlm(cmd)
+		if err != nil {
+			return err
+		}
+
+		return UpgradeOperators(cmd, targetVersion, olm, check.Rule)
+	},
+}
+
+// CheckOperators checks the installed operators using the compatibility matrix set in the command flags and prints the result
+func CheckOperators(cmd *cobra.Command, targetVersion string) (*service.OperatorsCheck, error) {
+	matrixFile, _ := cmd.Flags().GetString(CompatibilityMatrixFlag)
+	check, err := service.CheckOperators(targetVersion, matrixFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range check.Lines() {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return check, nil
+}
+
+// UpgradeOperators upgrades the operators using the manifest URL or the OLM channel set in the command flags
+func UpgradeOperators(cmd *cobra.Command, targetVersion string, olm bool, rule *service.CompatibilityRule) error {
+	manifestUrl, _ := cmd.Flags().GetString(OperatorManifestUrlFlag)
+	channel, _ := cmd.Flags().GetString(OperatorChannelFlag)
+
+	err := service.UpgradeOperators(service.OperatorUpgradeOptions{
+		TargetVersion: targetVersion,
+		Olm:           olm,
+		ManifestUrl:   manifestUrl,
+		Channel:       channel,
+		Rule:          rule,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to upgrade the operators: %s", err.Error())
+	}
+
+	fmt.Fprintln(os.Stderr, "Operators upgraded")
+	return nil
+}
+
+// AddOperatorFlags adds the flags used to check and upgrade the operators
+func AddOperatorFlags(cmd *cobra.Command) {
+	cmd.Flags().String(CompatibilityMatrixFlag, "", "path to a YAML file replacing the default operators compatibility matrix")
+	cmd.Flags().String(OperatorManifestUrlFlag, service.DefaultOperatorManifestUrl, "manifest applied to upgrade the operators of plain installations, {version} is replaced with the target version")
+	cmd.Flags().String(OperatorChannelFlag, "", "OLM channel used to upgrade the operators (default the one of the compatibility matrix)")
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{checkCmd, upgradeCmd} {
+		cmd.Flags().StringP(generate.VersionFlag, "v", "", "target Entando version")
+		cmd.MarkFlagRequired(generate.VersionFlag)
+		AddOperatorFlags(cmd)
+	}
+	operatorModeFlagValue := operatormode.GetOperatorModeFlag()
+	operatorModeFlagUsage := "Upgrade the operators of an OLM or plain installation. Possible values: " + strings.Join(operatormode.GetOperatorModeValues(), ", ")
+	upgradeCmd.Flags().VarP(operatorModeFlagValue, generate.OperatorModeFlag, "m", operatorModeFlagUsage)
+
+	OperatorCmd.AddCommand(checkCmd)
+	OperatorCmd.AddCommand(upgradeCmd)
+}
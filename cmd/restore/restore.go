@@ -0,0 +1,75 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	upgradeIdFlag = "upgrade-id"
+	yesFlag       = "yes"
+)
+
+var RestoreCmd = &cobra.Command{
+	Use:   "restore [backup directory]",
+	Short: "Restore a backup taken by the upgrade command",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		upgradeId, _ := cmd.Flags().GetString(upgradeIdFlag)
+		if (len(args) == 0) == (upgradeId == "") {
+			return fmt.Errorf("either the backup directory or the --%s flag must be provided", upgradeIdFlag)
+		}
+
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		directory, err := getBackupDirectory(args, upgradeId)
+		if err != nil {
+			return err
+		}
+
+		manifest, err := service.ReadBackupManifest(directory)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Backup %s (%s) taken on %s contains:\n", manifest.ID, manifest.Mode, manifest.Timestamp.Local().Format("2006-01-02 15:04:05"))
+		for _, item := range manifest.Summary().Items {
+			fmt.Fprintf(os.Stderr, "- %s\n", item)
+		}
+
+		if yes, _ := cmd.Flags().GetBool(yesFlag); !yes {
+			return fmt.Errorf("the restore overwrites the current data. Run the command again with the --%s flag to confirm", yesFlag)
+		}
+
+		if err := service.Restore(manifest); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Restore completed\n")
+		return nil
+	},
+}
+
+func getBackupDirectory(args []string, upgradeId string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	record, err := service.FindUpgradeRecord(upgradeId)
+	if err != nil {
+		return "", err
+	}
+	if record.Backup == nil {
+		return "", fmt.Errorf("no backup was taken during the upgrade %s", upgradeId)
+	}
+	return record.Backup.Location, nil
+}
+
+func init() {
+	RestoreCmd.Flags().String(upgradeIdFlag, "", "restore the backup taken during the upgrade having this id (see the history command)")
+	RestoreCmd.Flags().BoolP(yesFlag, "y", false, "confirm the restore")
+}
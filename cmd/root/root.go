@@ -1,10 +1,24 @@
 package root
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
+	"upgrade-cli/cmd/config"
+	"upgrade-cli/cmd/diagnose"
 	"upgrade-cli/cmd/generate"
+	"upgrade-cli/cmd/helm"
+	"upgrade-cli/cmd/history"
+	imagescmd "upgrade-cli/cmd/images"
+	"upgrade-cli/cmd/migrate"
+	"upgrade-cli/cmd/operator"
+	"upgrade-cli/cmd/restore"
 	"upgrade-cli/cmd/upgrade"
+	"upgrade-cli/cmd/verify"
+	"upgrade-cli/common"
+	"upgrade-cli/service"
+	"upgrade-cli/util/images"
 
 	"github.com/spf13/cobra"
 )
@@ -18,14 +32,34 @@ var RootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	if err := images.LoadComponentsDescriptorFromEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	generate.AddRegisteredComponentFlags()
+
 	err := RootCmd.Execute()
 	if err != nil {
+		var exitCodeErr common.ExitCodeError
+		if errors.As(err, &exitCodeErr) {
+			os.Exit(exitCodeErr.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
 	RootCmd.CompletionOptions.DisableDefaultCmd = true
+	service.KubeConfigFlags.AddFlags(RootCmd.PersistentFlags())
 	RootCmd.AddCommand(generate.GenerateCRCmd)
 	RootCmd.AddCommand(upgrade.UpgradeCmd)
+	RootCmd.AddCommand(history.HistoryCmd)
+	RootCmd.AddCommand(restore.RestoreCmd)
+	RootCmd.AddCommand(verify.VerifyCmd)
+	RootCmd.AddCommand(diagnose.DiagnoseCmd)
+	RootCmd.AddCommand(operator.OperatorCmd)
+	RootCmd.AddCommand(helm.HelmCmd)
+	RootCmd.AddCommand(imagescmd.ImagesCmd)
+	RootCmd.AddCommand(config.ConfigCmd)
+	RootCmd.AddCommand(migrate.MigrateCmd)
 }
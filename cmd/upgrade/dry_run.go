@@ -0,0 +1,103 @@
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"upgrade-cli/cmd/generate"
+	"upgrade-cli/service"
+	"upgrade-cli/util/bytesize"
+	"upgrade-cli/util/images"
+
+	"github.com/spf13/cobra"
+)
+
+// runDryRun prints the CR that would be applied on the standard output and the result of the checks and the
+// pull planning report on the standard error, without changing the cluster
+func runDryRun(cmd *cobra.Command) error {
+	var entandoApp *images.EntandoApp
+	var olm bool
+	var err error
+
+	if fileName, _ := cmd.Flags().GetString(fileFlag); fileName != "" {
+		if entandoApp, err = service.ReadCustomResource(fileName); err != nil {
+			return err
+		}
+		if olm, err = generate.IsOlm(cmd); err != nil {
+			return err
+		}
+	} else {
+		if entandoApp, olm, err = generate.ParseEntandoAppFromCmd(cmd); err != nil {
+			return err
+		}
+		needsFix, err := generate.AdaptImages(cmd, entandoApp, olm)
+		if err != nil {
+			return err
+		}
+		if err := service.GenerateCustomResource("", entandoApp, needsFix); err != nil {
+			return err
+		}
+	}
+
+	if skipOperatorCheck, _ := cmd.Flags().GetBool(skipOperatorCheckFlag); !skipOperatorCheck {
+		matrixFile, _ := cmd.Flags().GetString(compatibilityMatrixFlag)
+		check, err := service.CheckOperators(entandoApp.Spec.Version, matrixFile)
+		if err != nil {
+			return err
+		}
+		for _, line := range check.Lines() {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		if service.HasBlockingIssues(check.Issues) {
+			fmt.Fprintf(os.Stderr, "WARNING: the installed operators don't support Entando %s and have to be upgraded\n", entandoApp.Spec.Version)
+		}
+	}
+
+	if !olm {
+		checkHelmRelease(cmd, entandoApp)
+	}
+
+	bandwidth, _ := cmd.Flags().GetFloat64(pullBandwidthFlag)
+	PrintPullPlan(os.Stderr, service.GetPullPlan(entandoApp, bandwidth))
+
+	fmt.Fprintln(os.Stderr, "Dry run completed, no changes applied")
+	return nil
+}
+
+// PrintPullPlan writes the sizes of the images and the estimated pull time of each node
+func PrintPullPlan(out io.Writer, plan service.PullPlan) {
+	fmt.Fprintln(out, "Images:")
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tIMAGE\tSIZE")
+	for _, image := range plan.Images {
+		size := bytesize.Format(image.Size())
+		if image.Error != "" {
+			size = "unknown (" + image.Error + ")"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", image.Component, image.Image, size)
+	}
+	writer.Flush()
+	if len(plan.Skipped) > 0 {
+		fmt.Fprintf(out, "Not included, unable to determine the image: %s\n", strings.Join(plan.Skipped, ", "))
+	}
+
+	fmt.Fprintf(out, "Total compressed size: %s\n", bytesize.Format(plan.TotalSize))
+	if plan.Bandwidth <= 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "Estimated pull time at %g Mbit/s:\n", plan.Bandwidth)
+	writer = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "NODE\tTO PULL\tTIME")
+	for _, node := range plan.Nodes {
+		name := node.Node
+		if name == "" {
+			name = "any"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", name, bytesize.Format(node.Bytes), node.Duration)
+	}
+	writer.Flush()
+	fmt.Fprintf(out, "Maximum estimated pull time: %s\n", plan.MaxDuration())
+}
@@ -0,0 +1,161 @@
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	stallaction "upgrade-cli/flag/stall_action"
+	"upgrade-cli/service"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// progressView displays the upgrade progress and the state of each component
+type progressView interface {
+	Update(status *v1alpha1.EntandoAppV2Status, components []service.ComponentStatus, stall *service.Stall)
+	Close()
+}
+
+// displayProgress tracks the upgrade until its completion. When the upgrade is stalled the likely causes are
+// displayed and, according to the stall action, a StallError is returned or the tracking continues.
+func displayProgress(stallTimeout time.Duration, onStall stallaction.StallAction) error {
+	var view progressView
+	stallDetector := service.NewStallDetector(stallTimeout, time.Now())
+
+	for {
+		entandoApp, err := service.GetEntandoApp()
+		if err != nil {
+			if view != nil {
+				view.Close()
+			}
+			return err
+		}
+
+		status, err := parseStatus(entandoApp.EntandoAppV2)
+
+		if err != nil {
+			if view != nil {
+				view.Close()
+			}
+			return err
+		}
+
+		// the components breakdown is only informative, so errors in retrieving it are ignored
+		components, _ := service.GetComponentsStatus(entandoApp)
+
+		var stall *service.Stall
+		if status.Progress != status.Total {
+			stall = stallDetector.Check(status.Progress, components, time.Now())
+		}
+
+		if view == nil {
+			view = newProgressView(os.Stderr, status.Total)
+		}
+		view.Update(status, components, stall)
+
+		if status.Progress == status.Total {
+			view.Close()
+			fmt.Fprintf(os.Stderr, "Upgrade successfully completed\n")
+			return nil
+		}
+
+		if stall != nil && onStall == stallaction.Exit {
+			view.Close()
+			return &service.StallError{Stall: stall}
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// newProgressView returns a multi-line view if the writer is a terminal, otherwise a view printing plain log lines
+func newProgressView(writer *os.File, total int) progressView {
+	if term.IsTerminal(int(writer.Fd())) {
+		return &ttyProgressView{writer: writer, bar: newProgressbar(total)}
+	}
+	return &logProgressView{writer: writer, progress: -1, components: map[string]string{}}
+}
+
+// ttyProgressView redraws the progress bar followed by one row per component
+type ttyProgressView struct {
+	writer    io.Writer
+	bar       *progressbar.ProgressBar
+	lastLines int
+}
+
+func (v *ttyProgressView) Update(status *v1alpha1.EntandoAppV2Status, components []service.ComponentStatus, stall *service.Stall) {
+	v.bar.Set(status.Progress)
+
+	lines := []string{strings.TrimPrefix(v.bar.String(), "\r")}
+	for _, component := range components {
+		lines = append(lines, "  "+component.String())
+	}
+	if stall != nil {
+		lines = append(lines, stall.Lines()...)
+	}
+
+	// move the cursor to the beginning of the previous frame
+	if v.lastLines > 0 {
+		fmt.Fprintf(v.writer, "\033[%dA", v.lastLines)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(v.writer, "\r\033[K%s\n", line)
+	}
+	// clear rows left by a longer previous frame
+	for i := len(lines); i < v.lastLines; i++ {
+		fmt.Fprint(v.writer, "\r\033[K\n")
+	}
+	if len(lines) > v.lastLines {
+		v.lastLines = len(lines)
+	}
+}
+
+func (v *ttyProgressView) Close() {
+	v.bar.Close()
+}
+
+// logProgressView prints a line every time the progress, the state of a component or the stall causes change
+type logProgressView struct {
+	writer     io.Writer
+	progress   int
+	components map[string]string
+	stall      string
+}
+
+func (v *logProgressView) Update(status *v1alpha1.EntandoAppV2Status, components []service.ComponentStatus, stall *service.Stall) {
+	if status.Progress != v.progress {
+		v.progress = status.Progress
+		fmt.Fprintf(v.writer, "Upgrade in progress... %d/%d\n", status.Progress, status.Total)
+	}
+	for _, component := range components {
+		line := component.String()
+		if v.components[component.Component] != line {
+			v.components[component.Component] = line
+			fmt.Fprintln(v.writer, line)
+		}
+	}
+	if stall == nil {
+		v.stall = ""
+	} else if stallLines := strings.Join(stall.Lines(), "\n"); stallLines != v.stall {
+		v.stall = stallLines
+		fmt.Fprintln(v.writer, stallLines)
+	}
+}
+
+func (v *logProgressView) Close() {
+}
+
+// newProgressbar creates the bar used to render the overall progress, which is drawn by the ttyProgressView
+func newProgressbar(total int) *progressbar.ProgressBar {
+	return progressbar.NewOptions(total,
+		progressbar.OptionSetDescription("Upgrade in progress..."),
+		progressbar.OptionSetWriter(io.Discard),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionThrottle(0),
+	)
+}
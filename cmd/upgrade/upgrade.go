@@ -4,20 +4,42 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"time"
 	"upgrade-cli/cmd/generate"
+	"upgrade-cli/cmd/helm"
+	"upgrade-cli/cmd/operator"
+	"upgrade-cli/cmd/verify"
+	backupmode "upgrade-cli/flag/backup_mode"
+	stallaction "upgrade-cli/flag/stall_action"
 	"upgrade-cli/service"
 	"upgrade-cli/util/images"
 
 	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	fileFlag  = "file"
-	forceFlag = "force"
+	fileFlag              = "file"
+	forceFlag             = "force"
+	hooksFileFlag         = "hooks-file"
+	backupFlag            = "backup"
+	backupModeFlag        = "backup-mode"
+	backupDirFlag         = "backup-dir"
+	snapshotClassFlag     = "snapshot-class"
+	verifyFlag            = "verify"
+	diagnosticsFlag       = "diagnostics"
+	stallTimeoutFlag      = "stall-timeout"
+	onStallFlag           = "on-stall"
+	skipOperatorCheckFlag = "skip-operator-check"
+	upgradeOperatorFlag   = "upgrade-operator"
+	dryRunFlag            = "dry-run"
+	pullBandwidthFlag     = "pull-bandwidth"
+
+	// operator flag also used by the dry run
+	compatibilityMatrixFlag = operator.CompatibilityMatrixFlag
 
 	Succeeded = "Succeeded"
 )
@@ -38,100 +60,246 @@ var UpgradeCmd = &cobra.Command{
 		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.LatestVersionFlag)
 		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.OperatorModeFlag)
 		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.ImageSetTypeFlag)
+		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.ImagesFileFlag)
+		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.AllImagesTagFlag)
+		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.ImagesFromReleaseNotesFlag)
+		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.PinFlag)
+		cmd.MarkFlagsMutuallyExclusive(fileFlag, generate.PlatformFlag)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Prevent showing usage message when error happens in RunE func
 		cmd.SilenceUsage = true
 
-		fileName, _ := cmd.Flags().GetString(fileFlag)
-		force, _ := cmd.Flags().GetBool(forceFlag)
+		if dryRun, _ := cmd.Flags().GetBool(dryRunFlag); dryRun {
+			return runDryRun(cmd)
+		}
 
-		if fileName == "" {
-			file, err := os.CreateTemp("", "entandoapp-cr")
-			if err != nil {
-				return err
-			}
+		record := service.NewUpgradeRecord(getUsedFlags(cmd))
 
-			fileName = file.Name()
-			defer os.Remove(fileName)
+		hooksFileName, _ := cmd.Flags().GetString(hooksFileFlag)
+		hooks, err := service.LoadHooksConfig(hooksFileName)
+		if err == nil {
+			err = runUpgrade(cmd, record, hooks)
+			err = runCompletionHooks(hooks, record, err)
+		}
 
-			entandoApp, olm, err := generate.ParseEntandoAppFromCmd(cmd)
-			if err != nil {
-				return err
-			}
+		service.CompleteUpgradeRecord(record, err)
 
-			needsFix := service.AdaptImagesOverride(entandoApp, olm)
+		return err
+	},
+}
 
-			err = service.GenerateCustomResource(fileName, entandoApp, needsFix)
-			if err != nil {
-				return err
-			}
+func runUpgrade(cmd *cobra.Command, record *service.UpgradeRecord, hooks *service.HooksConfig) error {
 
-			if needsFix {
-				// Move temporary file to current directory
-				fileToFix := path.Base(fileName) + "-fixme.yaml"
-				os.Rename(fileName, fileToFix)
-				return fmt.Errorf("upgrade not applied because the generated CR file needs to be fixed. Please edit %s", fileToFix)
-			}
-		}
+	fileName, _ := cmd.Flags().GetString(fileFlag)
+	force, _ := cmd.Flags().GetBool(forceFlag)
+
+	if currentApp, err := service.GetEntandoApp(); err == nil {
+		record.SourceVersion = currentApp.Spec.Version
+	}
+
+	if err := hooks.Run(service.NewHookContext(service.PreValidate, record, nil)); err != nil {
+		return err
+	}
+
+	var entandoApp *images.EntandoApp
+	var olm bool
+	fromFile := fileName != ""
 
-		err := service.CreateEntandoApp(fileName, force)
+	if !fromFile {
+		file, err := os.CreateTemp("", "entandoapp-cr")
 		if err != nil {
 			return err
 		}
 
-		fmt.Fprintf(os.Stderr, "Changes applied\n")
+		fileName = file.Name()
+		defer os.Remove(fileName)
 
-		return displayProgress()
-	},
-}
+		entandoApp, olm, err = generate.ParseEntandoAppFromCmd(cmd)
+		if err != nil {
+			return err
+		}
 
-func displayProgress() error {
-	var bar *progressbar.ProgressBar
+		needsFix, err := generate.AdaptImages(cmd, entandoApp, olm)
+		if err != nil {
+			return err
+		}
 
-	for {
-		entandoApp, err := service.GetEntandoApp()
+		err = service.GenerateCustomResource(fileName, entandoApp, needsFix)
 		if err != nil {
-			if bar != nil {
-				bar.Close()
-			}
 			return err
 		}
 
-		status, err := parseStatus(entandoApp)
+		if needsFix {
+			// Move temporary file to current directory
+			fileToFix := path.Base(fileName) + "-fixme.yaml"
+			os.Rename(fileName, fileToFix)
+			return fmt.Errorf("upgrade not applied because the generated CR file needs to be fixed. Please edit %s", fileToFix)
+		}
+	} else {
+		var err error
+		entandoApp, err = service.ReadCustomResource(fileName)
+		if err != nil {
+			return err
+		}
+	}
 
+	record.SetTarget(entandoApp)
+
+	if sbom, _ := cmd.Flags().GetBool(generate.SbomFlag); sbom {
+		sbomFile, err := service.GetRecordSbomPath(record)
 		if err != nil {
-			if bar != nil {
-				bar.Close()
-			}
 			return err
 		}
+		if record.Sbom, err = service.WriteUpgradeSbom(sbomFile, entandoApp); err != nil {
+			return err
+		}
+	}
+
+	if skipOperatorCheck, _ := cmd.Flags().GetBool(skipOperatorCheckFlag); !skipOperatorCheck {
+		if err := checkOperators(cmd, entandoApp.Spec.Version, olm, fromFile); err != nil {
+			return err
+		}
+	}
 
-		if bar == nil {
-			bar = newProgressbar(status.Total)
+	if fromFile {
+		// the Helm check only applies to plain installations, so the operator mode of the cluster is needed
+		var err error
+		if olm, err = generate.IsOlm(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to determine the operator mode, the Helm release is not checked: %s\n", err.Error())
+			olm = true
 		}
-		bar.Set(status.Progress)
+	}
+	if !olm {
+		checkHelmRelease(cmd, entandoApp)
+	}
 
-		if status.Progress == status.Total {
-			bar.Close()
-			fmt.Fprintf(os.Stderr, "Upgrade successfully completed\n")
-			return nil
+	if backup, _ := cmd.Flags().GetBool(backupFlag); backup {
+		manifest, err := service.Backup(getBackupOptions(cmd, record))
+		if err != nil {
+			return fmt.Errorf("upgrade not applied because the backup failed: %s", err.Error())
 		}
+		record.Backup = manifest.Summary()
+	}
+
+	if err := hooks.Run(service.NewHookContext(service.PreApply, record, nil)); err != nil {
+		return err
+	}
+
+	err := service.CreateEntandoApp(fileName, force)
+	if err != nil {
+		return err
+	}
+	record.ResourceName = entandoApp.Name
+
+	fmt.Fprintf(os.Stderr, "Changes applied\n")
 
-		time.Sleep(1 * time.Second)
+	if err := hooks.Run(service.NewHookContext(service.PostApply, record, nil)); err != nil {
+		return err
+	}
+
+	stallTimeout, _ := cmd.Flags().GetDuration(stallTimeoutFlag)
+	onStall, _ := cmd.Flags().GetString(onStallFlag)
+
+	if err := displayProgress(stallTimeout, stallaction.StallAction(onStall)); err != nil {
+		if diagnostics, _ := cmd.Flags().GetBool(diagnosticsFlag); diagnostics {
+			collectDiagnostics(record, fileName)
+		}
+		return err
+	}
+
+	if verifyUpgrade, _ := cmd.Flags().GetBool(verifyFlag); verifyUpgrade {
+		return verify.RunVerify(cmd)
+	}
+
+	return nil
+}
+
+// checkOperators verifies that the installed operators support the target version and, if requested, upgrades them.
+// When the CR is read from a file the operator mode has to be retrieved from the cluster.
+func checkOperators(cmd *cobra.Command, targetVersion string, olm bool, detectMode bool) error {
+	check, err := operator.CheckOperators(cmd, targetVersion)
+	if err != nil {
+		return err
+	}
+	if !service.HasBlockingIssues(check.Issues) {
+		return nil
+	}
+
+	if upgradeOperator, _ := cmd.Flags().GetBool(upgradeOperatorFlag); !upgradeOperator {
+		return fmt.Errorf("upgrade not applied because the installed operators don't support Entando %s. Use --%s to upgrade them first", targetVersion, upgradeOperatorFlag)
+	}
+
+	if detectMode {
+		if olm, err = generate.IsOlm(cmd); err != nil {
+			return err
+		}
+	}
+
+	return operator.UpgradeOperators(cmd, targetVersion, olm, check.Rule)
+}
+
+// checkHelmRelease warns when the Helm release of a plain installation doesn't match the EntandoAppV2.
+// Failures are only reported, since the release is not required by the upgrade.
+func checkHelmRelease(cmd *cobra.Command, entandoApp *images.EntandoApp) {
+	release, err := service.GetHelmRelease()
+	if err == nil && release != nil {
+		err = helm.CheckDrift(cmd, release, entandoApp)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to check the Helm release: %s\n", err.Error())
+	}
+}
+
+// runCompletionHooks executes the on-success or on-failure hooks according to the upgrade result.
+// Failures of these hooks are only reported, since the upgrade is already completed or failed.
+func runCompletionHooks(hooks *service.HooksConfig, record *service.UpgradeRecord, upgradeErr error) error {
+	phase := service.OnSuccess
+	if upgradeErr != nil {
+		phase = service.OnFailure
+	}
+	if err := hooks.Run(service.NewHookContext(phase, record, upgradeErr)); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", err.Error())
+	}
+	return upgradeErr
+}
+
+// collectDiagnostics creates the diagnostics bundle of a failed upgrade in the current directory
+func collectDiagnostics(record *service.UpgradeRecord, crFile string) {
+	fmt.Fprintln(os.Stderr, "Collecting diagnostics...")
+	archive, err := service.CollectDiagnostics(service.DiagnosticsOptions{Directory: ".", CRFile: crFile})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to collect diagnostics: %s\n", err.Error())
+		return
+	}
+	record.DiagnosticsBundle = archive
+	fmt.Fprintf(os.Stderr, "Diagnostics bundle saved to %s\n", archive)
+}
+
+func getBackupOptions(cmd *cobra.Command, record *service.UpgradeRecord) service.BackupOptions {
+	mode, _ := cmd.Flags().GetString(backupModeFlag)
+	directory, _ := cmd.Flags().GetString(backupDirFlag)
+	snapshotClass, _ := cmd.Flags().GetString(snapshotClassFlag)
+
+	if directory == "" {
+		directory = "entando-backup-" + record.ID
+	}
+
+	return service.BackupOptions{
+		ID:            record.ID,
+		Mode:          backupmode.BackupMode(mode),
+		Directory:     directory,
+		SnapshotClass: snapshotClass,
 	}
 }
 
-func newProgressbar(total int) *progressbar.ProgressBar {
-	return progressbar.NewOptions(total,
-		progressbar.OptionSetDescription("Upgrade in progress..."),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionShowCount(),
-		progressbar.OptionFullWidth(),
-	)
+// getUsedFlags returns the flags explicitly set by the user, to be stored in the upgrade record
+func getUsedFlags(cmd *cobra.Command) map[string]string {
+	flags := map[string]string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
 }
 
 func parseStatus(entandoApp *v1alpha1.EntandoAppV2) (*v1alpha1.EntandoAppV2Status, error) {
@@ -147,6 +315,33 @@ func parseStatus(entandoApp *v1alpha1.EntandoAppV2) (*v1alpha1.EntandoAppV2Statu
 
 func init() {
 	generate.AddCRFlags(UpgradeCmd)
+	generate.AddSbomFlag(UpgradeCmd)
 	UpgradeCmd.Flags().Bool(forceFlag, false, "if set, the changes to the CR are applied even if the resource already exists")
 	UpgradeCmd.Flags().StringP(fileFlag, "f", "", "path to CR file")
+	UpgradeCmd.Flags().Bool(dryRunFlag, false, "if set, the CR is printed with the checks results and the image pull estimates, without applying the changes")
+	UpgradeCmd.Flags().Float64(pullBandwidthFlag, 100, "bandwidth in Mbit/s used to estimate the image pull time in dry run (0 to disable)")
+	UpgradeCmd.Flags().String(hooksFileFlag, "", "path to a YAML file defining the hooks to run during the upgrade phases")
+
+	UpgradeCmd.Flags().Bool(backupFlag, false, "if set, a backup of the Entando databases or volumes is taken before applying the changes")
+	backupModeFlagValue := backupmode.GetBackupModeFlag()
+	backupModeFlagUsage := "Backup the datasources with a logical dump or the persistent volumes with VolumeSnapshots. Possible values: " + strings.Join(backupmode.GetBackupModeValues(), ", ")
+	UpgradeCmd.Flags().Var(backupModeFlagValue, backupModeFlag, backupModeFlagUsage)
+	UpgradeCmd.Flags().String(backupDirFlag, "", "directory where the backup manifest and the dumps are stored (default entando-backup-<upgrade id>)")
+	UpgradeCmd.Flags().String(snapshotClassFlag, "", "VolumeSnapshotClass used in Snapshot backup mode")
+
+	UpgradeCmd.Flags().Bool(verifyFlag, false, "if set, the Entando app endpoints are checked after the upgrade is completed")
+	verify.AddVerifyFlags(UpgradeCmd, 2*time.Minute)
+
+	UpgradeCmd.Flags().Bool(skipOperatorCheckFlag, false, "if set, the compatibility of the installed operators with the target version is not checked")
+	UpgradeCmd.Flags().Bool(upgradeOperatorFlag, false, "if set, the operators not supporting the target version are upgraded before applying the changes")
+	operator.AddOperatorFlags(UpgradeCmd)
+	helm.AddValuesPatchFlag(UpgradeCmd)
+
+	UpgradeCmd.Flags().Bool(diagnosticsFlag, true, "collect a diagnostics bundle in the current directory when the upgrade fails")
+
+	UpgradeCmd.Flags().Duration(stallTimeoutFlag, 10*time.Minute, "the upgrade is considered stalled if the progress doesn't advance for this duration (0 to disable)")
+	onStallFlagValue := stallaction.GetStallActionFlag()
+	onStallFlagUsage := fmt.Sprintf("Action performed when the upgrade is stalled: Exit terminates with exit code %d, Wait keeps tracking the progress. Possible values: %s",
+		service.StallExitCode, strings.Join(stallaction.GetStallActionValues(), ", "))
+	UpgradeCmd.Flags().Var(onStallFlagValue, onStallFlag, onStallFlagUsage)
 }
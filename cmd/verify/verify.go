@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+	"upgrade-cli/service"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Flags shared with the upgrade command
+	NoTLSFlag         = "no-tls"
+	VerifyTimeoutFlag = "verify-timeout"
+)
+
+var VerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the Entando app endpoints respond correctly",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Prevent showing usage message when error happens in RunE func
+		cmd.SilenceUsage = true
+
+		return RunVerify(cmd)
+	},
+}
+
+// RunVerify probes the Entando endpoints on the ingress host and prints the report
+func RunVerify(cmd *cobra.Command) error {
+	noTLS, _ := cmd.Flags().GetBool(NoTLSFlag)
+	timeout, _ := cmd.Flags().GetDuration(VerifyTimeoutFlag)
+
+	verifier, err := service.NewVerifier(service.GetAppSettings().IngressHostName, !noTLS)
+	if err != nil {
+		return err
+	}
+	// the reported versions are compared with the version of the EntandoAppV2, when available
+	if entandoApp, err := service.GetEntandoApp(); err == nil {
+		verifier.ExpectedVersion = entandoApp.Spec.Version
+	}
+
+	var results []service.VerifyResult
+	if timeout > 0 {
+		results = verifier.VerifyUntil(timeout)
+	} else {
+		results = verifier.Verify()
+	}
+
+	PrintReport(os.Stdout, results)
+
+	if !service.VerifyPassed(results) {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
+}
+
+// PrintReport writes the verification results as a table
+func PrintReport(out io.Writer, results []service.VerifyResult) {
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tURL\tSTATUS\tTLS\tVERSION\tRESULT")
+	for _, result := range results {
+		status := "-"
+		if result.Status != 0 {
+			status = fmt.Sprint(result.Status)
+		}
+		outcome := "PASS"
+		if result.Warning != "" {
+			outcome = "PASS (WARNING: " + result.Warning + ")"
+		}
+		if !result.Passed {
+			outcome = "FAIL: " + result.Error
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", result.Component, result.URL, status, result.TLS, result.Version, outcome)
+	}
+	writer.Flush()
+}
+
+// AddVerifyFlags adds the flags used to configure the verification
+func AddVerifyFlags(cmd *cobra.Command, defaultTimeout time.Duration) {
+	cmd.Flags().Bool(NoTLSFlag, false, "probe the endpoints using plain HTTP instead of HTTPS")
+	cmd.Flags().Duration(VerifyTimeoutFlag, defaultTimeout, "keep retrying the failed checks until this timeout expires")
+}
+
+func init() {
+	AddVerifyFlags(VerifyCmd, 0)
+}
@@ -0,0 +1,7 @@
+package common
+
+// ExitCodeError is implemented by errors that require the CLI to terminate with a specific exit code
+type ExitCodeError interface {
+	error
+	ExitCode() int
+}
@@ -0,0 +1,18 @@
+package backupmode
+
+import "upgrade-cli/flag"
+
+type BackupMode string
+
+const (
+	Dump     BackupMode = "Dump"
+	Snapshot BackupMode = "Snapshot"
+)
+
+func GetBackupModeFlag() *flag.EnumFlag {
+	return flag.NewEnumFlag(GetBackupModeValues(), string(Dump))
+}
+
+func GetBackupModeValues() []string {
+	return []string{string(Dump), string(Snapshot)}
+}
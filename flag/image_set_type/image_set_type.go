@@ -1,6 +1,10 @@
 package imagesettype
 
-import "upgrade-cli/flag"
+import (
+	"upgrade-cli/flag"
+
+	"github.com/spf13/pflag"
+)
 
 type ImageSetType string
 
@@ -10,10 +14,40 @@ const (
 	Auto            ImageSetType = "Auto"
 )
 
-func GetImageSetTypeFlag() *flag.EnumFlag {
-	return flag.NewEnumFlag(GetImageSetTypeValues(), string(Auto))
+// custom image set types registered from the components descriptor
+var customValues = []string{}
+
+// imageSetTypeFlag accepts the custom image set types registered after the flag creation
+type imageSetTypeFlag struct {
+	*flag.EnumFlag
+}
+
+func (f imageSetTypeFlag) Set(value string) error {
+	f.Allowed = GetImageSetTypeValues()
+	return f.EnumFlag.Set(value)
+}
+
+func GetImageSetTypeFlag() pflag.Value {
+	return imageSetTypeFlag{flag.NewEnumFlag(GetImageSetTypeValues(), string(Auto))}
 }
 
 func GetImageSetTypeValues() []string {
-	return []string{string(RedhatCertified), string(Community), string(Auto)}
+	values := []string{string(RedhatCertified), string(Community)}
+	values = append(values, customValues...)
+	return append(values, string(Auto))
+}
+
+// AddImageSetType makes a custom image set type selectable
+func AddImageSetType(imageSetType ImageSetType) {
+	for _, value := range GetImageSetTypeValues() {
+		if value == string(imageSetType) {
+			return
+		}
+	}
+	customValues = append(customValues, string(imageSetType))
+}
+
+// IsCustom returns true if the image set type is set and is not one of the built-in types
+func IsCustom(imageSetType ImageSetType) bool {
+	return imageSetType != "" && imageSetType != Community && imageSetType != RedhatCertified && imageSetType != Auto
 }
@@ -0,0 +1,18 @@
+package imagesformat
+
+import "upgrade-cli/flag"
+
+type ImagesFormat string
+
+const (
+	Table     ImagesFormat = "Table"
+	Overrides ImagesFormat = "Overrides"
+)
+
+func GetImagesFormatFlag() *flag.EnumFlag {
+	return flag.NewEnumFlag(GetImagesFormatValues(), string(Table))
+}
+
+func GetImagesFormatValues() []string {
+	return []string{string(Table), string(Overrides)}
+}
@@ -0,0 +1,18 @@
+package pinmode
+
+import "upgrade-cli/flag"
+
+type PinMode string
+
+const (
+	Index    PinMode = "index"
+	Platform PinMode = "platform"
+)
+
+func GetPinModeFlag() *flag.EnumFlag {
+	return flag.NewEnumFlag(GetPinModeValues(), string(Index))
+}
+
+func GetPinModeValues() []string {
+	return []string{string(Index), string(Platform)}
+}
@@ -0,0 +1,64 @@
+package severity
+
+import (
+	"strings"
+	"upgrade-cli/flag"
+)
+
+type Severity string
+
+const (
+	None     Severity = "None"
+	Unknown  Severity = "Unknown"
+	Low      Severity = "Low"
+	Medium   Severity = "Medium"
+	High     Severity = "High"
+	Critical Severity = "Critical"
+)
+
+// severities from the lowest to the highest
+var orderedSeverities = []Severity{Unknown, Low, Medium, High, Critical}
+
+func GetSeverityThresholdFlag() *flag.EnumFlag {
+	return flag.NewEnumFlag(GetSeverityThresholdValues(), string(Critical))
+}
+
+func GetSeverityThresholdValues() []string {
+	return []string{string(None), string(Low), string(Medium), string(High), string(Critical)}
+}
+
+// Parse converts a severity reported by a scanner (e.g. HIGH) to a Severity, returning Unknown if it isn't recognized
+func Parse(value string) Severity {
+	for _, severity := range orderedSeverities {
+		if strings.EqualFold(value, string(severity)) {
+			return severity
+		}
+	}
+	return Unknown
+}
+
+// GetOrderedSeverities returns the severities from the highest to the lowest
+func GetOrderedSeverities() []Severity {
+	severities := []Severity{}
+	for i := len(orderedSeverities) - 1; i >= 0; i-- {
+		severities = append(severities, orderedSeverities[i])
+	}
+	return severities
+}
+
+// AtLeast returns true if the severity is greater than or equal to the threshold. No severity reaches the None threshold.
+func (s Severity) AtLeast(threshold Severity) bool {
+	if threshold == None {
+		return false
+	}
+	return rank(s) >= rank(threshold)
+}
+
+func rank(severity Severity) int {
+	for i, s := range orderedSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
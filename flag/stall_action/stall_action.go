@@ -0,0 +1,18 @@
+package stallaction
+
+import "upgrade-cli/flag"
+
+type StallAction string
+
+const (
+	Exit StallAction = "Exit"
+	Wait StallAction = "Wait"
+)
+
+func GetStallActionFlag() *flag.EnumFlag {
+	return flag.NewEnumFlag(GetStallActionValues(), string(Wait))
+}
+
+func GetStallActionValues() []string {
+	return []string{string(Exit), string(Wait)}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	openshiftRouteResource = "routes.route.openshift.io"
+	// label set by the Entando operator on the resources of the app
+	entandoAppLabel = "EntandoApp"
+)
+
+// AppSettings contains the name and the ingress host name of the Entando app
+type AppSettings struct {
+	AppName         string
+	IngressHostName string
+}
+
+// openshiftRoute contains the fields of the OpenShift Route resource used by the CLI
+type openshiftRoute struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Host string `json:"host"`
+	} `json:"spec"`
+}
+
+type openshiftRouteList struct {
+	Items []openshiftRoute `json:"items"`
+}
+
+// GetAppSettings returns the app name and the ingress host name set by the ent wrapper through the environment
+// variables or, if they are missing, the ones discovered from the resources in the cluster.
+// The cluster is accessed only when some values are missing, showing a warning if the discovered values disagree
+// with the environment ones. Values that can't be determined are left empty.
+func GetAppSettings() AppSettings {
+	settings := AppSettings{
+		AppName:         os.Getenv(EntandoAppNameEnv),
+		IngressHostName: os.Getenv(EntandoIngressHostNameEnv),
+	}
+
+	if settings.AppName == "" || settings.IngressHostName == "" {
+		discovered, err := discoverAppSettings()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to discover the app settings from the cluster: %s\n", err.Error())
+		}
+		warnAppSettingsMismatch(EntandoAppNameEnv, settings.AppName, discovered.AppName)
+		warnAppSettingsMismatch(EntandoIngressHostNameEnv, settings.IngressHostName, discovered.IngressHostName)
+		if settings.AppName == "" {
+			settings.AppName = discovered.AppName
+		}
+		if settings.IngressHostName == "" {
+			settings.IngressHostName = discovered.IngressHostName
+		}
+	}
+
+	return settings
+}
+
+func warnAppSettingsMismatch(env, value, discovered string) {
+	if value != "" && discovered != "" && value != discovered {
+		fmt.Fprintf(os.Stderr, "WARNING: the environment variable %s is '%s', but the value found in the cluster is '%s'\n", env, value, discovered)
+	}
+}
+
+// discoverAppSettings reads the app settings from the EntandoAppV2 resource or, if it doesn't exist, from the legacy
+// EntandoApp (v1) resource. If the ingress host name isn't set in the resource, it is read from the Ingress or
+// from the OpenShift Route of the app.
+func discoverAppSettings() (AppSettings, error) {
+	settings := AppSettings{}
+
+	if entandoApp, err := GetEntandoApp(); err == nil {
+		settings.AppName = entandoApp.Spec.EntandoAppName
+		settings.IngressHostName = entandoApp.Spec.IngressHostName
+	} else {
+		legacyApp, legacyErr := GetLegacyEntandoApp()
+		if legacyErr != nil {
+			return settings, legacyErr
+		}
+		if legacyApp == nil {
+			return settings, err
+		}
+		settings.AppName = legacyApp.Name
+		settings.IngressHostName = legacyApp.Spec.IngressHostName
+	}
+
+	if settings.AppName != "" && settings.IngressHostName == "" {
+		host, err := discoverIngressHostName(settings.AppName)
+		if err != nil {
+			return settings, err
+		}
+		settings.IngressHostName = host
+	}
+
+	return settings, nil
+}
+
+// discoverIngressHostName returns the host of the Ingress of the app or, if no Ingress is found, of its OpenShift Route.
+// An empty string is returned if none of them is found.
+func discoverIngressHostName(appName string) (string, error) {
+	ingresses := networkingv1.IngressList{}
+	if err := getResource(&ingresses, "ingresses"); err != nil {
+		return "", err
+	}
+	for _, ingress := range ingresses.Items {
+		if !isAppResource(ingress.ObjectMeta, appName) {
+			continue
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" {
+				return rule.Host, nil
+			}
+		}
+	}
+
+	routes := openshiftRouteList{}
+	if err := getResource(&routes, openshiftRouteResource); err != nil {
+		if strings.Contains(err.Error(), missingResourceTypeError) {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, route := range routes.Items {
+		if isAppResource(route.ObjectMeta, appName) && route.Spec.Host != "" {
+			return route.Spec.Host, nil
+		}
+	}
+
+	return "", nil
+}
+
+// isAppResource checks if the resource belongs to the app, looking at the label set by the Entando operator
+// or, if missing, at the resource name
+func isAppResource(meta metav1.ObjectMeta, appName string) bool {
+	if label, ok := meta.Labels[entandoAppLabel]; ok {
+		return label == appName
+	}
+	return strings.HasPrefix(meta.Name, appName+"-")
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"upgrade-cli/util/sys/spawn"
+)
+
+const entandoAppV2List = `apiVersion: v1
+kind: List
+items:
+- apiVersion: app.entando.org/v1alpha1
+  kind: EntandoAppV2
+  metadata:
+    name: my-app
+  spec:
+    entandoAppName: quickstart
+    ingressHostName: quickstart.example.com
+`
+
+func TestGetAppSettings(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+	t.Setenv(EntandoAppNameEnv, "")
+	t.Setenv(EntandoIngressHostNameEnv, "entando.example.com")
+
+	_, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		return spawn.Res{Stdout: entandoAppV2List}, nil
+	})
+	defer restore()
+
+	settings := GetAppSettings()
+	if settings.AppName != "quickstart" || settings.IngressHostName != "entando.example.com" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+}
+
+func TestGetAppSettingsFromEnv(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+	t.Setenv(EntandoAppNameEnv, "my-app")
+	t.Setenv(EntandoIngressHostNameEnv, "entando.example.com")
+
+	fake, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		return spawn.Res{Stdout: entandoAppV2List}, nil
+	})
+	defer restore()
+
+	settings := GetAppSettings()
+	if settings.AppName != "my-app" || settings.IngressHostName != "entando.example.com" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+	// the cluster is not accessed, since both the values are set
+	if len(fake.Commands) != 0 {
+		t.Fatalf("expected no commands, found %d", len(fake.Commands))
+	}
+}
+
+func TestDiscoverAppSettingsFromLegacyApp(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+
+	_, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		switch cmd.RawArgs()[1] {
+		case legacyEntandoAppResource:
+			return spawn.Res{Stdout: `{"items": [{"metadata": {"name": "quickstart"}, "spec": {"dbms": "postgresql"}}]}`}, nil
+		case "ingresses":
+			return spawn.Res{Stdout: `{"items": [
+				{"metadata": {"name": "quickstart-ingress", "labels": {"EntandoApp": "other"}}, "spec": {"rules": [{"host": "other.example.com"}]}},
+				{"metadata": {"name": "quickstart-ingress"}, "spec": {"rules": [{"host": "quickstart.example.com"}]}}
+			]}`}, nil
+		default:
+			return spawn.Res{Stdout: "apiVersion: v1\nkind: List\nitems: []\n"}, nil
+		}
+	})
+	defer restore()
+
+	settings, err := discoverAppSettings()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if settings.AppName != "quickstart" || settings.IngressHostName != "quickstart.example.com" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+}
+
+func TestDiscoverAppSettingsFromRoute(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+
+	_, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		switch cmd.RawArgs()[1] {
+		case "ingresses":
+			return spawn.Res{Stdout: `{"items": []}`}, nil
+		case openshiftRouteResource:
+			return spawn.Res{Stdout: `{"items": [{"metadata": {"name": "quickstart-route"}, "spec": {"host": "quickstart.apps.example.com"}}]}`}, nil
+		default:
+			return spawn.Res{Stdout: "apiVersion: v1\nkind: List\nitems:\n- kind: EntandoAppV2\n  spec:\n    entandoAppName: quickstart\n"}, nil
+		}
+	})
+	defer restore()
+
+	settings, err := discoverAppSettings()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if settings.AppName != "quickstart" || settings.IngressHostName != "quickstart.apps.example.com" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+}
@@ -0,0 +1,594 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	backupmode "upgrade-cli/flag/backup_mode"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	backupManifestFileName = "backup.json"
+	backupTimeout          = 10 * time.Minute
+
+	postgresqlEngine      = "postgresql"
+	mysqlEngine           = "mysql"
+	postgresqlClientImage = "docker.io/library/postgres:15"
+	mysqlClientImage      = "docker.io/library/mysql:8.0"
+
+	// the client pod of a dump is deleted after the copy, the lifetime only limits the pods left by an interrupted backup
+	dumpPodLifetime       = "86400"
+	dumpPodFile           = "/tmp/entando-dump.sql"
+	postgresqlDumpTrailer = "-- PostgreSQL database dump complete"
+	mysqlDumpTrailer      = "-- Dump completed"
+	dumpTrailerSearchSize = 256
+
+	volumeSnapshotApiGroup = "snapshot.storage.k8s.io"
+	volumeSnapshotKind     = "VolumeSnapshot"
+)
+
+// Datasource describes a database used by an Entando deployment, as declared in its environment variables
+type Datasource struct {
+	Name       string `json:"name"`
+	Deployment string `json:"deployment"`
+	Engine     string `json:"engine"`
+	Host       string `json:"host"`
+	Port       string `json:"port"`
+	Database   string `json:"database"`
+	// PostgreSQL schema, set if the datasource uses a specific schema of the database
+	Schema string `json:"schema,omitempty"`
+	// the username can be set in a secret or as a plain value
+	Username       string                    `json:"username,omitempty"`
+	UsernameSecret *corev1.SecretKeySelector `json:"usernameSecret,omitempty"`
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret"`
+}
+
+// BackupOptions contains the parameters used to perform a backup
+type BackupOptions struct {
+	ID            string
+	Mode          backupmode.BackupMode
+	Directory     string
+	SnapshotClass string
+}
+
+// BackupManifest describes the content of a backup. It is stored in the backup directory and used by the restore.
+type BackupManifest struct {
+	ID          string                `json:"id"`
+	Mode        backupmode.BackupMode `json:"mode"`
+	Timestamp   time.Time             `json:"timestamp"`
+	Directory   string                `json:"directory"`
+	Datasources []DatasourceBackup    `json:"datasources,omitempty"`
+	Volumes     []VolumeBackup        `json:"volumes,omitempty"`
+}
+
+// DatasourceBackup contains the logical dump of a datasource
+type DatasourceBackup struct {
+	Datasource Datasource `json:"datasource"`
+	File       string     `json:"file"`
+}
+
+// VolumeBackup contains the VolumeSnapshot of a persistent volume claim and the spec needed to recreate the claim
+type VolumeBackup struct {
+	PVC      string                           `json:"pvc"`
+	Snapshot string                           `json:"snapshot"`
+	Spec     corev1.PersistentVolumeClaimSpec `json:"spec"`
+}
+
+// BackupSummary is the backup information stored in the upgrade record
+type BackupSummary struct {
+	Mode     backupmode.BackupMode `json:"mode"`
+	Location string                `json:"location"`
+	Items    []string              `json:"items,omitempty"`
+}
+
+// Backup takes logical dumps of the Entando datasources (Dump mode) or VolumeSnapshots of the persistent
+// volume claims used by the Entando deployments (Snapshot mode). Any failure is returned as error, since
+// the upgrade must not continue without a complete backup.
+func Backup(options BackupOptions) (*BackupManifest, error) {
+
+	directory, err := filepath.Abs(options.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory %s. %s", directory, err.Error())
+	}
+
+	manifest := BackupManifest{
+		ID:        options.ID,
+		Mode:      options.Mode,
+		Timestamp: time.Now().UTC(),
+		Directory: directory,
+	}
+
+	deployments, err := GetDeployments()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Mode == backupmode.Snapshot {
+		err = snapshotVolumes(&manifest, deployments, options.SnapshotClass)
+	} else {
+		err = dumpDatasources(&manifest, deployments)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeBackupManifest(&manifest); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Backup completed in %s\n", directory)
+
+	return &manifest, nil
+}
+
+// Summary returns the backup information to be stored in the upgrade record
+func (m *BackupManifest) Summary() *BackupSummary {
+	summary := BackupSummary{Mode: m.Mode, Location: m.Directory}
+	for _, datasource := range m.Datasources {
+		summary.Items = append(summary.Items, datasource.File)
+	}
+	for _, volume := range m.Volumes {
+		summary.Items = append(summary.Items, volumeSnapshotKind+"/"+volume.Snapshot)
+	}
+	return &summary
+}
+
+func dumpDatasources(manifest *BackupManifest, deployments []appsv1.Deployment) error {
+	datasources, err := FindDatasources(deployments)
+	if err != nil {
+		return err
+	}
+	if len(datasources) == 0 {
+		return fmt.Errorf("no PostgreSQL or MySQL datasource found in the namespace")
+	}
+
+	for i, datasource := range datasources {
+		fmt.Fprintf(os.Stderr, "Dumping datasource %s (%s database %s)\n", datasource.Name, datasource.Engine, datasource.Database)
+
+		podName := fmt.Sprintf("entando-backup-%s-%d", manifest.ID, i)
+		fileName := filepath.Join(manifest.Directory, datasource.Name+".sql")
+		if err := dumpDatasource(podName, datasource, fileName); err != nil {
+			return fmt.Errorf("unable to dump datasource %s: %s", datasource.Name, err.Error())
+		}
+
+		manifest.Datasources = append(manifest.Datasources, DatasourceBackup{Datasource: datasource, File: fileName})
+	}
+
+	return nil
+}
+
+func snapshotVolumes(manifest *BackupManifest, deployments []appsv1.Deployment, snapshotClass string) error {
+	pvcs, err := GetPersistentVolumeClaims()
+	if err != nil {
+		return err
+	}
+
+	claims := getMountedClaims(deployments)
+	if len(claims) == 0 {
+		return fmt.Errorf("no persistent volume claim used by the deployments of the namespace")
+	}
+
+	for _, pvc := range pvcs {
+		if !claims[pvc.Name] {
+			continue
+		}
+
+		snapshotName := truncateName(pvc.Name + "-" + manifest.ID)
+		fmt.Fprintf(os.Stderr, "Creating %s %s\n", volumeSnapshotKind, snapshotName)
+
+		spec := map[string]interface{}{
+			"source": map[string]interface{}{"persistentVolumeClaimName": pvc.Name},
+		}
+		if snapshotClass != "" {
+			spec["volumeSnapshotClassName"] = snapshotClass
+		}
+		snapshot := unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": volumeSnapshotApiGroup + "/v1",
+			"kind":       volumeSnapshotKind,
+			"metadata":   map[string]interface{}{"name": snapshotName},
+			"spec":       spec,
+		}}
+
+		if err := applyObject(&snapshot); err != nil {
+			return fmt.Errorf("unable to create snapshot of %s: %s", pvc.Name, err.Error())
+		}
+		if err := waitForVolumeSnapshot(snapshotName); err != nil {
+			return err
+		}
+
+		manifest.Volumes = append(manifest.Volumes, VolumeBackup{PVC: pvc.Name, Snapshot: snapshotName, Spec: pvc.Spec})
+	}
+
+	return nil
+}
+
+func waitForVolumeSnapshot(name string) error {
+	deadline := time.Now().Add(backupTimeout)
+	for {
+		snapshot := unstructured.Unstructured{}
+		if err := getResource(&snapshot.Object, "volumesnapshot", name); err != nil {
+			return err
+		}
+
+		if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); ready {
+			return nil
+		}
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			return fmt.Errorf("snapshot %s failed: %s", name, message)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("snapshot %s not ready after %s", name, backupTimeout)
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// FindDatasources looks for the PostgreSQL and MySQL datasources declared in the environment variables of the deployments.
+// Supported formats are <PREFIX>_URL containing a JDBC URL with <PREFIX>_USERNAME (or <PREFIX>_USER) and <PREFIX>_PASSWORD,
+// and the Keycloak variables DB_VENDOR, DB_ADDR, DB_PORT, DB_DATABASE, DB_USER and DB_PASSWORD.
+func FindDatasources(deployments []appsv1.Deployment) ([]Datasource, error) {
+	datasources := []Datasource{}
+	found := map[string]bool{}
+
+	for _, deployment := range deployments {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			env := map[string]corev1.EnvVar{}
+			for _, envVar := range container.Env {
+				env[envVar.Name] = envVar
+			}
+
+			for _, envVar := range container.Env {
+				var datasource *Datasource
+				var prefix string
+				var err error
+
+				if strings.HasSuffix(envVar.Name, "_URL") && strings.HasPrefix(envVar.Value, "jdbc:") {
+					prefix = strings.TrimSuffix(envVar.Name, "_URL")
+					datasource, err = parseJdbcUrl(envVar.Value)
+				} else if envVar.Name == "DB_ADDR" {
+					prefix = "DB"
+					datasource = parseKeycloakDatasource(env)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("invalid datasource %s in deployment %s: %s", envVar.Name, deployment.Name, err.Error())
+				}
+				if datasource == nil {
+					continue
+				}
+
+				datasource.Deployment = deployment.Name
+				datasource.Name = sanitizeName(deployment.Name + "-" + prefix)
+				if err := setDatasourceCredentials(datasource, env, prefix); err != nil {
+					return nil, fmt.Errorf("unable to back up datasource %s: %s", datasource.Name, err.Error())
+				}
+
+				// datasources sharing a database can use different schemas and credentials, e.g. PORTDB and SERVDB
+				key := strings.Join([]string{datasource.Engine, datasource.Host, datasource.Port, datasource.Database,
+					datasource.Schema, getDatasourceUser(datasource)}, "|")
+				if found[key] {
+					continue
+				}
+
+				found[key] = true
+				datasources = append(datasources, *datasource)
+			}
+		}
+	}
+
+	return datasources, nil
+}
+
+// parseJdbcUrl returns the datasource described by a JDBC URL, or nil if the database engine is not supported
+func parseJdbcUrl(jdbcUrl string) (*Datasource, error) {
+	parsedUrl, err := url.Parse(strings.TrimPrefix(jdbcUrl, "jdbc:"))
+	if err != nil {
+		return nil, err
+	}
+
+	datasource := Datasource{
+		Host:     parsedUrl.Hostname(),
+		Port:     parsedUrl.Port(),
+		Database: strings.TrimPrefix(parsedUrl.Path, "/"),
+	}
+
+	switch parsedUrl.Scheme {
+	case postgresqlEngine:
+		datasource.Engine = postgresqlEngine
+		datasource.Schema = parsedUrl.Query().Get("currentSchema")
+		if datasource.Port == "" {
+			datasource.Port = "5432"
+		}
+	case mysqlEngine:
+		datasource.Engine = mysqlEngine
+		if datasource.Port == "" {
+			datasource.Port = "3306"
+		}
+	default:
+		return nil, nil
+	}
+
+	if datasource.Host == "" || datasource.Database == "" {
+		return nil, fmt.Errorf("missing host or database name")
+	}
+
+	return &datasource, nil
+}
+
+func parseKeycloakDatasource(env map[string]corev1.EnvVar) *Datasource {
+	datasource := Datasource{
+		Host:     env["DB_ADDR"].Value,
+		Port:     env["DB_PORT"].Value,
+		Database: env["DB_DATABASE"].Value,
+	}
+
+	switch env["DB_VENDOR"].Value {
+	case "postgres":
+		datasource.Engine = postgresqlEngine
+		if datasource.Port == "" {
+			datasource.Port = "5432"
+		}
+	case "mysql":
+		datasource.Engine = mysqlEngine
+		if datasource.Port == "" {
+			datasource.Port = "3306"
+		}
+	default:
+		return nil
+	}
+
+	if datasource.Host == "" || datasource.Database == "" {
+		return nil
+	}
+
+	return &datasource
+}
+
+func setDatasourceCredentials(datasource *Datasource, env map[string]corev1.EnvVar, prefix string) error {
+	username, ok := env[prefix+"_USERNAME"]
+	if !ok {
+		username, ok = env[prefix+"_USER"]
+	}
+	if !ok {
+		return fmt.Errorf("username variable not found")
+	}
+	if username.ValueFrom != nil && username.ValueFrom.SecretKeyRef != nil {
+		datasource.UsernameSecret = username.ValueFrom.SecretKeyRef
+	} else if username.Value != "" {
+		datasource.Username = username.Value
+	} else {
+		return fmt.Errorf("unsupported format for variable %s", username.Name)
+	}
+
+	password, ok := env[prefix+"_PASSWORD"]
+	if !ok || password.ValueFrom == nil || password.ValueFrom.SecretKeyRef == nil {
+		return fmt.Errorf("the password must be read from a secret")
+	}
+	datasource.PasswordSecret = password.ValueFrom.SecretKeyRef
+
+	return nil
+}
+
+// getDatasourceUser identifies the user of the datasource by its plain value or by the secret containing it
+func getDatasourceUser(datasource *Datasource) string {
+	if datasource.UsernameSecret != nil {
+		return datasource.UsernameSecret.Name + "/" + datasource.UsernameSecret.Key
+	}
+	return datasource.Username
+}
+
+func getDumpCommand(datasource Datasource) string {
+	if datasource.Engine == mysqlEngine {
+		return fmt.Sprintf(`mysqldump --single-transaction --routines --triggers -h %s -P %s -u "$DB_USERNAME" %s`,
+			shellQuote(datasource.Host), shellQuote(datasource.Port), shellQuote(datasource.Database))
+	}
+	schema := ""
+	if datasource.Schema != "" {
+		schema = " -n " + shellQuote(datasource.Schema)
+	}
+	return fmt.Sprintf(`pg_dump --clean --if-exists --no-owner --no-privileges -h %s -p %s -U "$DB_USERNAME"%s %s`,
+		shellQuote(datasource.Host), shellQuote(datasource.Port), schema, shellQuote(datasource.Database))
+}
+
+func getRestoreCommand(datasource Datasource) string {
+	if datasource.Engine == mysqlEngine {
+		return fmt.Sprintf(`mysql -h %s -P %s -u "$DB_USERNAME" %s`,
+			shellQuote(datasource.Host), shellQuote(datasource.Port), shellQuote(datasource.Database))
+	}
+	return fmt.Sprintf(`psql -v ON_ERROR_STOP=1 -q -h %s -p %s -U "$DB_USERNAME" -d %s`,
+		shellQuote(datasource.Host), shellQuote(datasource.Port), shellQuote(datasource.Database))
+}
+
+// dumpDatasource writes the dump to a file inside a temporary client pod and copies it to the given file once the
+// dump command succeeded. The copy is verified against the checksum computed in the pod and the dump must end
+// with the completion trailer of the client, so that a truncated dump is never reported as a valid backup.
+func dumpDatasource(podName string, datasource Datasource, fileName string) error {
+	image, overridesJson, err := getDatasourceClientOverrides(podName, datasource, "sleep "+dumpPodLifetime, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runKubectl("run", podName, "--image="+image, "--restart=Never", "--overrides="+overridesJson); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := runKubectl("delete", "pod", podName, "--ignore-not-found", "--wait=false"); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to delete pod %s: %s\n", podName, err.Error())
+		}
+	}()
+
+	if _, err := runKubectl("wait", "--for=condition=Ready", "pod/"+podName, "--timeout=5m"); err != nil {
+		return err
+	}
+
+	// dumps of large databases can take long, so the default kubectl timeout is not applied
+	dumpCommand := fmt.Sprintf("%s > %s && sha256sum %s", getDumpCommand(datasource), dumpPodFile, dumpPodFile)
+	checksumOutput, err := runKubectlContext(context.Background(), 0, nil, "exec", podName, "--", "sh", "-c", dumpCommand)
+	if err != nil {
+		return err
+	}
+	checksum := strings.Fields(checksumOutput)
+	if len(checksum) == 0 {
+		return fmt.Errorf("unable to read the checksum of the dump")
+	}
+
+	dump, err := runKubectlContext(context.Background(), 0, nil, "exec", podName, "--", "cat", dumpPodFile)
+	if err != nil {
+		return fmt.Errorf("unable to copy the dump: %s", err.Error())
+	}
+	if sum := sha256.Sum256([]byte(dump)); hex.EncodeToString(sum[:]) != checksum[0] {
+		return fmt.Errorf("the copied dump doesn't match the checksum of the dump in the pod")
+	}
+	if err := checkDumpTrailer(datasource, dump); err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, []byte(dump), 0600)
+}
+
+// checkDumpTrailer verifies that the dump ends with the comment written by the client when the dump is completed
+func checkDumpTrailer(datasource Datasource, dump string) error {
+	trailer := postgresqlDumpTrailer
+	if datasource.Engine == mysqlEngine {
+		trailer = mysqlDumpTrailer
+	}
+	tail := dump
+	if len(tail) > dumpTrailerSearchSize {
+		tail = tail[len(tail)-dumpTrailerSearchSize:]
+	}
+	if !strings.Contains(tail, trailer) {
+		return fmt.Errorf("the dump is incomplete: '%s' not found at the end of the dump", trailer)
+	}
+	return nil
+}
+
+// runDatasourceClient runs the command in a temporary pod having the database client tools and the datasource
+// credentials, read from the secrets so that they never leave the cluster. The pod standard output is returned.
+func runDatasourceClient(podName string, datasource Datasource, command string, stdin io.Reader) (string, error) {
+	image, overridesJson, err := getDatasourceClientOverrides(podName, datasource, command, stdin != nil)
+	if err != nil {
+		return "", err
+	}
+
+	attachFlag := "--attach"
+	if stdin != nil {
+		attachFlag = "-i"
+	}
+
+	// restores of large databases can take long, so the default kubectl timeout is not applied
+	return runKubectlContext(context.Background(), 0, stdin, "run", podName, "--image="+image, "--restart=Never", "--rm", attachFlag, "--quiet",
+		"--pod-running-timeout=5m", "--overrides="+overridesJson)
+}
+
+// getDatasourceClientOverrides returns the client image of the datasource engine and the pod spec overrides
+// running the command, with the datasource credentials read from the secrets
+func getDatasourceClientOverrides(podName string, datasource Datasource, command string, interactive bool) (string, string, error) {
+	image := postgresqlClientImage
+	passwordEnv := "PGPASSWORD"
+	if datasource.Engine == mysqlEngine {
+		image = mysqlClientImage
+		passwordEnv = "MYSQL_PWD"
+	}
+
+	usernameEnv := corev1.EnvVar{Name: "DB_USERNAME", Value: datasource.Username}
+	if datasource.UsernameSecret != nil {
+		usernameEnv = corev1.EnvVar{Name: "DB_USERNAME", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: datasource.UsernameSecret}}
+	}
+
+	overrides := map[string]interface{}{
+		"apiVersion": "v1",
+		"spec": corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:      podName,
+				Image:     image,
+				Command:   []string{"sh", "-c", command},
+				Stdin:     interactive,
+				StdinOnce: interactive,
+				Env: []corev1.EnvVar{
+					usernameEnv,
+					{Name: passwordEnv, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: datasource.PasswordSecret}},
+				},
+			}},
+		},
+	}
+	overridesJson, err := json.Marshal(overrides)
+	if err != nil {
+		return "", "", err
+	}
+
+	return image, string(overridesJson), nil
+}
+
+// getMountedClaims returns the names of the persistent volume claims mounted by the deployments
+func getMountedClaims(deployments []appsv1.Deployment) map[string]bool {
+	claims := map[string]bool{}
+	for _, deployment := range deployments {
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				claims[volume.PersistentVolumeClaim.ClaimName] = true
+			}
+		}
+	}
+	return claims
+}
+
+// ReadBackupManifest reads the manifest stored in the backup directory
+func ReadBackupManifest(directory string) (*BackupManifest, error) {
+	fileName := filepath.Join(directory, backupManifestFileName)
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backup manifest %s. %s", fileName, err.Error())
+	}
+
+	manifest := BackupManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse backup manifest %s. %s", fileName, err.Error())
+	}
+
+	return &manifest, nil
+}
+
+func writeBackupManifest(manifest *BackupManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(manifest.Directory, backupManifestFileName), content, 0600)
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// sanitizeName converts the value to a valid Kubernetes resource name
+func sanitizeName(value string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.ReplaceAll(value, "_", "-")), "-")
+	return truncateName(strings.Trim(name, "-"))
+}
+
+func truncateName(name string) string {
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	backupmode "upgrade-cli/flag/backup_mode"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Restore restores the backup described by the manifest.
+// Datasource dumps are loaded in the original databases. Persistent volume claims are recreated from the
+// VolumeSnapshots, scaling down the deployments that mount them during the operation. The Entando operators are
+// scaled down too, so that they don't scale the deployments up again before the claims are recreated.
+func Restore(manifest *BackupManifest) error {
+	if manifest.Mode == backupmode.Snapshot {
+		return restoreVolumes(manifest)
+	}
+	return restoreDatasources(manifest)
+}
+
+func restoreDatasources(manifest *BackupManifest) error {
+	for i, datasourceBackup := range manifest.Datasources {
+		datasource := datasourceBackup.Datasource
+		fmt.Fprintf(os.Stderr, "Restoring datasource %s (%s database %s)\n", datasource.Name, datasource.Engine, datasource.Database)
+
+		file, err := os.Open(datasourceBackup.File)
+		if err != nil {
+			return fmt.Errorf("unable to open dump of datasource %s. %s", datasource.Name, err.Error())
+		}
+
+		podName := fmt.Sprintf("entando-restore-%s-%d", manifest.ID, i)
+		_, err = runDatasourceClient(podName, datasource, getRestoreCommand(datasource), file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("unable to restore datasource %s: %s", datasource.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+func restoreVolumes(manifest *BackupManifest) error {
+	deployments, err := GetDeployments()
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Volumes) > 0 {
+		resumeOperators, err := pauseOperators(deployments)
+		if err != nil {
+			return err
+		}
+		defer resumeOperators()
+	}
+
+	for _, volume := range manifest.Volumes {
+		fmt.Fprintf(os.Stderr, "Restoring %s from %s %s\n", volume.PVC, volumeSnapshotKind, volume.Snapshot)
+
+		users := getClaimUsers(deployments, volume.PVC)
+		for _, deployment := range users {
+			if err := scaleDeployment(deployment, 0); err != nil {
+				return err
+			}
+		}
+
+		if _, err := runKubectl("delete", "persistentvolumeclaim", volume.PVC, "--ignore-not-found", "--wait=true"); err != nil {
+			return err
+		}
+
+		apiGroup := volumeSnapshotApiGroup
+		spec := volume.Spec
+		spec.VolumeName = ""
+		spec.DataSourceRef = nil
+		spec.DataSource = &corev1.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     volumeSnapshotKind,
+			Name:     volume.Snapshot,
+		}
+		pvc := corev1.PersistentVolumeClaim{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: metav1.ObjectMeta{Name: volume.PVC},
+			Spec:       spec,
+		}
+		if err := applyObject(&pvc); err != nil {
+			return fmt.Errorf("unable to recreate %s: %s", volume.PVC, err.Error())
+		}
+
+		for _, deployment := range users {
+			if err := scaleDeployment(deployment, getRestoredReplicas(deployment)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pauseOperators scales down the Entando operators deployed in the namespace and returns a function scaling them up
+// again. Failures of the scale up are only reported, so that they don't hide the result of the restore.
+func pauseOperators(deployments []appsv1.Deployment) (func(), error) {
+	var operators []appsv1.Deployment
+	for _, deployment := range deployments {
+		if deployment.Name == EntandoOperatorName || deployment.Name == UpgradeOperatorName {
+			operators = append(operators, deployment)
+		}
+	}
+
+	resume := func(paused []appsv1.Deployment) {
+		for _, operator := range paused {
+			if err := scaleDeployment(operator, getRestoredReplicas(operator)); err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: %s\n", err.Error())
+			}
+		}
+	}
+
+	for i, operator := range operators {
+		if err := scaleDeployment(operator, 0); err != nil {
+			resume(operators[:i])
+			return nil, err
+		}
+	}
+
+	return func() { resume(operators) }, nil
+}
+
+// getRestoredReplicas returns the number of replicas the deployment had before being scaled down, at least 1
+func getRestoredReplicas(deployment appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas > 0 {
+		return *deployment.Spec.Replicas
+	}
+	return 1
+}
+
+// getClaimUsers returns the deployments that mount the given persistent volume claim
+func getClaimUsers(deployments []appsv1.Deployment, claim string) []appsv1.Deployment {
+	users := []appsv1.Deployment{}
+	for _, deployment := range deployments {
+		if getMountedClaims([]appsv1.Deployment{deployment})[claim] {
+			users = append(users, deployment)
+		}
+	}
+	return users
+}
+
+// scaleDeployment sets the number of replicas of the deployment. When scaling to zero it waits for the pods deletion.
+func scaleDeployment(deployment appsv1.Deployment, replicas int32) error {
+	if _, err := runKubectl("scale", "deployment", deployment.Name, fmt.Sprintf("--replicas=%d", replicas)); err != nil {
+		return fmt.Errorf("unable to scale deployment %s: %s", deployment.Name, err.Error())
+	}
+
+	if replicas == 0 && deployment.Spec.Selector != nil && len(deployment.Spec.Selector.MatchLabels) > 0 {
+		var selector []string
+		for key, value := range deployment.Spec.Selector.MatchLabels {
+			selector = append(selector, key+"="+value)
+		}
+		_, err := runKubectl("wait", "--for=delete", "pod", "-l", strings.Join(selector, ","), "--timeout=5m")
+		if err != nil && !strings.Contains(err.Error(), "no matching resources") {
+			return fmt.Errorf("pods of deployment %s not terminated: %s", deployment.Name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"upgrade-cli/util/sys/spawn"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFindDatasources(t *testing.T) {
+
+	deApp := mkDeployment("my-app-deployment",
+		corev1.EnvVar{Name: "PORTDB_URL", Value: "jdbc:postgresql://default-postgresql-dbms-in-namespace-service.entando.svc.cluster.local:5432/default_postgresql_dbms_in_namespace_db"},
+		secretEnv("PORTDB_USERNAME", "my-app-portdb-secret", "username"),
+		secretEnv("PORTDB_PASSWORD", "my-app-portdb-secret", "password"),
+		corev1.EnvVar{Name: "SERVDB_URL", Value: "jdbc:postgresql://default-postgresql-dbms-in-namespace-service.entando.svc.cluster.local/default_postgresql_dbms_in_namespace_db?currentSchema=serv"},
+		secretEnv("SERVDB_USERNAME", "my-app-servdb-secret", "username"),
+		secretEnv("SERVDB_PASSWORD", "my-app-servdb-secret", "password"),
+	)
+	keycloak := mkDeployment("default-sso-in-namespace-deployment",
+		corev1.EnvVar{Name: "DB_VENDOR", Value: "mysql"},
+		corev1.EnvVar{Name: "DB_ADDR", Value: "mysql.entando.svc"},
+		corev1.EnvVar{Name: "DB_DATABASE", Value: "keycloak"},
+		corev1.EnvVar{Name: "DB_USER", Value: "keycloak"},
+		secretEnv("DB_PASSWORD", "keycloak-db-secret", "password"),
+	)
+	h2 := mkDeployment("my-app-cm-deployment",
+		corev1.EnvVar{Name: "SPRING_DATASOURCE_URL", Value: "jdbc:h2:file:/entando-data/databases/cm"},
+	)
+
+	datasources, err := FindDatasources([]appsv1.Deployment{deApp, keycloak, h2})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the SERVDB datasource points to the same database of PORTDB, but uses a different schema and user
+	if len(datasources) != 3 {
+		t.Fatalf("expected 3 datasources, found %+v", datasources)
+	}
+
+	portDb := datasources[0]
+	if portDb.Name != "my-app-deployment-portdb" || portDb.Engine != postgresqlEngine || portDb.Port != "5432" ||
+		portDb.Database != "default_postgresql_dbms_in_namespace_db" || portDb.UsernameSecret.Name != "my-app-portdb-secret" {
+		t.Fatalf("unexpected datasource %+v", portDb)
+	}
+
+	servDb := datasources[1]
+	if servDb.Name != "my-app-deployment-servdb" || servDb.Port != "5432" || servDb.Schema != "serv" ||
+		servDb.UsernameSecret.Name != "my-app-servdb-secret" {
+		t.Fatalf("unexpected datasource %+v", servDb)
+	}
+	if dumpCommand := getDumpCommand(servDb); !strings.Contains(dumpCommand, "-n 'serv'") {
+		t.Fatalf("unexpected dump command %s", dumpCommand)
+	}
+
+	keycloakDb := datasources[2]
+	if keycloakDb.Engine != mysqlEngine || keycloakDb.Port != "3306" || keycloakDb.Username != "keycloak" ||
+		keycloakDb.PasswordSecret.Name != "keycloak-db-secret" {
+		t.Fatalf("unexpected datasource %+v", keycloakDb)
+	}
+}
+
+func TestFindDatasourcesPlainPassword(t *testing.T) {
+
+	deployment := mkDeployment("my-app-deployment",
+		corev1.EnvVar{Name: "PORTDB_URL", Value: "jdbc:postgresql://postgresql:5432/entando"},
+		corev1.EnvVar{Name: "PORTDB_USERNAME", Value: "entando"},
+		corev1.EnvVar{Name: "PORTDB_PASSWORD", Value: "entando"},
+	)
+
+	_, err := FindDatasources([]appsv1.Deployment{deployment})
+	if err == nil || !strings.Contains(err.Error(), "the password must be read from a secret") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDumpCommand(t *testing.T) {
+
+	datasource := Datasource{Engine: postgresqlEngine, Host: "postgresql", Port: "5432", Database: "entando's"}
+	expected := `pg_dump --clean --if-exists --no-owner --no-privileges -h 'postgresql' -p '5432' -U "$DB_USERNAME" 'entando'\''s'`
+	if command := getDumpCommand(datasource); command != expected {
+		t.Fatalf("expected %s, found %s", expected, command)
+	}
+}
+
+func TestDumpDatasource(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+
+	datasource := Datasource{Name: "my-app-deployment-portdb", Engine: postgresqlEngine, Host: "postgresql", Port: "5432", Database: "entando"}
+	dump := "CREATE TABLE test (id integer);\n\n--\n-- PostgreSQL database dump complete\n--\n\n"
+	fileName := filepath.Join(t.TempDir(), "portdb.sql")
+
+	checkDump := func(copiedDump string, expectedError string) []spawn.Command {
+		fake, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+			args := strings.Join(cmd.RawArgs(), " ")
+			if strings.Contains(args, "exec") && strings.Contains(args, "sha256sum") {
+				sum := sha256.Sum256([]byte(dump))
+				return spawn.Res{Stdout: hex.EncodeToString(sum[:]) + "  " + dumpPodFile + "\n"}, nil
+			}
+			if strings.Contains(args, "exec") {
+				return spawn.Res{Stdout: copiedDump}, nil
+			}
+			return spawn.Res{}, nil
+		})
+		defer restore()
+
+		err := dumpDatasource("entando-backup-1-0", datasource, fileName)
+		if expectedError == "" && err != nil {
+			t.Fatalf(err.Error())
+		}
+		if expectedError != "" && (err == nil || !strings.Contains(err.Error(), expectedError)) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return fake.Commands
+	}
+
+	commands := checkDump(dump, "")
+	if content, _ := os.ReadFile(fileName); string(content) != dump {
+		t.Fatalf("unexpected dump file content %s", string(content))
+	}
+	if lastCommand := strings.Join(commands[len(commands)-1].RawArgs(), " "); !strings.Contains(lastCommand, "delete pod entando-backup-1-0") {
+		t.Fatalf("the client pod was not deleted, last command: %s", lastCommand)
+	}
+
+	os.Remove(fileName)
+	checkDump(dump[:20], "doesn't match the checksum")
+	if _, err := os.Stat(fileName); err == nil {
+		t.Fatalf("a truncated dump was written")
+	}
+}
+
+func TestCheckDumpTrailer(t *testing.T) {
+
+	mysql := Datasource{Engine: mysqlEngine}
+	if err := checkDumpTrailer(mysql, "INSERT INTO test VALUES (1);\n-- Dump completed on 2022-12-01 12:00:00\n"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := checkDumpTrailer(mysql, "INSERT INTO test VALUES (1);\n"); err == nil || !strings.Contains(err.Error(), "the dump is incomplete") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the trailer of another engine is not accepted
+	if err := checkDumpTrailer(Datasource{Engine: postgresqlEngine}, "-- Dump completed on 2022-12-01 12:00:00\n"); err == nil {
+		t.Fatalf("an error was expected for the MySQL trailer in a PostgreSQL dump")
+	}
+}
+
+func mkDeployment(name string, env ...corev1.EnvVar) appsv1.Deployment {
+	deployment := appsv1.Deployment{}
+	deployment.Name = name
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "main", Env: env}}
+	return deployment
+}
+
+func secretEnv(name, secret, key string) corev1.EnvVar {
+	return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secret}, Key: key},
+	}}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"upgrade-cli/util/images"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	RolloutNotFound = "not found"
+	RolloutPending  = "pending"
+	RolloutUpdating = "updating"
+	RolloutStarting = "starting"
+	RolloutComplete = "complete"
+)
+
+// ComponentStatus contains the rollout state of the deployment running an Entando component
+type ComponentStatus struct {
+	Component  string
+	Deployment string
+	Image      string
+	Rollout    string
+	Desired    int32
+	Updated    int32
+	Ready      int32
+	Restarts   int32
+	// reasons of the containers waiting to start (e.g. CrashLoopBackOff), with their messages
+	Waiting []ContainerWaiting
+}
+
+// ContainerWaiting describes a container of a component pod that is waiting to start
+type ContainerWaiting struct {
+	Pod     string
+	Reason  string
+	Message string
+}
+
+// String returns a single line description of the component status
+func (s ComponentStatus) String() string {
+	if s.Rollout == RolloutNotFound {
+		return fmt.Sprintf("%s: deployment not found", s.Component)
+	}
+	return fmt.Sprintf("%s: %s (%d/%d updated, %d/%d ready, %d restarts)",
+		s.Component, s.Rollout, s.Updated, s.Desired, s.Ready, s.Desired, s.Restarts)
+}
+
+// GetComponentsStatus retrieves the deployments and the pods of the namespace and returns the state of each Entando component
+func GetComponentsStatus(entandoApp *images.EntandoApp) ([]ComponentStatus, error) {
+	deployments, err := GetDeployments()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := GetPods()
+	if err != nil {
+		return nil, err
+	}
+	return ComputeComponentsStatus(entandoApp, deployments, pods), nil
+}
+
+// ComputeComponentsStatus correlates the Entando components with the deployments managed by the operator.
+// A deployment belongs to a component when one of its containers uses one of the component default repositories
+// or the repository of the image override set in the EntandoAppV2.
+func ComputeComponentsStatus(entandoApp *images.EntandoApp, deployments []appsv1.Deployment, pods []corev1.Pod) []ComponentStatus {
+	statuses := []ComponentStatus{}
+
+	for _, imageInfo := range images.EntandoImages {
+		repos := imageInfo.GetDefaultRepos()
+		if entandoApp != nil {
+			if imageOverride := imageInfo.GetImageOverride(entandoApp); imageOverride != nil && *imageOverride != "" {
+				repos = append(repos, images.ExtractRepo(*imageOverride))
+			}
+		}
+
+		status := ComponentStatus{Component: imageInfo.ComponentName, Rollout: RolloutNotFound}
+
+		if deployment, image := findComponentDeployment(deployments, repos); deployment != nil {
+			status.Deployment = deployment.Name
+			status.Image = image
+			setRolloutStatus(&status, deployment, pods)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func findComponentDeployment(deployments []appsv1.Deployment, repos []string) (*appsv1.Deployment, string) {
+	for i, deployment := range deployments {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			containerRepo := images.ExtractRepo(container.Image)
+			for _, repo := range repos {
+				if repo != "" && containerRepo == repo {
+					return &deployments[i], container.Image
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+func setRolloutStatus(status *ComponentStatus, deployment *appsv1.Deployment, pods []corev1.Pod) {
+	status.Desired = 1
+	if deployment.Spec.Replicas != nil {
+		status.Desired = *deployment.Spec.Replicas
+	}
+	status.Updated = deployment.Status.UpdatedReplicas
+
+	for _, pod := range GetDeploymentPods(deployment, pods) {
+		if IsPodReady(pod) {
+			status.Ready++
+		}
+		// the pods of the old revision are being replaced, so their waiting containers are not relevant
+		updated := isUpdatedRevisionPod(deployment, pod)
+		for _, containerStatuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+			for _, containerStatus := range containerStatuses {
+				status.Restarts += containerStatus.RestartCount
+				if waiting := containerStatus.State.Waiting; updated && waiting != nil && waiting.Reason != "" {
+					status.Waiting = append(status.Waiting, ContainerWaiting{Pod: pod.Name, Reason: waiting.Reason, Message: waiting.Message})
+				}
+			}
+		}
+	}
+
+	switch {
+	case deployment.Status.ObservedGeneration < deployment.Generation:
+		status.Rollout = RolloutPending
+	case deployment.Status.UpdatedReplicas < status.Desired || deployment.Status.Replicas > status.Desired:
+		status.Rollout = RolloutUpdating
+	case deployment.Status.AvailableReplicas < status.Desired:
+		status.Rollout = RolloutStarting
+	default:
+		status.Rollout = RolloutComplete
+	}
+}
+
+// isUpdatedRevisionPod returns true if the containers of the pod run the images of the deployment template.
+// Since the upgrade changes the images, pods running different images belong to an old revision.
+func isUpdatedRevisionPod(deployment *appsv1.Deployment, pod corev1.Pod) bool {
+	templateImages := map[string]string{}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		templateImages[container.Name] = container.Image
+	}
+	for _, container := range pod.Spec.Containers {
+		if image, ok := templateImages[container.Name]; ok && image != container.Image {
+			return false
+		}
+	}
+	return true
+}
+
+// GetDeploymentPods returns the pods matching the deployment selector
+func GetDeploymentPods(deployment *appsv1.Deployment, pods []corev1.Pod) []corev1.Pod {
+	deploymentPods := []corev1.Pod{}
+	if deployment.Spec.Selector == nil || len(deployment.Spec.Selector.MatchLabels) == 0 {
+		return deploymentPods
+	}
+	for _, pod := range pods {
+		matches := true
+		for key, value := range deployment.Spec.Selector.MatchLabels {
+			if pod.Labels[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			deploymentPods = append(deploymentPods, pod)
+		}
+	}
+	return deploymentPods
+}
+
+// IsPodReady returns true if the pod Ready condition is true
+func IsPodReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"upgrade-cli/util/images"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestComputeComponentsStatus(t *testing.T) {
+
+	deApp := mkComponentDeployment("my-app-deployment", "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1", 2)
+	deApp.Generation = 2
+	deApp.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1}
+
+	appBuilder := mkComponentDeployment("my-app-ab-deployment", "my-registry.com/custom/my-app-builder:7.1.1", 1)
+	appBuilder.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+
+	pods := []corev1.Pod{
+		mkPod("my-app-deployment", true, 0),
+		mkPod("my-app-deployment", false, 3),
+		mkPod("other-deployment", true, 5),
+	}
+
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoApp.Spec.AppBuilder.ImageOverride = "my-registry.com/custom/my-app-builder:7.1.1"
+
+	statuses := ComputeComponentsStatus(entandoApp, []appsv1.Deployment{deApp, appBuilder}, pods)
+
+	deAppStatus := statuses[0]
+	if deAppStatus.Component != "DeApp" || deAppStatus.Deployment != "my-app-deployment" || deAppStatus.Rollout != RolloutUpdating ||
+		deAppStatus.Ready != 1 || deAppStatus.Restarts != 3 || deAppStatus.Desired != 2 {
+		t.Fatalf("unexpected status %+v", deAppStatus)
+	}
+
+	expectedLine := "DeApp: updating (1/2 updated, 1/2 ready, 3 restarts)"
+	if deAppStatus.String() != expectedLine {
+		t.Fatalf("expected %s, found %s", expectedLine, deAppStatus.String())
+	}
+
+	appBuilderStatus := statuses[1]
+	if appBuilderStatus.Deployment != "my-app-ab-deployment" || appBuilderStatus.Rollout != RolloutComplete {
+		t.Fatalf("unexpected status %+v", appBuilderStatus)
+	}
+
+	if statuses[2].Rollout != RolloutNotFound || statuses[2].String() != "ComponentManager: deployment not found" {
+		t.Fatalf("unexpected status %+v", statuses[2])
+	}
+}
+
+func TestComputeComponentsStatusIgnoresOldRevisionPods(t *testing.T) {
+
+	deApp := mkComponentDeployment("my-app-deployment", "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1", 1)
+
+	oldPod := mkPod("my-app-deployment", false, 0)
+	oldPod.Spec.Containers = []corev1.Container{{Name: "main", Image: "registry.hub.docker.com/entando/entando-de-app-eap:7.1.0"}}
+	oldPod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CreateContainerConfigError"}
+	newPod := mkPod("my-app-deployment", false, 0)
+	newPod.Spec.Containers = []corev1.Container{{Name: "main", Image: "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1"}}
+	newPod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}
+
+	statuses := ComputeComponentsStatus(nil, []appsv1.Deployment{deApp}, []corev1.Pod{oldPod, newPod})
+
+	if waiting := statuses[0].Waiting; len(waiting) != 1 || waiting[0].Reason != "ContainerCreating" {
+		t.Fatalf("unexpected waiting containers %+v", waiting)
+	}
+}
+
+func mkComponentDeployment(name, image string, replicas int32) appsv1.Deployment {
+	deployment := appsv1.Deployment{}
+	deployment.Name = name
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"deployment": name}}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "main", Image: image}}
+	return deployment
+}
+
+func mkPod(deployment string, ready bool, restarts int32) corev1.Pod {
+	readyStatus := corev1.ConditionFalse
+	if ready {
+		readyStatus = corev1.ConditionTrue
+	}
+	pod := corev1.Pod{}
+	pod.Labels = map[string]string{"deployment": deployment}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: readyStatus}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "main", RestartCount: restarts}}
+	return pod
+}
@@ -7,9 +7,15 @@ import (
 	"os"
 	"regexp"
 	"upgrade-cli/common"
+	"upgrade-cli/util/images"
 
 	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -22,25 +28,28 @@ const (
 // GenerateCustomResource writes the CR in YAML format to the specified file or to the stdout if the filename is an empty string
 // If the needsFix boolean flag is set to true a comment is added to the output to inform the user that some placeholders
 // need to be replaced. Moreover the YAML syntax is broken to avoid accidental applies before human intervention.
-func GenerateCustomResource(fileName string, entandoAppV2 *v1alpha1.EntandoAppV2, needsFix bool) error {
+func GenerateCustomResource(fileName string, entandoAppV2 *images.EntandoApp, needsFix bool) error {
 
 	entandoAppV2.APIVersion = apiVersion
 	entandoAppV2.Kind = common.EntandoAppResourceName
 	entandoAppV2.Name = defaultResourceName
 
-	// set entandoAppName
-	entandoAppName := os.Getenv(EntandoAppNameEnv)
-	if entandoAppName == "" {
-		return fmt.Errorf("the environment variable %s must be set", EntandoAppNameEnv)
+	// values already set, e.g. by the migration of the legacy EntandoApp, are kept
+	if entandoAppV2.Spec.EntandoAppName == "" || entandoAppV2.Spec.IngressHostName == "" {
+		settings := GetAppSettings()
+		if entandoAppV2.Spec.EntandoAppName == "" {
+			entandoAppV2.Spec.EntandoAppName = settings.AppName
+		}
+		if entandoAppV2.Spec.IngressHostName == "" {
+			entandoAppV2.Spec.IngressHostName = settings.IngressHostName
+		}
 	}
-	entandoAppV2.Spec.EntandoAppName = entandoAppName
-
-	// set ingressHostName
-	ingressHostName := os.Getenv(EntandoIngressHostNameEnv)
-	if ingressHostName == "" {
-		return fmt.Errorf("the environment variable %s must be set", EntandoIngressHostNameEnv)
+	if entandoAppV2.Spec.EntandoAppName == "" {
+		return fmt.Errorf("unable to determine the app name: the environment variable %s must be set", EntandoAppNameEnv)
+	}
+	if entandoAppV2.Spec.IngressHostName == "" {
+		return fmt.Errorf("unable to determine the ingress host name: the environment variable %s must be set", EntandoIngressHostNameEnv)
 	}
-	entandoAppV2.Spec.IngressHostName = ingressHostName
 
 	yamlPrinter := printers.YAMLPrinter{}
 
@@ -59,9 +68,14 @@ func GenerateCustomResource(fileName string, entandoAppV2 *v1alpha1.EntandoAppV2
 
 	writer.Write([]byte("---\n"))
 
+	obj, err := mergeExtraOverrides(entandoAppV2)
+	if err != nil {
+		return fmt.Errorf("unable to generate EntandoAppV2 manifest. %s", err.Error())
+	}
+
 	// write data to a buffer to be able to modify the result before writing it to the writer
 	var buffer bytes.Buffer
-	err := yamlPrinter.PrintObj(entandoAppV2, &buffer)
+	err = yamlPrinter.PrintObj(obj, &buffer)
 
 	if err != nil {
 		return fmt.Errorf("unable to generate EntandoAppV2 manifest. %s", err.Error())
@@ -76,6 +90,60 @@ func GenerateCustomResource(fileName string, entandoAppV2 *v1alpha1.EntandoAppV2
 	return nil
 }
 
+// ReadCustomResource parses the EntandoAppV2 CR contained in the specified YAML file
+func ReadCustomResource(fileName string) (*images.EntandoApp, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s. %s", fileName, err.Error())
+	}
+
+	s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
+
+	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	_, _, err = s.Decode(content, nil, &entandoAppV2)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse file %s. %s", fileName, err.Error())
+	}
+
+	entandoApp := images.NewEntandoApp(&entandoAppV2)
+	if err := loadExtraOverrides(entandoApp, content); err != nil {
+		return nil, fmt.Errorf("unable to parse file %s. %s", fileName, err.Error())
+	}
+
+	return entandoApp, nil
+}
+
+// mergeExtraOverrides returns the resource to print, adding the image overrides of the registered components
+// whose fields are not part of the EntandoAppV2 API
+func mergeExtraOverrides(entandoApp *images.EntandoApp) (runtime.Object, error) {
+	extraOverrides := images.GetExtraOverrides(entandoApp)
+	if len(extraOverrides) == 0 {
+		return entandoApp.EntandoAppV2, nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(entandoApp.EntandoAppV2)
+	if err != nil {
+		return nil, err
+	}
+	for _, extraOverride := range extraOverrides {
+		if err := unstructured.SetNestedField(content, extraOverride.Value, extraOverride.Keys...); err != nil {
+			return nil, err
+		}
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// loadExtraOverrides reads from the YAML content the image overrides of the registered components
+// whose fields are not part of the EntandoAppV2 API
+func loadExtraOverrides(entandoApp *images.EntandoApp, content []byte) error {
+	genericContent := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &genericContent); err != nil {
+		return err
+	}
+	images.LoadExtraOverrides(entandoApp, genericContent)
+	return nil
+}
+
 // breakSyntax removes the quotes around the error placeholders to break YAML syntax, in order to prevent accidental editing
 func breakSyntax(bytes []byte) []byte {
 	stringValue := string(bytes)
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"strings"
+	"upgrade-cli/util/images"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CurrentImage is the image running an Entando component in the cluster
+type CurrentImage struct {
+	Component  string
+	Deployment string
+	// image as set in the deployment
+	Image string
+	// digest of the image run by the deployment pods, empty if the pods are not running
+	Digest string
+	// true if the pods of the deployment run different digests, e.g. during a rollout.
+	// In this case Digest is the one run by the ready pods of the updated revision, if any.
+	MixedDigests bool
+}
+
+// Reference returns the image pinned to the running digest, or the deployment image if the digest is not known
+func (c CurrentImage) Reference() string {
+	if c.Digest == "" {
+		return c.Image
+	}
+	imageRef, err := images.ParseImage(c.Image)
+	if err != nil {
+		return c.Image
+	}
+	return imageRef.Name() + "@" + c.Digest
+}
+
+// GetCurrentImages retrieves the deployments and the pods of the namespace and returns the images running the Entando components
+func GetCurrentImages() ([]CurrentImage, error) {
+	deployments, err := GetDeployments()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := GetPods()
+	if err != nil {
+		return nil, err
+	}
+	return ComputeCurrentImages(deployments, pods), nil
+}
+
+// ComputeCurrentImages returns the images of the deployments running the Entando components, resolving the digests
+// from the status of their pods. Components without deployment are not included.
+func ComputeCurrentImages(deployments []appsv1.Deployment, pods []corev1.Pod) []CurrentImage {
+	currentImages := []CurrentImage{}
+
+	for _, imageInfo := range images.EntandoImages {
+		deployment, image := findComponentDeployment(deployments, imageInfo.GetDefaultRepos())
+		if deployment == nil {
+			continue
+		}
+
+		currentImage := CurrentImage{Component: imageInfo.ComponentName, Deployment: deployment.Name, Image: image}
+		containerName := getContainerName(deployment, image)
+		// the digest of a ready pod of the updated revision is preferred, followed by an updated pod and by a ready pod
+		bestPriority := -1
+		for _, pod := range GetDeploymentPods(deployment, pods) {
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				if containerStatus.Name != containerName {
+					continue
+				}
+				digest := extractImageIdDigest(containerStatus.ImageID)
+				if digest == "" {
+					continue
+				}
+				if currentImage.Digest != "" && currentImage.Digest != digest {
+					currentImage.MixedDigests = true
+				}
+				if priority := getDigestPriority(deployment, pod); priority > bestPriority {
+					currentImage.Digest = digest
+					bestPriority = priority
+				}
+			}
+		}
+
+		currentImages = append(currentImages, currentImage)
+	}
+
+	return currentImages
+}
+
+// CurrentImagesOverrides returns the current images in the format of the images file, indexed by component name
+func CurrentImagesOverrides(currentImages []CurrentImage) map[string]string {
+	overrides := map[string]string{}
+	for _, currentImage := range currentImages {
+		overrides[currentImage.Component] = currentImage.Reference()
+	}
+	return overrides
+}
+
+func getDigestPriority(deployment *appsv1.Deployment, pod corev1.Pod) int {
+	priority := 0
+	if isUpdatedRevisionPod(deployment, pod) {
+		priority += 2
+	}
+	if IsPodReady(pod) {
+		priority++
+	}
+	return priority
+}
+
+func getContainerName(deployment *appsv1.Deployment, image string) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Image == image {
+			return container.Name
+		}
+	}
+	return ""
+}
+
+// extractImageIdDigest returns the digest of the container imageID, e.g. docker-pullable://entando/app-builder@sha256:...
+// It returns an empty string if the imageID doesn't contain a repository digest.
+func extractImageIdDigest(imageID string) string {
+	index := strings.LastIndex(imageID, "@")
+	if index == -1 {
+		return ""
+	}
+	return imageID[index+1:]
+}
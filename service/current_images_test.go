@@ -0,0 +1,46 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestComputeCurrentImages(t *testing.T) {
+
+	deApp := mkComponentDeployment("my-app-deployment", "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1", 1)
+	appBuilder := mkComponentDeployment("my-app-ab-deployment", "entando/app-builder:7.1.1", 2)
+
+	deAppPod := mkPod("my-app-deployment", true, 0)
+	deAppPod.Status.ContainerStatuses[0].ImageID = "docker-pullable://registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f"
+	appBuilderPod1 := mkPod("my-app-ab-deployment", true, 0)
+	appBuilderPod1.Status.ContainerStatuses[0].ImageID = "docker.io/entando/app-builder@sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	appBuilderPod2 := mkPod("my-app-ab-deployment", false, 0)
+	appBuilderPod2.Status.ContainerStatuses[0].ImageID = "docker.io/entando/app-builder@sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	appBuilderPod3 := mkPod("my-app-ab-deployment", true, 0)
+	appBuilderPod3.Spec.Containers = []corev1.Container{{Name: "main", Image: "entando/app-builder:7.1.0"}}
+	appBuilderPod3.Status.ContainerStatuses[0].ImageID = "docker.io/entando/app-builder@sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	keycloak := mkComponentDeployment("my-app-sso", "registry.hub.docker.com/entando/entando-keycloak:7.1.1", 1)
+
+	currentImages := ComputeCurrentImages([]appsv1.Deployment{deApp, appBuilder, keycloak},
+		[]corev1.Pod{deAppPod, appBuilderPod1, appBuilderPod2, appBuilderPod3})
+
+	if len(currentImages) != 3 {
+		t.Fatalf("unexpected current images %+v", currentImages)
+	}
+	if currentImages[1].MixedDigests != true || currentImages[0].MixedDigests != false {
+		t.Fatalf("unexpected mixed digests %+v", currentImages)
+	}
+
+	// the digest of the ready pod of the updated revision is used, not the one of the last pod or of the old revision
+	expected := map[string]string{
+		"DeApp":      "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f",
+		"AppBuilder": "entando/app-builder@sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"Keycloak":   "registry.hub.docker.com/entando/entando-keycloak:7.1.1",
+	}
+	if overrides := CurrentImagesOverrides(currentImages); !reflect.DeepEqual(overrides, expected) {
+		t.Fatalf("unexpected overrides %v", overrides)
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"upgrade-cli/common"
+)
+
+const (
+	diagnosticsPrefix  = "entando-diagnostics-"
+	diagnosticsLogTail = "--tail=2000"
+	redactedValue      = "***REDACTED***"
+)
+
+// DiagnosticsOptions contains the parameters used to collect the diagnostics bundle
+type DiagnosticsOptions struct {
+	// directory where the archive is created
+	Directory string
+	// optional path of the generated CR file, that is included in the bundle
+	CRFile string
+}
+
+// diagnosticsBundle contains the collected files, indexed by their path inside the archive
+type diagnosticsBundle struct {
+	names  []string
+	files  map[string][]byte
+	errors []string
+}
+
+func (b *diagnosticsBundle) add(name string, content []byte) {
+	if _, ok := b.files[name]; !ok {
+		b.names = append(b.names, name)
+	}
+	b.files[name] = RedactSecrets(content)
+}
+
+// collect stores the output of the kubectl command, or the error that occurred, in the bundle
+func (b *diagnosticsBundle) collect(name string, kubectlArgs ...interface{}) {
+	stdout, err := runKubectl(kubectlArgs...)
+	if err != nil {
+		b.errors = append(b.errors, fmt.Sprintf("%s: %s", name, err.Error()))
+		return
+	}
+	b.add(name, []byte(stdout))
+}
+
+// CollectDiagnostics gathers the information useful to investigate a failed upgrade (EntandoAppV2 resource,
+// events, pods status, description and logs of Entando deployments and operators) and packages them in a
+// timestamped tar.gz archive. Values of sensitive fields are redacted. Returns the path of the archive.
+func CollectDiagnostics(options DiagnosticsOptions) (string, error) {
+	bundle := diagnosticsBundle{files: map[string][]byte{}}
+
+	bundle.collect("entandoappv2.yaml", "get", common.EntandoAppResourceName, "-o", "yaml")
+	bundle.collect("events.txt", "get", "events", "--sort-by=.lastTimestamp")
+	bundle.collect("pods.txt", "get", "pods", "-o", "wide")
+	bundle.collect("pods.yaml", "get", "pods", "-o", "yaml")
+	bundle.collect("deployments.txt", "get", "deployments", "-o", "wide")
+
+	if options.CRFile != "" {
+		content, err := os.ReadFile(options.CRFile)
+		if err != nil {
+			bundle.errors = append(bundle.errors, fmt.Sprintf("generated CR: %s", err.Error()))
+		} else {
+			bundle.add("generated-cr.yaml", content)
+		}
+	}
+
+	deployments, err := GetDeployments()
+	if err != nil {
+		bundle.errors = append(bundle.errors, fmt.Sprintf("deployments: %s", err.Error()))
+	}
+
+	entandoDeployments := map[string]bool{}
+	for _, component := range ComputeComponentsStatus(nil, deployments, nil) {
+		if component.Deployment != "" {
+			entandoDeployments[component.Deployment] = true
+		}
+	}
+
+	for _, deployment := range deployments {
+		isOperator := strings.Contains(deployment.Name, "operator")
+		if !isOperator && !entandoDeployments[deployment.Name] {
+			continue
+		}
+		bundle.collect("describe/"+deployment.Name+".txt", "describe", "deployment", deployment.Name)
+		bundle.collect("logs/"+deployment.Name+".log", "logs", "deployment/"+deployment.Name, "--all-containers", diagnosticsLogTail)
+	}
+
+	if len(bundle.errors) > 0 {
+		bundle.add("collection-errors.txt", []byte(strings.Join(bundle.errors, "\n")+"\n"))
+	}
+
+	return writeDiagnosticsArchive(&bundle, options.Directory)
+}
+
+func writeDiagnosticsArchive(bundle *diagnosticsBundle, directory string) (string, error) {
+	if directory == "" {
+		directory = "."
+	}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	baseName := diagnosticsPrefix + now.UTC().Format(upgradeRecordTimeFormat)
+	archiveName := filepath.Join(directory, baseName+".tar.gz")
+
+	file, err := os.OpenFile(archiveName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to create diagnostics archive %s. %s", archiveName, err.Error())
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, name := range bundle.names {
+		content := bundle.files[name]
+		header := &tar.Header{
+			Name:    baseName + "/" + name,
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: now,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+
+	return archiveName, nil
+}
+
+var (
+	sensitiveKey        = `(?:password|passwd|pwd|secret|token|apikey|api_key|credentials?|private_?key)`
+	sensitiveName       = regexp.MustCompile(`(?i)` + sensitiveKey)
+	sensitiveValueRe    = regexp.MustCompile(`(?i)(` + sensitiveKey + `[\w.-]*["']?\s*[:=]\s*)("[^"]*"|'[^']*'|\S+)`)
+	sensitiveEnvName    = regexp.MustCompile(`(?i)^\s*-?\s*name:\s*["']?[\w.-]*` + sensitiveKey + `[\w.-]*["']?\s*$`)
+	envValueLine        = regexp.MustCompile(`^(\s*value:\s*)(.+)$`)
+	secretRefInDescribe = regexp.MustCompile(`<set to the key`)
+)
+
+// RedactSecrets replaces the values of sensitive fields: key/value pairs whose key looks like a password,
+// a token or a secret, and the values of environment variables with such names in Kubernetes manifests
+func RedactSecrets(content []byte) []byte {
+	var builder strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	redactNextValue := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if redactNextValue {
+			if matches := envValueLine.FindStringSubmatch(line); matches != nil {
+				line = matches[1] + redactedValue
+			}
+			redactNextValue = false
+		}
+
+		if sensitiveEnvName.MatchString(line) {
+			redactNextValue = true
+		} else if !secretRefInDescribe.MatchString(line) {
+			line = sensitiveValueRe.ReplaceAllString(line, "${1}"+redactedValue)
+		}
+
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+
+	return []byte(builder.String())
+}
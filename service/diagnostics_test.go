@@ -0,0 +1,94 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+
+	content := `spec:
+  containers:
+  - env:
+    - name: PORTDB_URL
+      value: jdbc:postgresql://postgresql:5432/entando
+    - name: PORTDB_PASSWORD
+      value: s3cr3t
+    - name: SERVDB_PASSWORD
+      valueFrom:
+        secretKeyRef:
+          key: password
+          name: my-app-servdb-secret
+      PORTDB_PASSWORD:  <set to the key 'password' in secret 'my-app-portdb-secret'>  Optional: false
+      KEYCLOAK_CLIENT_SECRET:  plain-secret
+{"apiVersion":"v1","password":"s3cr3t","token": "abc"}
+`
+	expected := `spec:
+  containers:
+  - env:
+    - name: PORTDB_URL
+      value: jdbc:postgresql://postgresql:5432/entando
+    - name: PORTDB_PASSWORD
+      value: ***REDACTED***
+    - name: SERVDB_PASSWORD
+      valueFrom:
+        secretKeyRef:
+          key: password
+          name: my-app-servdb-secret
+      PORTDB_PASSWORD:  <set to the key 'password' in secret 'my-app-portdb-secret'>  Optional: false
+      KEYCLOAK_CLIENT_SECRET:  ***REDACTED***
+{"apiVersion":"v1","password":***REDACTED***,"token": ***REDACTED***}
+`
+
+	if redacted := string(RedactSecrets([]byte(content))); redacted != expected {
+		t.Fatalf("unexpected redacted content:\n%s", redacted)
+	}
+}
+
+func TestWriteDiagnosticsArchive(t *testing.T) {
+
+	bundle := diagnosticsBundle{files: map[string][]byte{}}
+	bundle.add("events.txt", []byte("no events"))
+	bundle.add("logs/entando-operator.log", []byte("password=admin"))
+
+	archiveName, err := writeDiagnosticsArchive(&bundle, t.TempDir())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	file, err := os.Open(archiveName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	entries := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		content, _ := io.ReadAll(tarReader)
+		entries[header.Name[strings.Index(header.Name, "/")+1:]] = string(content)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, found %v", entries)
+	}
+	if entries["logs/entando-operator.log"] != "password=***REDACTED***\n" {
+		t.Fatalf("unexpected log content %s", entries["logs/entando-operator.log"])
+	}
+}
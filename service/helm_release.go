@@ -0,0 +1,269 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"upgrade-cli/util/images"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	helmReleaseSecretType  = "helm.sh/release.v1"
+	helmReleaseSecretLabel = "owner=helm,status=deployed"
+	helmReleaseKey         = "release"
+	entandoChartPrefix     = "entando"
+
+	// keys used by the charts to set the ingress host name
+	helmIngressHostKey = "ingresshostname"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// HelmRelease contains the fields of a decoded Helm release used by the CLI
+type HelmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Revision  int    `json:"version"`
+	Info      struct {
+		Status string `json:"status"`
+	} `json:"info"`
+	Chart struct {
+		Metadata HelmChart `json:"metadata"`
+	} `json:"chart"`
+	// values set by the user when the release was installed or upgraded
+	Values map[string]interface{} `json:"config"`
+}
+
+// HelmChart contains the metadata of the chart of a release
+type HelmChart struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// HelmImageValue is an image of an Entando component set in the values of the release.
+// Path is the dot separated path of the value, or of the map containing repository and tag.
+type HelmImageValue struct {
+	Component string
+	Path      string
+	Image     string
+	// true if the image is set using separate repository and tag values
+	Split bool
+}
+
+// HelmValueDrift is a Helm value that doesn't match the EntandoAppV2
+type HelmValueDrift struct {
+	Path      string
+	Component string
+	HelmValue string
+	// value expected from the EntandoAppV2
+	Expected string
+	Split    bool
+}
+
+// GetHelmRelease finds the deployed Helm release of the Entando chart in the namespace. It returns nil if no release is found.
+func GetHelmRelease() (*HelmRelease, error) {
+	secrets := corev1.SecretList{}
+	if err := getResource(&secrets, "secrets", "-l", helmReleaseSecretLabel); err != nil {
+		return nil, err
+	}
+
+	releases := []*HelmRelease{}
+	for _, secret := range secrets.Items {
+		if secret.Type != helmReleaseSecretType {
+			continue
+		}
+		release, err := DecodeHelmRelease(secret.Data[helmReleaseKey])
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode Helm release secret %s: %s", secret.Name, err.Error())
+		}
+		releases = append(releases, release)
+	}
+
+	return FindEntandoRelease(releases), nil
+}
+
+// DecodeHelmRelease decodes the content of a Helm release secret, that is a base64 encoded and gzipped JSON
+func DecodeHelmRelease(data []byte) (*HelmRelease, error) {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(decoded, data)
+	if err != nil {
+		return nil, err
+	}
+	decoded = decoded[:n]
+
+	if bytes.HasPrefix(decoded, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(decoded))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if decoded, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	release := HelmRelease{}
+	if err := json.Unmarshal(decoded, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// FindEntandoRelease returns the latest revision of the release of an Entando chart, or nil
+func FindEntandoRelease(releases []*HelmRelease) *HelmRelease {
+	var found *HelmRelease
+	for _, release := range releases {
+		if !strings.HasPrefix(release.Chart.Metadata.Name, entandoChartPrefix) {
+			continue
+		}
+		if found == nil || release.Revision > found.Revision {
+			found = release
+		}
+	}
+	return found
+}
+
+// FindHelmImageValues walks the release values looking for images of the Entando components,
+// set as a single string or as a map with repository and tag
+func FindHelmImageValues(values map[string]interface{}) []HelmImageValue {
+	imageValues := []HelmImageValue{}
+	walkHelmValues(values, "", func(path string, value interface{}) bool {
+		image, split := getHelmImage(value)
+		if image == "" {
+			return false
+		}
+		repo := images.ExtractRepo(image)
+		for _, imageInfo := range images.EntandoImages {
+			for _, defaultRepo := range imageInfo.GetDefaultRepos() {
+				if repo == defaultRepo {
+					imageValues = append(imageValues, HelmImageValue{Component: imageInfo.ComponentName, Path: path, Image: image, Split: split})
+					return true
+				}
+			}
+		}
+		return split
+	})
+	sort.Slice(imageValues, func(i, j int) bool { return imageValues[i].Path < imageValues[j].Path })
+	return imageValues
+}
+
+// walkHelmValues calls visit for every value; maps are not visited further when visit returns true
+func walkHelmValues(value interface{}, path string, visit func(path string, value interface{}) bool) {
+	if path != "" && visit(path, value) {
+		return
+	}
+	if valuesMap, ok := value.(map[string]interface{}); ok {
+		for key, child := range valuesMap {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			walkHelmValues(child, childPath, visit)
+		}
+	}
+}
+
+// getHelmImage returns the image defined by a value and true if it is defined using repository and tag keys
+func getHelmImage(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case string:
+		if strings.Contains(typed, "/") && images.ExtractRepo(typed) != "" {
+			return typed, false
+		}
+	case map[string]interface{}:
+		repository, _ := typed["repository"].(string)
+		tag, _ := typed["tag"].(string)
+		if repository != "" {
+			if tag == "" {
+				return repository, true
+			}
+			return repository + ":" + tag, true
+		}
+	}
+	return "", false
+}
+
+// CheckHelmDrift compares the images and the ingress host name set in the release values with the EntandoAppV2
+func CheckHelmDrift(release *HelmRelease, entandoApp *images.EntandoApp) []HelmValueDrift {
+	drifts := []HelmValueDrift{}
+
+	for _, imageValue := range FindHelmImageValues(release.Values) {
+		var imageOverride string
+		for _, imageInfo := range images.EntandoImages {
+			if imageInfo.ComponentName == imageValue.Component {
+				imageOverride = *imageInfo.GetImageOverride(entandoApp)
+			}
+		}
+
+		// components without an explicit override use the default image of the version, which can't be compared
+		if imageOverride == "" {
+			continue
+		}
+
+		expected := imageOverride
+		if !strings.Contains(imageOverride, "/") {
+			// tag only override
+			expected = images.StripTagAndDigest(imageValue.Image) + ":" + imageOverride
+		}
+		if images.ExtractRepo(expected) != images.ExtractRepo(imageValue.Image) || images.ExtractTag(expected) != images.ExtractTag(imageValue.Image) {
+			drifts = append(drifts, HelmValueDrift{Path: imageValue.Path, Component: imageValue.Component,
+				HelmValue: imageValue.Image, Expected: expected, Split: imageValue.Split})
+		}
+	}
+
+	if entandoApp.Spec.IngressHostName != "" {
+		walkHelmValues(release.Values, "", func(path string, value interface{}) bool {
+			key := path[strings.LastIndex(path, ".")+1:]
+			if host, ok := value.(string); ok && strings.ToLower(key) == helmIngressHostKey && host != entandoApp.Spec.IngressHostName {
+				drifts = append(drifts, HelmValueDrift{Path: path, HelmValue: host, Expected: entandoApp.Spec.IngressHostName})
+			}
+			return false
+		})
+	}
+
+	return drifts
+}
+
+// String returns a single line description of the drift
+func (d HelmValueDrift) String() string {
+	subject := d.Path
+	if d.Component != "" {
+		subject = fmt.Sprintf("%s (%s)", d.Path, d.Component)
+	}
+	return fmt.Sprintf("%s is set to %s, while the EntandoAppV2 sets %s", subject, d.HelmValue, d.Expected)
+}
+
+// HelmValuesPatch builds the values that align the release with the EntandoAppV2
+func HelmValuesPatch(drifts []HelmValueDrift) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for _, drift := range drifts {
+		keys := strings.Split(drift.Path, ".")
+		parent := patch
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			parent = child
+		}
+		lastKey := keys[len(keys)-1]
+		if drift.Split {
+			parent[lastKey] = map[string]interface{}{
+				"repository": images.StripTagAndDigest(drift.Expected),
+				"tag":        images.ExtractTag(drift.Expected),
+			}
+		} else {
+			parent[lastKey] = drift.Expected
+		}
+	}
+	return patch
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"upgrade-cli/util/images"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+)
+
+const helmReleaseJson = `{
+  "name": "quickstart",
+  "namespace": "entando",
+  "version": 3,
+  "info": {"status": "deployed"},
+  "chart": {"metadata": {"name": "entando-quickstart", "version": "7.1.1", "appVersion": "7.1.1"}},
+  "config": {
+    "app": {"ingressHostName": "old.example.com"},
+    "appBuilder": {"image": {"repository": "entando/app-builder", "tag": "7.1.0"}},
+    "componentManager": {"image": "registry.hub.docker.com/entando/entando-component-manager:7.1.0"},
+    "keycloak": {"image": "entando/entando-keycloak:7.1.0"},
+    "other": {"image": "nginx:1.23"}
+  }
+}`
+
+func TestDecodeHelmRelease(t *testing.T) {
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(helmReleaseJson))
+	writer.Close()
+
+	release, err := DecodeHelmRelease([]byte(base64.StdEncoding.EncodeToString(compressed.Bytes())))
+	if err != nil {
+		t.Fatalf("unable to decode release: %s", err.Error())
+	}
+
+	if release.Name != "quickstart" || release.Revision != 3 || release.Chart.Metadata.Version != "7.1.1" {
+		t.Fatalf("unexpected release %+v", release)
+	}
+
+	imageValues := FindHelmImageValues(release.Values)
+	if len(imageValues) != 3 {
+		t.Fatalf("expected 3 image values, found %+v", imageValues)
+	}
+	if imageValues[0].Component != "AppBuilder" || imageValues[0].Path != "appBuilder.image" || !imageValues[0].Split {
+		t.Fatalf("unexpected image value %+v", imageValues[0])
+	}
+}
+
+func TestCheckHelmDrift(t *testing.T) {
+
+	release, err := DecodeHelmRelease([]byte(base64.StdEncoding.EncodeToString([]byte(helmReleaseJson))))
+	if err != nil {
+		t.Fatalf("unable to decode release: %s", err.Error())
+	}
+
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoApp.Spec.IngressHostName = "new.example.com"
+	entandoApp.Spec.AppBuilder.ImageOverride = "7.1.2"
+	entandoApp.Spec.ComponentManager.ImageOverride = "registry.hub.docker.com/entando/entando-component-manager:7.1.0"
+
+	drifts := CheckHelmDrift(release, entandoApp)
+	// Keycloak uses the default image in the EntandoAppV2, so its Helm value is not reported
+	if len(drifts) != 2 {
+		t.Fatalf("expected 2 drifts, found %+v", drifts)
+	}
+
+	expectedPatch := map[string]interface{}{
+		"app":        map[string]interface{}{"ingressHostName": "new.example.com"},
+		"appBuilder": map[string]interface{}{"image": map[string]interface{}{"repository": "entando/app-builder", "tag": "7.1.2"}},
+	}
+	if patch := HelmValuesPatch(drifts); !reflect.DeepEqual(patch, expectedPatch) {
+		t.Fatalf("unexpected patch %+v", patch)
+	}
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"upgrade-cli/util/sys/spawn"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+type HookPhase string
+
+const (
+	PreValidate HookPhase = "pre-validate"
+	PreApply    HookPhase = "pre-apply"
+	PostApply   HookPhase = "post-apply"
+	OnSuccess   HookPhase = "on-success"
+	OnFailure   HookPhase = "on-failure"
+)
+
+type HookFailurePolicy string
+
+const (
+	Abort HookFailurePolicy = "abort"
+	Warn  HookFailurePolicy = "warn"
+)
+
+const (
+	hookContextConfigMap = "entando-upgrade-hook-context"
+	defaultHookTimeout   = 10 * time.Minute
+
+	hookPhaseEnv          = "ENTANDO_UPGRADE_PHASE"
+	hookUpgradeIdEnv      = "ENTANDO_UPGRADE_ID"
+	hookAppNameEnv        = "ENTANDO_UPGRADE_APP_NAME"
+	hookSourceVersionEnv  = "ENTANDO_UPGRADE_SOURCE_VERSION"
+	hookTargetVersionEnv  = "ENTANDO_UPGRADE_TARGET_VERSION"
+	hookImagesEnv         = "ENTANDO_UPGRADE_IMAGES"
+	hookErrorEnv          = "ENTANDO_UPGRADE_ERROR"
+	hookContextEnv        = "ENTANDO_UPGRADE_CONTEXT"
+	hookPhasesDescription = "pre-validate, pre-apply, post-apply, on-success, on-failure"
+)
+
+// Hook is an action executed during a specific phase of the upgrade.
+// It can be a local executable (Command) or an in-cluster Job (Job).
+type Hook struct {
+	Name  string    `json:"name"`
+	Phase HookPhase `json:"phase"`
+	// path of a local executable
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// path of a Job manifest that will be created in the cluster
+	Job string `json:"job,omitempty"`
+	// maximum duration of the local command or of the Job (e.g. 5m), defaults to 10m
+	Timeout string `json:"timeout,omitempty"`
+	// abort (default) or warn
+	OnFailure HookFailurePolicy `json:"onFailure,omitempty"`
+}
+
+// HooksConfig contains the hooks defined in the hooks file
+type HooksConfig struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// HookContext contains the information about the upgrade that is provided to the hooks
+type HookContext struct {
+	Phase         HookPhase         `json:"phase"`
+	UpgradeID     string            `json:"upgradeId"`
+	AppName       string            `json:"appName,omitempty"`
+	SourceVersion string            `json:"sourceVersion,omitempty"`
+	TargetVersion string            `json:"targetVersion,omitempty"`
+	Images        []RecordedImage   `json:"images,omitempty"`
+	Flags         map[string]string `json:"flags,omitempty"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// LoadHooksConfig reads the hooks definitions from a YAML file.
+// If the file name is empty a nil configuration is returned, on which Run is a no-op.
+func LoadHooksConfig(fileName string) (*HooksConfig, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read hooks file %s. %s", fileName, err.Error())
+	}
+
+	config := HooksConfig{}
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse hooks file %s. %s", fileName, err.Error())
+	}
+
+	for i := range config.Hooks {
+		if err := validateHook(&config.Hooks[i]); err != nil {
+			return nil, fmt.Errorf("invalid hook #%d in %s: %s", i+1, fileName, err.Error())
+		}
+	}
+
+	return &config, nil
+}
+
+func validateHook(hook *Hook) error {
+	switch hook.Phase {
+	case PreValidate, PreApply, PostApply, OnSuccess, OnFailure:
+	default:
+		return fmt.Errorf("unsupported phase '%s'. Possible values: %s", hook.Phase, hookPhasesDescription)
+	}
+
+	if (hook.Command == "") == (hook.Job == "") {
+		return fmt.Errorf("exactly one between command and job must be set")
+	}
+
+	if hook.Name == "" {
+		if hook.Command != "" {
+			hook.Name = hook.Command
+		} else {
+			hook.Name = hook.Job
+		}
+	}
+
+	switch hook.OnFailure {
+	case "":
+		hook.OnFailure = Abort
+	case Abort, Warn:
+	default:
+		return fmt.Errorf("unsupported onFailure value '%s'. Possible values: %s, %s", hook.OnFailure, Abort, Warn)
+	}
+
+	if hook.Timeout != "" {
+		if _, err := time.ParseDuration(hook.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout '%s'", hook.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// NewHookContext builds the context of the given phase from the upgrade record
+func NewHookContext(phase HookPhase, record *UpgradeRecord, upgradeErr error) HookContext {
+	hookContext := HookContext{
+		Phase:         phase,
+		UpgradeID:     record.ID,
+		AppName:       record.AppName,
+		SourceVersion: record.SourceVersion,
+		TargetVersion: record.TargetVersion,
+		Images:        record.Images,
+		Flags:         record.Flags,
+	}
+	if upgradeErr != nil {
+		hookContext.Error = upgradeErr.Error()
+	}
+	return hookContext
+}
+
+// Run executes the hooks defined for the phase of the given context, in the order in which they are declared.
+// The first failure of a hook having the abort policy stops the execution and is returned.
+func (c *HooksConfig) Run(hookContext HookContext) error {
+	if c == nil {
+		return nil
+	}
+
+	for _, hook := range c.Hooks {
+		if hook.Phase != hookContext.Phase {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "Running %s hook %s\n", hook.Phase, hook.Name)
+
+		var err error
+		if hook.Command != "" {
+			err = runLocalHook(hook, hookContext)
+		} else {
+			err = runJobHook(hook, hookContext)
+		}
+
+		if err != nil {
+			if hook.OnFailure == Warn {
+				fmt.Fprintf(os.Stderr, "WARNING: %s hook %s failed: %s\n", hook.Phase, hook.Name, err.Error())
+				continue
+			}
+			return fmt.Errorf("%s hook %s failed: %s", hook.Phase, hook.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// runLocalHook executes a local hook, providing the context as environment variables and as JSON on stdin
+func runLocalHook(hook Hook, hookContext HookContext) error {
+	env, err := getHookEnv(hookContext)
+	if err != nil {
+		return err
+	}
+
+	var args []interface{}
+	for _, arg := range hook.Args {
+		args = append(args, arg)
+	}
+
+	_, err = spawn.Spawn(context.Background(),
+		hook.Command,
+		args,
+		env,
+		spawn.Options{
+			WithSudo: false,
+			Stdin:    strings.NewReader(env[hookContextEnv]),
+			Timeout:  getHookTimeout(hook),
+		},
+	)
+
+	return err
+}
+
+// runJobHook creates the Job defined in the hook manifest and waits for its completion.
+// The context is provided in the entando-upgrade-hook-context ConfigMap, that can be loaded by the Job using envFrom.
+func runJobHook(hook Hook, hookContext HookContext) error {
+	content, err := os.ReadFile(hook.Job)
+	if err != nil {
+		return fmt.Errorf("unable to read Job manifest %s. %s", hook.Job, err.Error())
+	}
+
+	job := batchv1.Job{}
+	if err := yaml.Unmarshal(content, &job); err != nil {
+		return fmt.Errorf("unable to parse Job manifest %s. %s", hook.Job, err.Error())
+	}
+	if job.Name == "" {
+		return fmt.Errorf("the Job manifest %s doesn't define metadata.name", hook.Job)
+	}
+
+	env, err := getHookEnv(hookContext)
+	if err != nil {
+		return err
+	}
+
+	configMap := corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: hookContextConfigMap},
+		Data:       env,
+	}
+	if err := applyObject(&configMap); err != nil {
+		return fmt.Errorf("unable to create the hook context ConfigMap: %s", err.Error())
+	}
+
+	// Jobs are immutable, so the one created by a previous execution is removed
+	if _, err := runKubectl("delete", "job", job.Name, "--ignore-not-found", "--wait=true"); err != nil {
+		return err
+	}
+	if _, err := runKubectl("create", "-f", hook.Job); err != nil {
+		return err
+	}
+
+	return waitForJob(job.Name, getHookTimeout(hook))
+}
+
+// getHookTimeout returns the timeout of the hook, or the default one if not set
+func getHookTimeout(hook Hook) time.Duration {
+	if hook.Timeout == "" {
+		return defaultHookTimeout
+	}
+	timeout, _ := time.ParseDuration(hook.Timeout)
+	return timeout
+}
+
+func waitForJob(name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		stdout, err := runKubectl("get", "job", name, "-o", "json")
+		if err != nil {
+			return err
+		}
+
+		job := batchv1.Job{}
+		if err := json.Unmarshal([]byte(stdout), &job); err != nil {
+			return err
+		}
+
+		if job.Status.Succeeded > 0 {
+			return nil
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+				return fmt.Errorf("job %s failed: %s", name, condition.Message)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("job %s not completed after %s", name, timeout)
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func getHookEnv(hookContext HookContext) (spawn.Environ, error) {
+	contextJson, err := json.Marshal(hookContext)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, image := range hookContext.Images {
+		images = append(images, image.Component+"="+image.Image)
+	}
+	sort.Strings(images)
+
+	return spawn.Environ{
+		hookPhaseEnv:         string(hookContext.Phase),
+		hookUpgradeIdEnv:     hookContext.UpgradeID,
+		hookAppNameEnv:       hookContext.AppName,
+		hookSourceVersionEnv: hookContext.SourceVersion,
+		hookTargetVersionEnv: hookContext.TargetVersion,
+		hookImagesEnv:        strings.Join(images, ","),
+		hookErrorEnv:         hookContext.Error,
+		hookContextEnv:       string(contextJson),
+	}, nil
+}
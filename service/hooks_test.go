@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadHooksConfig(t *testing.T) {
+
+	hooksFile := filepath.Join(t.TempDir(), "hooks.yaml")
+	os.WriteFile(hooksFile, []byte(`hooks:
+- name: backup
+  phase: pre-apply
+  command: ./backup.sh
+- phase: post-apply
+  job: smoke-tests-job.yaml
+  timeout: 5m
+  onFailure: warn
+`), 0600)
+
+	config, err := LoadHooksConfig(hooksFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if len(config.Hooks) != 2 {
+		t.Fatalf("expected 2 hooks, found %d", len(config.Hooks))
+	}
+	if config.Hooks[0].OnFailure != Abort {
+		t.Fatalf("expected default onFailure %s, found %s", Abort, config.Hooks[0].OnFailure)
+	}
+	if config.Hooks[1].Name != "smoke-tests-job.yaml" {
+		t.Fatalf("unexpected default name %s", config.Hooks[1].Name)
+	}
+	if getHookTimeout(config.Hooks[0]) != defaultHookTimeout || getHookTimeout(config.Hooks[1]) != 5*time.Minute {
+		t.Fatalf("unexpected hook timeouts")
+	}
+}
+
+func TestLoadInvalidHooksConfig(t *testing.T) {
+
+	checkInvalidHooksConfig(t, "hooks:\n- phase: pre-upgrade\n  command: ./backup.sh\n", "unsupported phase 'pre-upgrade'")
+	checkInvalidHooksConfig(t, "hooks:\n- phase: pre-apply\n", "exactly one between command and job must be set")
+	checkInvalidHooksConfig(t, "hooks:\n- phase: pre-apply\n  command: ./backup.sh\n  onFailure: ignore\n", "unsupported onFailure value 'ignore'")
+	checkInvalidHooksConfig(t, "hooks:\n- phase: pre-apply\n  command: ./backup.sh\n  unknown: true\n", "unknown field")
+}
+
+func checkInvalidHooksConfig(t *testing.T, content, expectedError string) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.yaml")
+	os.WriteFile(hooksFile, []byte(content), 0600)
+
+	_, err := LoadHooksConfig(hooksFile)
+	if err == nil {
+		t.Fatalf("an error was expected for %s", content)
+	}
+	if !strings.Contains(err.Error(), expectedError) {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestRunLocalHooks(t *testing.T) {
+
+	outputFile := filepath.Join(t.TempDir(), "hook-output")
+	os.Setenv("HOOK_OUTPUT_FILE", outputFile)
+	defer os.Unsetenv("HOOK_OUTPUT_FILE")
+
+	config := HooksConfig{Hooks: []Hook{
+		{Name: "context", Phase: PreApply, Command: "sh", Args: []string{"-c", `cat > "$HOOK_OUTPUT_FILE"`}, OnFailure: Abort},
+		{Name: "other-phase", Phase: PostApply, Command: "false", OnFailure: Abort},
+		{Name: "failing-warn", Phase: PreApply, Command: "false", OnFailure: Warn},
+	}}
+
+	record := NewUpgradeRecord(nil)
+	record.AppName = "my-entando-app"
+	record.TargetVersion = "7.1.1"
+
+	if err := config.Run(NewHookContext(PreApply, record, nil)); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hookContext := HookContext{}
+	if err := json.Unmarshal(content, &hookContext); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hookContext.Phase != PreApply || hookContext.TargetVersion != "7.1.1" || hookContext.AppName != "my-entando-app" {
+		t.Fatalf("unexpected hook context %+v", hookContext)
+	}
+
+	err = config.Run(NewHookContext(PostApply, record, nil))
+	if err == nil || !strings.HasPrefix(err.Error(), "post-apply hook other-phase failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRunLocalHookEnv(t *testing.T) {
+
+	outputFile := filepath.Join(t.TempDir(), "hook-env")
+	os.Setenv("HOOK_OUTPUT_FILE", outputFile)
+	defer os.Unsetenv("HOOK_OUTPUT_FILE")
+
+	hookContext := HookContext{
+		Phase:         OnFailure,
+		UpgradeID:     "20221201120000",
+		AppName:       "my-entando-app",
+		SourceVersion: "7.1.0",
+		TargetVersion: "7.1.1",
+		Images:        []RecordedImage{{Component: "Keycloak", Image: "entando/entando-keycloak:7.1.1"}},
+		Error:         "upgrade failed",
+	}
+	hook := Hook{Name: "env", Phase: OnFailure, Command: "sh", Args: []string{"-c", `env > "$HOOK_OUTPUT_FILE"`}}
+
+	if err := runLocalHook(hook, hookContext); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hookEnv := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if name, value, found := strings.Cut(line, "="); found {
+			hookEnv[name] = value
+		}
+	}
+
+	expectedEnv, err := getHookEnv(hookContext)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for name, expectedValue := range expectedEnv {
+		if value, found := hookEnv[name]; !found || value != expectedValue {
+			t.Fatalf("expected %s=%s in the hook environment, found '%s'", name, expectedValue, value)
+		}
+	}
+	if hookEnv["HOOK_OUTPUT_FILE"] != outputFile {
+		t.Fatalf("the hook environment doesn't include the parent environment")
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+
+	env, err := getHookEnv(HookContext{
+		Phase:         OnFailure,
+		TargetVersion: "7.1.1",
+		Images: []RecordedImage{
+			{Component: "Keycloak", Image: "entando/entando-keycloak:7.1.1"},
+			{Component: "DeApp", Image: "entando/entando-de-app-eap:7.1.1"},
+		},
+		Error: "upgrade failed",
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	expectedImages := "DeApp=entando/entando-de-app-eap:7.1.1,Keycloak=entando/entando-keycloak:7.1.1"
+	if env[hookImagesEnv] != expectedImages {
+		t.Fatalf("expected %s, found %s", expectedImages, env[hookImagesEnv])
+	}
+	if env[hookPhaseEnv] != string(OnFailure) || env[hookErrorEnv] != "upgrade failed" || env[hookTargetVersionEnv] != "7.1.1" {
+		t.Fatalf("unexpected hook environment %v", env)
+	}
+}
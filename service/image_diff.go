@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// CurrentImageSet selects the images running in the cluster instead of the ones of a version
+	CurrentImageSet = "current"
+
+	// DefaultReleaseManifestUrl is the manifest of the Entando release containing the versions of the images
+	DefaultReleaseManifestUrl = "https://raw.githubusercontent.com/entando/entando-releases/v%s/dist/ge-1-1-6/namespace-scoped-deployment/namespace-resources.yaml"
+
+	dockerImageInfoConfigMap = "entando-docker-image-info"
+
+	ImageAdded     = "added"
+	ImageRemoved   = "removed"
+	ImageChanged   = "changed"
+	ImageUnchanged = "unchanged"
+)
+
+// defaultPlatform is used to compute the size of multi-platform images
+var defaultPlatform = v1.Platform{OS: "linux", Architecture: "amd64"}
+
+// ResolvedImage is the image of a component with its digest and its compressed size.
+// Digest and Size are empty if the image can't be retrieved from the registry.
+type ResolvedImage struct {
+	Component string
+	Image     string
+	Digest    string
+	Size      int64
+}
+
+// ImageChange describes the difference between the images of a component in two image sets
+type ImageChange struct {
+	Component string
+	Change    string
+	From      *ResolvedImage
+	To        *ResolvedImage
+}
+
+// GetImageSet returns the images of the components, indexed by component name, of the given Entando version,
+// of the images file with the given path or, if the value is "current", of the deployments in the cluster
+func GetImageSet(value string, imageSetType imagesettype.ImageSetType, manifestUrl string) (map[string]string, error) {
+	if value == CurrentImageSet {
+		currentImages, err := GetCurrentImages()
+		if err != nil {
+			return nil, err
+		}
+		return CurrentImagesOverrides(currentImages), nil
+	}
+	if _, err := os.Stat(value); err == nil {
+		return LoadImagesFile(value)
+	}
+	return GetVersionImageSet(value, imageSetType, manifestUrl)
+}
+
+// GetVersionImageSet downloads the release manifest of the version and returns the images of the components in the given image set
+func GetVersionImageSet(version string, imageSetType imagesettype.ImageSetType, manifestUrl string) (map[string]string, error) {
+	if manifestUrl == "" {
+		manifestUrl = DefaultReleaseManifestUrl
+	}
+	location := fmt.Sprintf(manifestUrl, strings.TrimPrefix(version, "v"))
+
+	manifest, found := releaseManifests[location]
+	if !found {
+		manifest.versions, manifest.err = downloadReleaseManifest(version, location)
+		releaseManifests[location] = manifest
+	}
+	if manifest.err != nil {
+		return nil, manifest.err
+	}
+	return getImageSetOfVersions(manifest.versions, imageSetType), nil
+}
+
+// releaseManifest contains the image versions read from a release manifest, or the error occurred reading it
+type releaseManifest struct {
+	versions map[string]string
+	err      error
+}
+
+// releaseManifests caches the release manifests by location, since the default images of the target version
+// are needed by several steps of the same command
+var releaseManifests = map[string]releaseManifest{}
+
+func downloadReleaseManifest(version, location string) (map[string]string, error) {
+	content, err := download(location)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download the release manifest of version %s from %s. %s", version, location, err.Error())
+	}
+
+	versions, err := parseDockerImageInfo(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the release manifest of version %s. %s", version, err.Error())
+	}
+	return versions, nil
+}
+
+// parseDockerImageInfo returns the image versions, indexed by repository, of the entando-docker-image-info ConfigMap
+// contained in the multi-document manifest
+func parseDockerImageInfo(content []byte) (map[string]string, error) {
+	for _, document := range strings.Split(string(content), "\n---") {
+		configMap := corev1.ConfigMap{}
+		if err := yaml.Unmarshal([]byte(document), &configMap); err != nil {
+			continue
+		}
+		if configMap.Kind != "ConfigMap" || configMap.Name != dockerImageInfoConfigMap {
+			continue
+		}
+
+		versions := map[string]string{}
+		for repo, value := range configMap.Data {
+			info := struct {
+				Version string `json:"version"`
+			}{}
+			if err := json.Unmarshal([]byte(value), &info); err != nil {
+				return nil, fmt.Errorf("invalid image info of %s: %s", repo, err.Error())
+			}
+			versions[repo] = info.Version
+		}
+		return versions, nil
+	}
+	return nil, fmt.Errorf("the ConfigMap %s was not found", dockerImageInfoConfigMap)
+}
+
+// getImageSetOfVersions returns the default images of the components in the image set, tagged with the versions
+// of their Community repositories. Components missing in the versions are not included.
+func getImageSetOfVersions(versions map[string]string, imageSetType imagesettype.ImageSetType) map[string]string {
+	imageSet := map[string]string{}
+	for _, imageInfo := range images.EntandoImages {
+		version, ok := versions[images.ExtractRepo(imageInfo.DefaultImages[imagesettype.Community])]
+		if !ok || version == "" {
+			continue
+		}
+		imageSet[imageInfo.ComponentName] = imageInfo.GetDefaultImage(imageSetType) + ":" + version
+	}
+	return imageSet
+}
+
+// ResolveImageSet retrieves the digests and the sizes of the images from the registries, reporting failures as warnings
+func ResolveImageSet(imageSet map[string]string) map[string]ResolvedImage {
+	resolved := map[string]ResolvedImage{}
+	for component, image := range imageSet {
+		resolvedImage := ResolvedImage{Component: component, Image: image}
+		if digest, size, err := resolveImage(image); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to retrieve image %s of %s: %s\n", image, component, err.Error())
+		} else {
+			resolvedImage.Digest, resolvedImage.Size = digest, size
+		}
+		resolved[component] = resolvedImage
+	}
+	return resolved
+}
+
+// resolveImage returns the digest of the image and its compressed size for the default platform
+func resolveImage(image string) (string, int64, error) {
+	digest, err := CraneDigest(image)
+	if err != nil {
+		return "", 0, err
+	}
+	layers, err := GetImageLayers(image)
+	if err != nil {
+		return "", 0, err
+	}
+	return digest, ImageLayers{Layers: layers}.Size(), nil
+}
+
+// DiffImageSets compares the images of the components, in the order of the components registry
+func DiffImageSets(from, to map[string]ResolvedImage) []ImageChange {
+	changes := []ImageChange{}
+	for _, imageInfo := range images.EntandoImages {
+		fromImage, inFrom := from[imageInfo.ComponentName]
+		toImage, inTo := to[imageInfo.ComponentName]
+
+		change := ImageChange{Component: imageInfo.ComponentName}
+		switch {
+		case inFrom && inTo:
+			change.From, change.To = &fromImage, &toImage
+			change.Change = ImageUnchanged
+			if !isSameImage(fromImage, toImage) {
+				change.Change = ImageChanged
+			}
+		case inFrom:
+			change.From, change.Change = &fromImage, ImageRemoved
+		case inTo:
+			change.To, change.Change = &toImage, ImageAdded
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// isSameImage compares the digests when both are known, otherwise the image references
+func isSameImage(from, to ResolvedImage) bool {
+	if from.Digest != "" && to.Digest != "" {
+		return from.Digest == to.Digest && getImageName(from.Image) == getImageName(to.Image)
+	}
+	return from.Image == to.Image
+}
+
+// getImageName returns the image without tag and digest, including the default registry if not specified
+func getImageName(image string) string {
+	name := images.StripTagAndDigest(image)
+	if !images.ContainsRegistry(name) {
+		return images.DefaultRegistry + "/" + name
+	}
+	return name
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	imagesettype "upgrade-cli/flag/image_set_type"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+const testReleaseManifest = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: entando-operator
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: entando-docker-image-info
+data:
+  app-builder: '{"version":"7.2.1","executable-type":"jvm","registry":"registry.hub.docker.com","organization":"entando"}'
+  entando-de-app-wildfly: '{"version":"7.2.1","executable-type":"jvm","registry":"registry.hub.docker.com","organization":"entando"}'
+  entando-keycloak: '{"version":"7.2.0","executable-type":"jvm","registry":"registry.hub.docker.com","organization":"entando"}'
+`
+
+func TestGetImageSetOfVersions(t *testing.T) {
+	versions, err := parseDockerImageInfo([]byte(testReleaseManifest))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	imageSet := getImageSetOfVersions(versions, imagesettype.Community)
+	if len(imageSet) != 3 || imageSet["AppBuilder"] != "registry.hub.docker.com/entando/app-builder:7.2.1" ||
+		imageSet["Keycloak"] != "registry.hub.docker.com/entando/entando-keycloak:7.2.0" {
+		t.Fatalf("unexpected image set %v", imageSet)
+	}
+
+	if _, err := parseDockerImageInfo([]byte("kind: ConfigMap\nmetadata:\n  name: other\n")); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+func TestDiffImageSets(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	pushTestImage(t, host+"/entando/app-builder:7.1.0")
+	pushTestImage(t, host+"/entando/app-builder:7.2.1")
+	pushTestImage(t, host+"/entando/entando-keycloak:7.1.0")
+	keycloak := pushTestImage(t, host+"/entando/entando-keycloak:7.2.0")
+
+	from := ResolveImageSet(map[string]string{
+		"AppBuilder":       host + "/entando/app-builder:7.1.0",
+		"Keycloak":         keycloak,
+		"ComponentManager": host + "/entando/entando-component-manager:7.1.0",
+	})
+	to := ResolveImageSet(map[string]string{
+		"AppBuilder": host + "/entando/app-builder:7.2.1",
+		"Keycloak":   host + "/entando/entando-keycloak:7.2.0",
+		"DeApp":      host + "/entando/entando-de-app-wildfly:7.2.1",
+	})
+
+	if from["AppBuilder"].Digest == "" || from["AppBuilder"].Size == 0 || from["ComponentManager"].Digest != "" {
+		t.Fatalf("unexpected resolved images %+v", from)
+	}
+
+	changes := map[string]string{}
+	for _, change := range DiffImageSets(from, to) {
+		changes[change.Component] = change.Change
+	}
+	expected := map[string]string{"AppBuilder": ImageChanged, "Keycloak": ImageUnchanged, "DeApp": ImageAdded, "ComponentManager": ImageRemoved}
+	for component, change := range expected {
+		if changes[component] != change {
+			t.Fatalf("unexpected changes %v", changes)
+		}
+	}
+}
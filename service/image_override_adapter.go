@@ -1,17 +1,34 @@
 package service
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	imagesettype "upgrade-cli/flag/image_set_type"
+	pinmode "upgrade-cli/flag/pin_mode"
 	"upgrade-cli/util/images"
 
-	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
 	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
-var CraneDigest = crane.Digest
+var (
+	CraneDigest   = crane.Digest
+	CraneManifest = crane.Manifest
+	CraneConfig   = crane.Config
+)
+
+// PinOptions defines how the image tags are replaced with digests in OLM installations
+type PinOptions struct {
+	// Index pins the digest returned for the tag, that may be a manifest list; Platform pins the platform manifest
+	Mode pinmode.PinMode
+	// if set, the pinned images must provide this platform; required by the Platform mode
+	Platform *v1.Platform
+}
 
 const (
 	missingDigestPlaceholder = "ERROR: <unable to fetch digest of: %s>"
@@ -19,20 +36,36 @@ const (
 
 // AdaptImagesOverride converts the format of the images provided by the user to full URL format
 // Returns a bool that is true in case of errors in digests retrieval.
-func AdaptImagesOverride(entandoAppV2 *v1alpha1.EntandoAppV2, olm bool) bool {
+func AdaptImagesOverride(entandoAppV2 *images.EntandoApp, olm bool) bool {
+	needsFix, _ := AdaptImagesOverrideWithPinning(entandoAppV2, olm, PinOptions{Mode: pinmode.Index})
+	return needsFix
+}
+
+// AdaptImagesOverrideWithPinning works like AdaptImagesOverride, pinning the digests according to the options.
+// An error is returned if some pinned images don't provide the requested platform.
+func AdaptImagesOverrideWithPinning(entandoAppV2 *images.EntandoApp, olm bool, pinOptions PinOptions) (bool, error) {
 
 	imageSetType := imagesettype.ImageSetType(entandoAppV2.Spec.ImageSetType)
 
 	digestErrors := make(map[string]error)
+	platformErrors := []string{}
 
 	for _, imageInfo := range images.EntandoImages {
-		adaptImageOverride(entandoAppV2, imageInfo, imageSetType, olm, digestErrors)
+		err := adaptImageOverride(entandoAppV2, imageInfo, imageSetType, olm, pinOptions, digestErrors)
+		if err != nil {
+			platformErrors = append(platformErrors, fmt.Sprintf("%s: %s", imageInfo.ComponentName, err.Error()))
+		}
+	}
+
+	if len(platformErrors) > 0 {
+		return false, fmt.Errorf("some images don't provide the platform %s:\n- %s", pinOptions.Platform, strings.Join(platformErrors, "\n- "))
 	}
 
-	return checkDigestErrors(digestErrors)
+	return checkDigestErrors(digestErrors), nil
 }
 
-func adaptImageOverride(entandoAppV2 *v1alpha1.EntandoAppV2, imageInfo images.EntandoImageInfo, imageSetType imagesettype.ImageSetType, olm bool, digestErrors map[string]error) {
+func adaptImageOverride(entandoAppV2 *images.EntandoApp, imageInfo images.EntandoImageInfo, imageSetType imagesettype.ImageSetType, olm bool,
+	pinOptions PinOptions, digestErrors map[string]error) error {
 	imageOverride := imageInfo.GetImageOverride(entandoAppV2)
 
 	if imageOverride != nil && *imageOverride != "" {
@@ -47,19 +80,38 @@ func adaptImageOverride(entandoAppV2 *v1alpha1.EntandoAppV2, imageInfo images.En
 		checkImageSetTypeMismatch(*imageOverride, imageInfo, imageSetType)
 
 		if olm {
-			err := replaceTagsWithDigests(imageOverride)
-			if err != nil {
+			err := replaceTagsWithDigests(imageOverride, pinOptions)
+			var platformErr *missingPlatformError
+			if errors.As(err, &platformErr) {
+				return err
+			} else if err != nil {
 				digestErrors[imageInfo.ImageOverrideFlag] = err
 			}
 		}
 	}
+	return nil
 }
 
 // replaceTagsWithDigests replaces image tags with digests. This is needed for OLM installations.
-func replaceTagsWithDigests(imageOverride *string) error {
-	if !strings.Contains(*imageOverride, "@sha256:") {
-		prefix := strings.Split(*imageOverride, ":")[0]
+func replaceTagsWithDigests(imageOverride *string, pinOptions PinOptions) error {
+	imageRef, err := images.ParseImage(*imageOverride)
+	if err != nil {
+		providedValue := *imageOverride
+		*imageOverride = fmt.Sprintf(missingDigestPlaceholder, providedValue)
+		return err
+	}
 
+	if pinOptions.Platform != nil {
+		digest, err := resolvePlatformDigest(*imageOverride, pinOptions)
+		if err != nil {
+			var platformErr *missingPlatformError
+			if !errors.As(err, &platformErr) {
+				*imageOverride = fmt.Sprintf(missingDigestPlaceholder, *imageOverride)
+			}
+			return err
+		}
+		*imageOverride = imageRef.Name() + "@" + digest
+	} else if imageRef.Digest == "" {
 		providedValue := *imageOverride
 		digest, err := CraneDigest(providedValue)
 		if err != nil {
@@ -68,11 +120,86 @@ func replaceTagsWithDigests(imageOverride *string) error {
 			return err
 		}
 
-		*imageOverride = prefix + "@" + digest
+		*imageOverride = imageRef.Name() + "@" + digest
 	}
 	return nil
 }
 
+// missingPlatformError is returned when an image doesn't provide the requested platform
+type missingPlatformError struct {
+	image     string
+	available []string
+}
+
+func (e *missingPlatformError) Error() string {
+	if len(e.available) == 0 {
+		return fmt.Sprintf("image %s doesn't declare its platform", e.image)
+	}
+	return fmt.Sprintf("image %s provides only %s", e.image, strings.Join(e.available, ", "))
+}
+
+// resolvePlatformDigest checks that the image provides the requested platform and returns the digest to pin:
+// the digest of the manifest list in Index mode, the digest of the platform manifest in Platform mode
+func resolvePlatformDigest(image string, pinOptions PinOptions) (string, error) {
+	rawManifest, err := CraneManifest(image)
+	if err != nil {
+		return "", err
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(rawManifest))
+	if err != nil {
+		return "", err
+	}
+
+	manifest := struct {
+		MediaType types.MediaType `json:"mediaType"`
+		Manifests []v1.Descriptor `json:"manifests"`
+	}{}
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return "", fmt.Errorf("unable to parse the manifest of %s: %s", image, err.Error())
+	}
+
+	if manifest.MediaType.IsIndex() || len(manifest.Manifests) > 0 {
+		available := []string{}
+		for _, descriptor := range manifest.Manifests {
+			if descriptor.Platform == nil {
+				continue
+			}
+			if platformMatches(*descriptor.Platform, *pinOptions.Platform) {
+				if pinOptions.Mode == pinmode.Platform {
+					return descriptor.Digest.String(), nil
+				}
+				return digest.String(), nil
+			}
+			available = append(available, descriptor.Platform.String())
+		}
+		return "", &missingPlatformError{image: image, available: available}
+	}
+
+	// single platform image, the platform is declared in the config
+	rawConfig, err := CraneConfig(image)
+	if err != nil {
+		return "", err
+	}
+	config, err := v1.ParseConfigFile(bytes.NewReader(rawConfig))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the config of %s: %s", image, err.Error())
+	}
+	if config.OS == "" || config.Architecture == "" {
+		return "", &missingPlatformError{image: image}
+	}
+	platform := v1.Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}
+	if !platformMatches(platform, *pinOptions.Platform) {
+		return "", &missingPlatformError{image: image, available: []string{platform.String()}}
+	}
+	return digest.String(), nil
+}
+
+// platformMatches compares OS and architecture and, only if requested, the variant
+func platformMatches(platform, requested v1.Platform) bool {
+	return platform.OS == requested.OS && platform.Architecture == requested.Architecture &&
+		(requested.Variant == "" || platform.Variant == requested.Variant)
+}
+
 func checkDigestErrors(digestErrors map[string]error) bool {
 	if len(digestErrors) > 0 {
 		fmt.Fprintln(os.Stderr, "WARNING: unable to retrieve the digest for some images. Please replace the placeholders in the YAML file.")
@@ -88,14 +215,23 @@ func checkDigestErrors(digestErrors map[string]error) bool {
 // in case of inconsistencies between the provided images and the selected installation type the user is warned
 func checkImageSetTypeMismatch(image string, imageInfo images.EntandoImageInfo, imageSetType imagesettype.ImageSetType) {
 
-	// the check is performed only when using official Entando images
-	if images.IsOfficialImage(image) && imageInfo.IsMultiImage {
-		providedRepo := images.ExtractRepo(image)
-		if providedRepo != "" {
-			expectedRepo := images.ExtractRepo(imageInfo.GetDefaultImage(imageSetType))
-			if providedRepo != expectedRepo {
-				fmt.Fprintf(os.Stderr, "WARNING: image-set-type is set to %s but the repository %s was provided. Expected repository should be %s\n", imageSetType, providedRepo, expectedRepo)
-			}
+	// the check is performed only when the image is the default one of some image sets
+	imageSetTypes := images.GetImageSetTypesOf(image, imageInfo)
+	if len(imageSetTypes) == 0 {
+		return
+	}
+	for _, providedImageSetType := range imageSetTypes {
+		if providedImageSetType == imageSetType {
+			return
 		}
 	}
+
+	expectedImage := imageInfo.GetDefaultImage(imageSetType)
+	providedRepo := images.ExtractRepo(image)
+	expectedRepo := images.ExtractRepo(expectedImage)
+	if providedRepo != expectedRepo {
+		fmt.Fprintf(os.Stderr, "WARNING: image-set-type is set to %s but the repository %s was provided. Expected repository should be %s\n", imageSetType, providedRepo, expectedRepo)
+	} else {
+		fmt.Fprintf(os.Stderr, "WARNING: image-set-type is set to %s but the image %s of the %s image set was provided. Expected image should be %s\n", imageSetType, images.StripTagAndDigest(image), imageSetTypes[0], expectedImage)
+	}
 }
@@ -4,9 +4,12 @@ import (
 	"strings"
 	"testing"
 	imagesettype "upgrade-cli/flag/image_set_type"
+	pinmode "upgrade-cli/flag/pin_mode"
+	"upgrade-cli/util/images"
 
 	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
 	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/zenizh/go-capturer"
 )
 
@@ -16,21 +19,21 @@ func TestAdaptImagesOverrideOLM(t *testing.T) {
 	defer func() { CraneDigest = origDigest }()
 
 	CraneDigest = func(ref string, opt ...crane.Option) (string, error) {
-		return "sha256:94af0fb4525", nil
+		return "sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", nil
 	}
 
-	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 
 	entandoAppV2.Spec.AppBuilder.ImageOverride = "entando/app-builder:7.1.1-ENG-4277-PR-1413"
 	entandoAppV2.Spec.DeApp.ImageOverride = "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1-ENGPM-493-PR-440"
-	entandoAppV2.Spec.Keycloak.ImageOverride = "entando/entando-keycloak@sha256:d550b07f5dd6"
+	entandoAppV2.Spec.Keycloak.ImageOverride = "entando/entando-keycloak@sha256:d550b07f5dd6d3e4b5a5f1e0cd1f41a3ea48f7a5ef33c83ef3d72b6a2fe8a2e9"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.RedhatCertified)
 
-	AdaptImagesOverride(&entandoAppV2, true)
+	AdaptImagesOverride(entandoAppV2, true)
 
-	expectedAppBuilder := "registry.hub.docker.com/entando/app-builder@sha256:94af0fb4525"
-	expectedDeApp := "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525"
-	expectedKeycloak := "registry.hub.docker.com/entando/entando-keycloak@sha256:d550b07f5dd6"
+	expectedAppBuilder := "registry.hub.docker.com/entando/app-builder@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f"
+	expectedDeApp := "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f"
+	expectedKeycloak := "registry.hub.docker.com/entando/entando-keycloak@sha256:d550b07f5dd6d3e4b5a5f1e0cd1f41a3ea48f7a5ef33c83ef3d72b6a2fe8a2e9"
 
 	if appBuilder := entandoAppV2.Spec.AppBuilder.ImageOverride; appBuilder != expectedAppBuilder {
 		t.Fatalf("expected %s, found %s", expectedAppBuilder, appBuilder)
@@ -43,16 +46,37 @@ func TestAdaptImagesOverrideOLM(t *testing.T) {
 	}
 }
 
+func TestAdaptImagesOverrideOLMRegistryWithPort(t *testing.T) {
+
+	origDigest := CraneDigest
+	defer func() { CraneDigest = origDigest }()
+
+	CraneDigest = func(ref string, opt ...crane.Option) (string, error) {
+		return "sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", nil
+	}
+
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoAppV2.Spec.AppBuilder.ImageOverride = "localhost:5000/entando/team/app-builder:7.1.1"
+	entandoAppV2.Spec.ImageSetType = string(imagesettype.RedhatCertified)
+
+	AdaptImagesOverride(entandoAppV2, true)
+
+	expectedAppBuilder := "localhost:5000/entando/team/app-builder@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f"
+	if appBuilder := entandoAppV2.Spec.AppBuilder.ImageOverride; appBuilder != expectedAppBuilder {
+		t.Fatalf("expected %s, found %s", expectedAppBuilder, appBuilder)
+	}
+}
+
 func TestAdaptImagesOverrideNonOLM(t *testing.T) {
 
-	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 
 	entandoAppV2.Spec.AppBuilder.ImageOverride = "entando/app-builder:7.1.1-ENG-4277-PR-1413"
 	entandoAppV2.Spec.DeApp.ImageOverride = "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1-ENGPM-493-PR-440"
 	entandoAppV2.Spec.Keycloak.ImageOverride = "entando/entando-keycloak:7.1.1-ENGPM-493-PR-440"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.Community)
 
-	AdaptImagesOverride(&entandoAppV2, false)
+	AdaptImagesOverride(entandoAppV2, false)
 
 	expectedAppBuilder := "registry.hub.docker.com/entando/app-builder:7.1.1-ENG-4277-PR-1413"
 	expectedDeApp := "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1-ENGPM-493-PR-440"
@@ -71,13 +95,13 @@ func TestAdaptImagesOverrideNonOLM(t *testing.T) {
 
 func TestAdaptImagesOverrideOnlyTags(t *testing.T) {
 
-	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 
 	entandoAppV2.Spec.DeApp.ImageOverride = "7.1.1-ENGPM-493-PR-440"
 	entandoAppV2.Spec.Keycloak.ImageOverride = "7.1.1-ENGPM-493-PR-440"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.RedhatCertified)
 
-	AdaptImagesOverride(&entandoAppV2, false)
+	AdaptImagesOverride(entandoAppV2, false)
 
 	expectedDeApp := "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1-ENGPM-493-PR-440"
 	expectedKeycloak := "registry.hub.docker.com/entando/entando-redhat-sso:7.1.1-ENGPM-493-PR-440"
@@ -93,7 +117,7 @@ func TestAdaptImagesOverrideOnlyTags(t *testing.T) {
 	entandoAppV2.Spec.Keycloak.ImageOverride = "7.1.1-ENGPM-493-PR-440"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.Community)
 
-	AdaptImagesOverride(&entandoAppV2, false)
+	AdaptImagesOverride(entandoAppV2, false)
 
 	expectedDeApp = "registry.hub.docker.com/entando/entando-de-app-wildfly:7.1.1-ENGPM-493-PR-440"
 	expectedKeycloak = "registry.hub.docker.com/entando/entando-keycloak:7.1.1-ENGPM-493-PR-440"
@@ -108,12 +132,12 @@ func TestAdaptImagesOverrideOnlyTags(t *testing.T) {
 
 func TestImageSetTypeMismatchCommunity(t *testing.T) {
 
-	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 	entandoAppV2.Spec.DeApp.ImageOverride = "entando/entando-de-app-eap:7.1.1"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.Community)
 
 	out := capturer.CaptureOutput(func() {
-		AdaptImagesOverride(&entandoAppV2, false)
+		AdaptImagesOverride(entandoAppV2, false)
 	})
 	out = strings.TrimSpace(out)
 
@@ -129,15 +153,15 @@ func TestImageSetTypeMismatchRedhatCertifiedOLM(t *testing.T) {
 	defer func() { CraneDigest = origDigest }()
 
 	CraneDigest = func(ref string, opt ...crane.Option) (string, error) {
-		return "sha256:94af0fb4525", nil
+		return "sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", nil
 	}
 
-	entandoAppV2 := v1alpha1.EntandoAppV2{}
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
 	entandoAppV2.Spec.DeApp.ImageOverride = "entando/entando-de-app-wildfly:7.1.1"
 	entandoAppV2.Spec.ImageSetType = string(imagesettype.RedhatCertified)
 
 	out := capturer.CaptureOutput(func() {
-		AdaptImagesOverride(&entandoAppV2, true)
+		AdaptImagesOverride(entandoAppV2, true)
 	})
 	out = strings.TrimSpace(out)
 
@@ -146,3 +170,58 @@ func TestImageSetTypeMismatchRedhatCertifiedOLM(t *testing.T) {
 		t.Fatalf("expected \"%s\", found \"%s\"", expectedMsg, out)
 	}
 }
+
+func TestAdaptImagesOverridePlatformPinning(t *testing.T) {
+
+	origManifest, origConfig := CraneManifest, CraneConfig
+	defer func() { CraneManifest, CraneConfig = origManifest, origConfig }()
+
+	index := `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json", "manifests": [
+		{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 1000, "digest": "sha256:1111111111111111111111111111111111111111111111111111111111111111", "platform": {"os": "linux", "architecture": "amd64"}},
+		{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 1000, "digest": "sha256:2222222222222222222222222222222222222222222222222222222222222222", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}}]}`
+	single := `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {"digest": "sha256:3333333333333333333333333333333333333333333333333333333333333333"}}`
+	indexDigest, _, _ := v1.SHA256(strings.NewReader(index))
+	singleDigest, _, _ := v1.SHA256(strings.NewReader(single))
+
+	CraneManifest = func(ref string, opt ...crane.Option) ([]byte, error) {
+		if strings.Contains(ref, "keycloak") {
+			return []byte(single), nil
+		}
+		return []byte(index), nil
+	}
+	CraneConfig = func(ref string, opt ...crane.Option) ([]byte, error) {
+		return []byte(`{"os": "linux", "architecture": "amd64"}`), nil
+	}
+
+	adapt := func(mode pinmode.PinMode, platform string, keycloak bool) (*images.EntandoApp, error) {
+		entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+		entandoAppV2.Spec.AppBuilder.ImageOverride = "entando/app-builder:7.1.2"
+		if keycloak {
+			entandoAppV2.Spec.Keycloak.ImageOverride = "entando/entando-keycloak:7.1.2"
+		}
+		parsedPlatform, _ := v1.ParsePlatform(platform)
+		_, err := AdaptImagesOverrideWithPinning(entandoAppV2, true, PinOptions{Mode: mode, Platform: parsedPlatform})
+		return entandoAppV2, err
+	}
+
+	entandoAppV2, err := adapt(pinmode.Platform, "linux/arm64", false)
+	if err != nil || entandoAppV2.Spec.AppBuilder.ImageOverride != "registry.hub.docker.com/entando/app-builder@sha256:2222222222222222222222222222222222222222222222222222222222222222" {
+		t.Fatalf("unexpected result %s %v", entandoAppV2.Spec.AppBuilder.ImageOverride, err)
+	}
+
+	entandoAppV2, err = adapt(pinmode.Index, "linux/amd64", true)
+	if err != nil || entandoAppV2.Spec.AppBuilder.ImageOverride != "registry.hub.docker.com/entando/app-builder@"+indexDigest.String() ||
+		entandoAppV2.Spec.Keycloak.ImageOverride != "registry.hub.docker.com/entando/entando-keycloak@"+singleDigest.String() {
+		t.Fatalf("unexpected result %+v %v", entandoAppV2.Spec, err)
+	}
+
+	_, err = adapt(pinmode.Platform, "linux/arm64", true)
+	expectedError := "some images don't provide the platform linux/arm64:\n- Keycloak: image registry.hub.docker.com/entando/entando-keycloak:7.1.2 provides only linux/amd64"
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err = adapt(pinmode.Index, "linux/s390x", false); err == nil || !strings.Contains(err.Error(), "provides only linux/amd64, linux/arm64/v8") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
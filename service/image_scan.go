@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"upgrade-cli/flag/severity"
+	"upgrade-cli/util/images"
+	"upgrade-cli/util/sys/spawn"
+)
+
+// ScanFailedExitCode is the exit code used when the scanned images have findings exceeding the severity threshold
+const ScanFailedExitCode = 4
+
+// Vulnerability is a finding reported by an image scanner
+type Vulnerability struct {
+	ID               string            `json:"id"`
+	Package          string            `json:"package"`
+	InstalledVersion string            `json:"installedVersion"`
+	FixedVersion     string            `json:"fixedVersion,omitempty"`
+	Severity         severity.Severity `json:"severity"`
+}
+
+// ImageScanner is the adapter of a vulnerability scanner
+type ImageScanner interface {
+	Scan(image string) ([]Vulnerability, error)
+}
+
+// TrivyScanner scans the images using a local Trivy binary
+type TrivyScanner struct {
+	// the Trivy executable, trivy if empty
+	Command string
+	// directory containing a Trivy vulnerability DB to use without updating it, for offline scans
+	DbDir string
+}
+
+// trivyReport is the subset of the Trivy JSON report used by the CLI
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+		}
+	}
+}
+
+func (s TrivyScanner) Scan(image string) ([]Vulnerability, error) {
+	command := s.Command
+	if command == "" {
+		command = "trivy"
+	}
+
+	args := []interface{}{"image", "--quiet", "--format", "json"}
+	if s.DbDir != "" {
+		args = append(args, "--cache-dir", s.DbDir, "--skip-db-update", "--offline-scan")
+	}
+	args = append(args, image)
+
+	output, err := spawn.Spawn(context.Background(),
+		command,
+		args,
+		spawn.Environ{},
+		spawn.Options{
+			WithSudo:      false,
+			CaptureStdout: true,
+			CaptureStderr: true,
+		},
+	)
+	if err != nil {
+		if stderr := strings.TrimSpace(output.Stderr); stderr != "" {
+			return nil, errors.New(stderr)
+		}
+		return nil, err
+	}
+
+	return parseTrivyReport([]byte(output.Stdout))
+}
+
+func parseTrivyReport(content []byte) ([]Vulnerability, error) {
+	report := trivyReport{}
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("unable to parse Trivy report: %s", err.Error())
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         severity.Parse(v.Severity),
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// ImageScanResult contains the findings of the image of an Entando component
+type ImageScanResult struct {
+	Component       string          `json:"component"`
+	Image           string          `json:"image"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// CountBySeverity returns the number of findings for each severity
+func (r ImageScanResult) CountBySeverity() map[severity.Severity]int {
+	counts := map[severity.Severity]int{}
+	for _, vulnerability := range r.Vulnerabilities {
+		counts[vulnerability.Severity]++
+	}
+	return counts
+}
+
+// ScanImages scans the images that the components run after the upgrade, as returned by GetUpgradeImages
+func ScanImages(scanner ImageScanner, upgradeImages []UpgradeImage) []ImageScanResult {
+	results := []ImageScanResult{}
+
+	for _, upgradeImage := range upgradeImages {
+		result := ImageScanResult{Component: upgradeImage.Component, Image: upgradeImage.Image}
+		if _, err := images.ParseImage(upgradeImage.Image); err != nil {
+			// e.g. the placeholder set when the digest can't be retrieved
+			result.Error = "invalid image reference"
+		} else if vulnerabilities, err := scanner.Scan(upgradeImage.Image); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Vulnerabilities = vulnerabilities
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// ScanThresholdError is returned when the scanned images have findings with severity greater than or equal to the threshold
+type ScanThresholdError struct {
+	Threshold severity.Severity
+	Findings  int
+}
+
+func (e *ScanThresholdError) Error() string {
+	return fmt.Sprintf("found %d vulnerabilities with severity %s or higher", e.Findings, e.Threshold)
+}
+
+func (e *ScanThresholdError) ExitCode() int {
+	return ScanFailedExitCode
+}
+
+// CheckScanThreshold returns a ScanThresholdError if the results contain findings reaching the threshold
+func CheckScanThreshold(results []ImageScanResult, threshold severity.Severity) error {
+	findings := 0
+	for _, result := range results {
+		for _, vulnerability := range result.Vulnerabilities {
+			if vulnerability.Severity.AtLeast(threshold) {
+				findings++
+			}
+		}
+	}
+	if findings > 0 {
+		return &ScanThresholdError{Threshold: threshold, Findings: findings}
+	}
+	return nil
+}
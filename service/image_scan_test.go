@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"upgrade-cli/flag/severity"
+)
+
+type fakeScanner map[string][]Vulnerability
+
+func (s fakeScanner) Scan(image string) ([]Vulnerability, error) {
+	vulnerabilities, ok := s[image]
+	if !ok {
+		return nil, errors.New("image not found")
+	}
+	return vulnerabilities, nil
+}
+
+func TestParseTrivyReport(t *testing.T) {
+	report := `{"Results": [{"Target": "entando/app-builder:7.1.2 (alpine 3.16.2)", "Vulnerabilities": [
+		{"VulnerabilityID": "CVE-2022-1234", "PkgName": "openssl", "InstalledVersion": "1.1.1", "FixedVersion": "1.1.2", "Severity": "HIGH"},
+		{"VulnerabilityID": "CVE-2022-5678", "PkgName": "zlib", "InstalledVersion": "1.2.11", "Severity": "NEGLIGIBLE"}]},
+		{"Target": "Java"}]}`
+
+	vulnerabilities, err := parseTrivyReport([]byte(report))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(vulnerabilities) != 2 || vulnerabilities[0].Severity != severity.High || vulnerabilities[1].Severity != severity.Unknown ||
+		vulnerabilities[0].FixedVersion != "1.1.2" {
+		t.Fatalf("unexpected vulnerabilities %+v", vulnerabilities)
+	}
+}
+
+func TestScanImages(t *testing.T) {
+	upgradeImages := []UpgradeImage{
+		{Component: "AppBuilder", Image: "registry.hub.docker.com/entando/app-builder:7.1.2"},
+		{Component: "DeApp", Image: "registry.hub.docker.com/entando/entando-de-app-eap:7.1.2"},
+		{Component: "Keycloak", Image: "ERROR: <unable to fetch digest of: registry.hub.docker.com/entando/entando-keycloak:foo>"},
+	}
+
+	scanner := fakeScanner{
+		"registry.hub.docker.com/entando/app-builder:7.1.2": {
+			{ID: "CVE-1", Severity: severity.Medium}, {ID: "CVE-2", Severity: severity.Medium}, {ID: "CVE-3", Severity: severity.High},
+		},
+		"registry.hub.docker.com/entando/entando-de-app-eap:7.1.2": {},
+	}
+
+	results := ScanImages(scanner, upgradeImages)
+	if len(results) != 3 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for _, result := range results {
+		switch result.Component {
+		case "AppBuilder":
+			if counts := result.CountBySeverity(); counts[severity.Medium] != 2 || counts[severity.High] != 1 {
+				t.Fatalf("unexpected counts %v", counts)
+			}
+		case "Keycloak":
+			if result.Error == "" {
+				t.Fatalf("the placeholder should not be scanned")
+			}
+		}
+	}
+
+	if err := CheckScanThreshold(results, severity.Critical); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if err := CheckScanThreshold(results, severity.None); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	err := CheckScanThreshold(results, severity.Medium)
+	var thresholdErr *ScanThresholdError
+	if !errors.As(err, &thresholdErr) || thresholdErr.Findings != 3 || thresholdErr.ExitCode() != ScanFailedExitCode {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
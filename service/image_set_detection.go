@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// GetInstalledCustomImageSetType retrieves the custom image set used by the current installation.
+// It returns an empty string if no custom image set is registered or used.
+func GetInstalledCustomImageSetType() imagesettype.ImageSetType {
+	if !hasCustomImageSetTypes() {
+		return ""
+	}
+
+	// the EntandoAppV2 may not exist yet, in this case only the deployments are checked
+	currentApp, _ := GetEntandoApp()
+
+	deployments, err := GetDeployments()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to detect the image set of the installation: %s\n", err.Error())
+		return ""
+	}
+
+	return DetectCustomImageSetType(currentApp, deployments)
+}
+
+// DetectCustomImageSetType returns the custom image set selected in the current EntandoAppV2 or, if not set,
+// the one whose images are used by the deployments. It returns an empty string if no custom image set is found.
+func DetectCustomImageSetType(currentApp *images.EntandoApp, deployments []appsv1.Deployment) imagesettype.ImageSetType {
+	if currentApp != nil {
+		if imageSetType := imagesettype.ImageSetType(currentApp.Spec.ImageSetType); imagesettype.IsCustom(imageSetType) {
+			return imageSetType
+		}
+	}
+
+	for _, deployment := range deployments {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			for _, imageInfo := range images.EntandoImages {
+				for _, imageSetType := range images.GetImageSetTypesOf(container.Image, imageInfo) {
+					if imagesettype.IsCustom(imageSetType) {
+						return imageSetType
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func hasCustomImageSetTypes() bool {
+	for _, value := range imagesettype.GetImageSetTypeValues() {
+		if imagesettype.IsCustom(imagesettype.ImageSetType(value)) {
+			return true
+		}
+	}
+	return false
+}
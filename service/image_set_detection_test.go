@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestDetectCustomImageSetType(t *testing.T) {
+
+	currentApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	currentApp.Spec.ImageSetType = "Hardened"
+
+	if imageSetType := DetectCustomImageSetType(currentApp, nil); imageSetType != "Hardened" {
+		t.Fatalf("expected Hardened image set, found %s", imageSetType)
+	}
+
+	currentApp.Spec.ImageSetType = string(imagesettype.Community)
+	if imageSetType := DetectCustomImageSetType(currentApp, nil); imageSetType != "" {
+		t.Fatalf("expected no custom image set, found %s", imageSetType)
+	}
+
+	// without imageSetType in the EntandoAppV2 the image set is detected from the deployed images
+	if err := images.RegisterImageSet(images.ImageSetDescriptor{Name: "Hardened", Registry: "registry.example.com/entando-hardened"}); err != nil {
+		t.Fatalf("unable to register image set: %s", err.Error())
+	}
+	deployments := []appsv1.Deployment{mkComponentDeployment("my-app-ab-deployment", "registry.example.com/entando-hardened/app-builder:7.1.1", 1)}
+	currentApp.Spec.ImageSetType = ""
+	if imageSetType := DetectCustomImageSetType(currentApp, deployments); imageSetType != "Hardened" {
+		t.Fatalf("expected Hardened image set detected from the deployments, found %s", imageSetType)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+
+	"sigs.k8s.io/yaml"
+)
+
+const downloadTimeout = 30 * time.Second
+
+// client used to download the release notes and the release manifests
+var downloadClient = &http.Client{Timeout: downloadTimeout}
+
+// LoadImagesFile reads a YAML file mapping the components (by name or image override flag) to their image overrides
+// and returns the overrides indexed by component name
+func LoadImagesFile(fileName string) (map[string]string, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read images file %s. %s", fileName, err.Error())
+	}
+
+	values := map[string]string{}
+	if err := yaml.UnmarshalStrict(content, &values); err != nil {
+		return nil, fmt.Errorf("unable to parse images file %s. %s", fileName, err.Error())
+	}
+
+	overrides := map[string]string{}
+	for key, value := range values {
+		imageInfo := findImageInfoByNameOrFlag(key)
+		if imageInfo == nil {
+			return nil, fmt.Errorf("unknown component %s in images file %s", key, fileName)
+		}
+		overrides[imageInfo.ComponentName] = value
+	}
+	return overrides, nil
+}
+
+func findImageInfoByNameOrFlag(key string) *images.EntandoImageInfo {
+	for i, imageInfo := range images.EntandoImages {
+		if strings.EqualFold(imageInfo.ComponentName, key) || imageInfo.ImageOverrideFlag == key {
+			return &images.EntandoImages[i]
+		}
+	}
+	return nil
+}
+
+// LoadReleaseNotesImages reads the image list published with the Entando release notes from a file or an HTTP(S) URL
+// and returns the images of the known components indexed by component name
+func LoadReleaseNotesImages(location string, imageSetType imagesettype.ImageSetType) (map[string]string, error) {
+	var content []byte
+	var err error
+
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		content, err = download(location)
+	} else {
+		content, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read release notes %s. %s", location, err.Error())
+	}
+
+	overrides := ParseReleaseNotesImages(string(content), imageSetType)
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("no images of Entando components found in release notes %s", location)
+	}
+	return overrides, nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ParseReleaseNotesImages extracts the image references of the Entando components from the release notes image list.
+// The list contains a reference per line, optionally formatted as a Markdown list item or table row, e.g.
+//
+//	| ComponentManager | entando/entando-component-manager:7.1.2 |
+//	* `entando/app-builder:7.1.2`
+//
+// References without tag or digest and images of unknown components are ignored. When the list contains the images of
+// several image sets for a component (e.g. the Wildfly and EAP DeApp), the one of the selected image set is used.
+func ParseReleaseNotesImages(content string, imageSetType imagesettype.ImageSetType) map[string]string {
+	overrides := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '|' || r == '`' || r == '*' || r == ','
+		})
+		for _, field := range fields {
+			imageRef, err := images.ParseImage(field)
+			if err != nil || !strings.Contains(imageRef.Path, "/") || (imageRef.Tag == "" && imageRef.Digest == "") {
+				continue
+			}
+			imageInfo := findImageInfoByRepo(imageRef.Repo())
+			if imageInfo == nil {
+				continue
+			}
+			selectedRepo := images.ExtractRepo(imageInfo.GetDefaultImage(imageSetType))
+			if _, found := overrides[imageInfo.ComponentName]; !found || imageRef.Repo() == selectedRepo {
+				overrides[imageInfo.ComponentName] = field
+			}
+		}
+	}
+	return overrides
+}
+
+func findImageInfoByRepo(repo string) *images.EntandoImageInfo {
+	for i, imageInfo := range images.EntandoImages {
+		for _, defaultRepo := range imageInfo.GetDefaultRepos() {
+			if defaultRepo == repo {
+				return &images.EntandoImages[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	imagesettype "upgrade-cli/flag/image_set_type"
+)
+
+func TestParseReleaseNotesImages(t *testing.T) {
+
+	releaseNotes := "## Images\n\n" +
+		"- `entando/app-builder:7.1.2`\n" +
+		"* registry.hub.docker.com/entando/entando-component-manager:7.1.2\n" +
+		"| DeApp | entando/entando-de-app-eap:7.1.2 |\n" +
+		"| DeApp | entando/entando-de-app-wildfly:7.1.2 |\n" +
+		"- entando/entando-k8s-controller-coordinator:7.1.2\n" +
+		"- entando/app-builder (no tag)\n"
+
+	overrides := ParseReleaseNotesImages(releaseNotes, imagesettype.RedhatCertified)
+
+	expected := map[string]string{
+		"AppBuilder":       "entando/app-builder:7.1.2",
+		"ComponentManager": "registry.hub.docker.com/entando/entando-component-manager:7.1.2",
+		"DeApp":            "entando/entando-de-app-eap:7.1.2",
+	}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Fatalf("unexpected overrides %v", overrides)
+	}
+
+	overrides = ParseReleaseNotesImages(releaseNotes, imagesettype.Community)
+	if overrides["DeApp"] != "entando/entando-de-app-wildfly:7.1.2" {
+		t.Fatalf("expected the Community DeApp image, found %s", overrides["DeApp"])
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"upgrade-cli/util/sys/spawn"
+)
+
+// KubectlConfig describes the resolved kubectl base command and the cluster it targets
+type KubectlConfig struct {
+	// words of the base command, after the shell-style parsing
+	Command []string
+	// path of the executable
+	Path      string
+	Namespace string
+	Context   string
+	Timeout   time.Duration
+}
+
+// GetKubectlConfig resolves the base kubectl command and retrieves the namespace and the context it uses.
+// The namespace and the context set in the base command take precedence over the kubeconfig ones.
+func GetKubectlConfig() (*KubectlConfig, error) {
+	words, err := getKubectlCommandWords()
+	if err != nil {
+		return nil, err
+	}
+	path, _ := spawn.DefaultRunner.LookPath(words[0])
+	timeout, err := getKubectlTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	config := KubectlConfig{Command: words, Path: path, Timeout: timeout}
+
+	config.Context = findFlagValue(words[1:], "", "context")
+	if config.Context == "" {
+		stdout, err := runKubectl("config", "current-context")
+		if err != nil {
+			return nil, err
+		}
+		config.Context = strings.TrimSpace(stdout)
+	}
+
+	config.Namespace = findFlagValue(words[1:], "n", "namespace")
+	if config.Namespace == "" {
+		stdout, err := runKubectl("config", "view", "--minify", "-o", "jsonpath={..namespace}")
+		if err != nil {
+			return nil, err
+		}
+		config.Namespace = strings.TrimSpace(stdout)
+	}
+	if config.Namespace == "" {
+		config.Namespace = "default"
+	}
+
+	return &config, nil
+}
+
+// findFlagValue returns the value of the flag with the given short (if not empty) or long name, or an empty string
+func findFlagValue(args []string, shortName, longName string) string {
+	names := []string{"--" + longName}
+	if shortName != "" {
+		names = append(names, "-"+shortName)
+	}
+	for i, arg := range args {
+		for _, name := range names {
+			if arg == name && i+1 < len(args) {
+				return args[i+1]
+			}
+			if strings.HasPrefix(arg, name+"=") {
+				return strings.TrimPrefix(arg, name+"=")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// GetDeployments retrieves all the deployments of the namespace
+func GetDeployments() ([]appsv1.Deployment, error) {
+	deployments := appsv1.DeploymentList{}
+	if err := getResource(&deployments, "deployments"); err != nil {
+		return nil, err
+	}
+	return deployments.Items, nil
+}
+
+// GetPods retrieves all the pods of the namespace
+func GetPods() ([]corev1.Pod, error) {
+	pods := corev1.PodList{}
+	if err := getResource(&pods, "pods"); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// GetPersistentVolumeClaims retrieves all the persistent volume claims of the namespace
+func GetPersistentVolumeClaims() ([]corev1.PersistentVolumeClaim, error) {
+	pvcs := corev1.PersistentVolumeClaimList{}
+	if err := getResource(&pvcs, "persistentvolumeclaims"); err != nil {
+		return nil, err
+	}
+	return pvcs.Items, nil
+}
+
+// getResource runs kubectl get with JSON output and decodes the result in the given object
+func getResource(into interface{}, getArgs ...interface{}) error {
+	args := append([]interface{}{"get"}, getArgs...)
+	args = append(args, "-o", "json")
+
+	stdout, err := runKubectl(args...)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve %v: %s", getArgs, err.Error())
+	}
+
+	if err := json.Unmarshal([]byte(stdout), into); err != nil {
+		return fmt.Errorf("unable to parse %v: %s", getArgs, err.Error())
+	}
+
+	return nil
+}
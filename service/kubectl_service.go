@@ -1,24 +1,51 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 	"upgrade-cli/common"
 	operatormode "upgrade-cli/flag/operator_mode"
+	"upgrade-cli/util/images"
+	"upgrade-cli/util/shellwords"
 	"upgrade-cli/util/sys/spawn"
 
 	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
 )
 
 const (
 	kubectlBaseCommandEnv  = "ENTANDO_CLI_KUBECTL_COMMAND"
+	defaultKubectlCommand  = "kubectl"
+	kubectlTimeoutEnv      = "ENTANDO_CLI_KUBECTL_TIMEOUT"
+	defaultKubectlTimeout  = 10 * time.Minute
 	operatorDeploymentType = "ENTANDO_K8S_OPERATOR_DEPLOYMENT_TYPE"
 )
 
+// KubeConfigFlags are the standard kubeconfig, context and namespace flags, bound to the root command.
+// They are appended to the base kubectl command unless it already sets the same options.
+var KubeConfigFlags = NewKubeConfigFlags()
+
+// NewKubeConfigFlags returns the kubectl flags supported by the CLI, all empty by default
+func NewKubeConfigFlags() *genericclioptions.ConfigFlags {
+	kubeConfig, context, namespace := "", "", ""
+	return &genericclioptions.ConfigFlags{
+		KubeConfig: &kubeConfig,
+		Context:    &context,
+		Namespace:  &namespace,
+	}
+}
+
 // CreateEntandoApp sends the CR creation request to the cluster.
 // If force is set to true an existing resource will be overwritten
 func CreateEntandoApp(fileName string, force bool) error {
@@ -27,11 +54,6 @@ func CreateEntandoApp(fileName string, force bool) error {
 		return fmt.Errorf("file %s doesn't exist", fileName)
 	}
 
-	baseCmd, args, err := getKubectlBaseCommand()
-	if err != nil {
-		return err
-	}
-
 	var kubectlCmd string
 	if force {
 		kubectlCmd = "apply"
@@ -39,55 +61,36 @@ func CreateEntandoApp(fileName string, force bool) error {
 		kubectlCmd = "create"
 	}
 
-	args = append(args, kubectlCmd, "-f", fileName)
-
-	output, err := spawn.Spawn(nil,
-		*baseCmd,
-		args,
-		spawn.Environ{},
-		spawn.Options{
-			WithSudo:      false,
-			CaptureStdout: true,
-			CaptureStderr: true,
-		},
-	)
-
-	if err != nil && len(output.Stderr) > 0 {
-		if !force && strings.Contains(output.Stderr, "AlreadyExists") {
+	if _, err := runKubectl(kubectlCmd, "-f", fileName); err != nil {
+		if !force && strings.Contains(err.Error(), "AlreadyExists") {
 			return fmt.Errorf("resource already exists. You can overwrite it using the --force flag")
 		}
-		return fmt.Errorf("error creating the resource: %s", output.Stderr)
+		return fmt.Errorf("error creating the resource: %s", err.Error())
 	}
 
-	return err
+	return nil
 }
 
 // GetEntandoApp retrieves the EntandoAppV2 resource from the cluster
-func GetEntandoApp() (*v1alpha1.EntandoAppV2, error) {
-	baseCmd, args, err := getKubectlBaseCommand()
+func GetEntandoApp() (*images.EntandoApp, error) {
+	stdout, err := runKubectl("get", common.EntandoAppResourceName, "-o", "yaml")
 	if err != nil {
 		return nil, err
 	}
 
-	args = append(args, "get", common.EntandoAppResourceName, "-o", "yaml")
+	return parseEntandoAppV2(stdout)
+}
 
-	output, err := spawn.Spawn(nil,
-		*baseCmd,
-		args,
-		spawn.Environ{},
-		spawn.Options{
-			WithSudo:      false,
-			CaptureStdout: true,
-		},
-	)
-	if err != nil {
-		return nil, err
+// AnnotateEntandoApp sets an annotation on the EntandoAppV2 resource having the given name,
+// overwriting the previous value
+func AnnotateEntandoApp(name, key, value string) error {
+	if _, err := runKubectl("annotate", common.EntandoAppResourceName, name, "--overwrite", key+"="+value); err != nil {
+		return fmt.Errorf("error annotating the resource: %s", err.Error())
 	}
-
-	return parseEntandoAppV2(output.Stdout)
+	return nil
 }
 
-func parseEntandoAppV2(stdout string) (*v1alpha1.EntandoAppV2, error) {
+func parseEntandoAppV2(stdout string) (*images.EntandoApp, error) {
 
 	s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 
@@ -105,60 +108,207 @@ func parseEntandoAppV2(stdout string) (*v1alpha1.EntandoAppV2, error) {
 		return nil, fmt.Errorf("found multiple resources of type %s", common.EntandoAppResourceName)
 	}
 
-	return &entandoApps.Items[0], nil
+	// the list contains a single item, whose image overrides not part of the EntandoAppV2 API are read from the generic content
+	genericList := struct {
+		Items []map[string]interface{} `json:"items"`
+	}{}
+	if err := yaml.Unmarshal([]byte(stdout), &genericList); err != nil {
+		return nil, err
+	}
+	entandoApp := images.NewEntandoApp(&entandoApps.Items[0])
+	images.LoadExtraOverrides(entandoApp, genericList.Items[0])
+
+	return entandoApp, nil
 }
 
-// GetOperatorMode retrieves the OperatorMode from the cluster
-// It reads the related environment variable inside entando-operator deployment spec
+// GetOperatorMode retrieves the OperatorMode from the cluster.
+// OLM is detected looking for the Entando Subscription and ClusterServiceVersion in the namespace, reporting their state.
+// If they are not found the related environment variable inside entando-operator deployment spec is read.
 func GetOperatorMode() (operatormode.OperatorMode, error) {
+	installation, err := GetOlmInstallation()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to inspect the OLM resources: %s\n", err.Error())
+	}
+	if installation != nil {
+		for _, line := range installation.Lines() {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		return operatormode.OLM, nil
+	}
+
+	deployment := appsv1.Deployment{}
+	if err := getResource(&deployment, "deployment", EntandoOperatorName); err != nil {
+		return operatormode.Auto, fmt.Errorf("unable to retrieve the operator mode from the deployment: %s", err.Error())
+	}
+
+	mode, value := getOperatorModeFromEnv(&deployment)
+	if mode == operatormode.Auto {
+		return operatormode.Auto, fmt.Errorf("unable to retrieve the operator mode from the deployment.\nUnexpected value for %s: %s", operatorDeploymentType, value)
+	}
+	return mode, nil
+}
+
+// getOperatorModeFromEnv reads the deployment type environment variable from any container of the operator deployment.
+// It returns Auto and the found value if the value is not recognized.
+func getOperatorModeFromEnv(deployment *appsv1.Deployment) (operatormode.OperatorMode, string) {
+	var value string
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == operatorDeploymentType {
+				value = env.Value
+			}
+		}
+	}
+
+	switch strings.ToLower(value) {
+	case "olm":
+		return operatormode.OLM, value
+	case "helm", "plain":
+		return operatormode.Plain, value
+	default:
+		return operatormode.Auto, value
+	}
+}
+
+// applyObject applies the given object to the cluster, using a temporary manifest file
+func applyObject(obj runtime.Object) error {
+	file, err := os.CreateTemp("", "entando-upgrade-resource")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	yamlPrinter := printers.YAMLPrinter{}
+	err = yamlPrinter.PrintObj(obj, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = runKubectl("apply", "-f", file.Name())
+	return err
+}
+
+// runKubectl executes the base kubectl command with the given arguments and returns the captured standard output.
+// In case of failure the returned error contains the standard error of the command.
+func runKubectl(kubectlArgs ...interface{}) (string, error) {
+	return runKubectlWithStdin(nil, kubectlArgs...)
+}
+
+// runKubectlWithStdin works like runKubectl, providing the given reader (if not nil) as the command standard input
+func runKubectlWithStdin(stdin io.Reader, kubectlArgs ...interface{}) (string, error) {
+	timeout, err := getKubectlTimeout()
+	if err != nil {
+		return "", err
+	}
+	return runKubectlContext(context.Background(), timeout, stdin, kubectlArgs...)
+}
+
+// runKubectlContext works like runKubectlWithStdin, killing the command when the context is done
+// or when the timeout (if greater than 0) expires
+func runKubectlContext(ctx context.Context, timeout time.Duration, stdin io.Reader, kubectlArgs ...interface{}) (string, error) {
 	baseCmd, args, err := getKubectlBaseCommand()
 	if err != nil {
-		return operatormode.Auto, err
+		return "", err
 	}
 
-	jsonPath := "jsonpath='{.spec.template.spec.containers[0].env[?(@.name == \"" + operatorDeploymentType + "\")].value}'"
-	args = append(args, "get", "deploy", "entando-operator", "-o", jsonPath)
+	args = append(args, kubectlArgs...)
 
-	output, err := spawn.Spawn(nil,
+	output, err := spawn.Spawn(ctx,
 		*baseCmd,
 		args,
 		spawn.Environ{},
 		spawn.Options{
 			WithSudo:      false,
 			CaptureStdout: true,
+			CaptureStderr: true,
+			Stdin:         stdin,
+			Timeout:       timeout,
 		},
 	)
 	if err != nil {
-		return operatormode.Auto, fmt.Errorf("unable to retrieve the operator mode from the deployment: %s", err.Error())
+		if stderr := strings.TrimSpace(output.Stderr); stderr != "" {
+			return output.Stdout, errors.New(stderr)
+		}
+		return output.Stdout, err
 	}
 
-	parsedMode := strings.Trim(output.Stdout, "'")
+	return output.Stdout, nil
+}
 
-	switch parsedMode {
-	case "olm":
-		return operatormode.OLM, nil
-	case "helm":
-		return operatormode.Plain, nil
-	default:
-		return operatormode.Auto, fmt.Errorf("unable to retrieve the operator mode from the deployment.\nUnexpected value for %s: %s", operatorDeploymentType, parsedMode)
+// getKubectlTimeout returns the maximum duration of the kubectl commands, that can be customized
+// using the related environment variable (0 disables the timeout)
+func getKubectlTimeout() (time.Duration, error) {
+	value := os.Getenv(kubectlTimeoutEnv)
+	if value == "" {
+		return defaultKubectlTimeout, nil
 	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s' of the environment variable %s. %s", value, kubectlTimeoutEnv, err.Error())
+	}
+	return timeout, nil
 }
 
 // getKubectlBaseCommand returns the base kubectl command parsed from the related environment variable
 // and converted in the format required by the spawn.Spawn function
 func getKubectlBaseCommand() (*string, []interface{}, error) {
 
+	words, err := getKubectlCommandWords()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kubectlArgs []interface{}
+	for _, word := range words[1:] {
+		kubectlArgs = append(kubectlArgs, word)
+	}
+
+	return &words[0], kubectlArgs, nil
+}
+
+// getKubectlCommandWords splits the base kubectl command using the shell quoting rules, adds the kubeconfig flags
+// not already set and checks that its executable can be found.
+// If the environment variable is not set, a plain kubectl command is used.
+func getKubectlCommandWords() ([]string, error) {
 	kubectlBaseCmd := os.Getenv(kubectlBaseCommandEnv)
-	if kubectlBaseCmd == "" {
-		return nil, nil, fmt.Errorf("the environment variable %s must be set", kubectlBaseCommandEnv)
+	if strings.TrimSpace(kubectlBaseCmd) == "" {
+		kubectlBaseCmd = defaultKubectlCommand
 	}
 
-	parts := strings.Split(kubectlBaseCmd, " ")
+	words, err := shellwords.Split(kubectlBaseCmd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of the environment variable %s: %s", kubectlBaseCommandEnv, err.Error())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("the environment variable %s must be set", kubectlBaseCommandEnv)
+	}
 
-	var kubectlArgs []interface{}
-	for i := 1; i < len(parts); i = i + 1 {
-		kubectlArgs = append(kubectlArgs, parts[i])
+	if _, err := spawn.DefaultRunner.LookPath(words[0]); err != nil {
+		return nil, fmt.Errorf("the executable %s of the environment variable %s was not found: %s", words[0], kubectlBaseCommandEnv, err.Error())
 	}
 
-	return &parts[0], kubectlArgs, nil
+	return append(words, getKubeConfigArgs(words[1:])...), nil
+}
+
+// getKubeConfigArgs returns the arguments of the kubeconfig flags that are set and not already present in the given
+// base arguments, since the options provided by the ent wrapper take precedence
+func getKubeConfigArgs(baseArgs []string) []string {
+	args := []string{}
+	flags := []struct {
+		shortName string
+		longName  string
+		value     *string
+	}{
+		{"", "kubeconfig", KubeConfigFlags.KubeConfig},
+		{"", "context", KubeConfigFlags.Context},
+		{"n", "namespace", KubeConfigFlags.Namespace},
+	}
+	for _, flag := range flags {
+		if flag.value == nil || *flag.value == "" || findFlagValue(baseArgs, flag.shortName, flag.longName) != "" {
+			continue
+		}
+		args = append(args, "--"+flag.longName+"="+*flag.value)
+	}
+	return args
 }
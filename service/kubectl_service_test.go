@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"upgrade-cli/util/sys/spawn"
+)
+
+func TestRunKubectl(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "kubectl -n entando")
+	t.Setenv(kubectlTimeoutEnv, "30s")
+
+	fake, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		if cmd.RawArgs()[2] == "delete" {
+			return spawn.Res{Stderr: "Error from server (Forbidden)\n"}, errors.New("exit status 1")
+		}
+		return spawn.Res{Stdout: "ok"}, nil
+	})
+	defer restore()
+
+	if stdout, err := runKubectl("get", "pods"); err != nil || stdout != "ok" {
+		t.Fatalf("unexpected result %s %v", stdout, err)
+	}
+	if _, err := runKubectl("delete", "pod", "foo"); err == nil || err.Error() != "Error from server (Forbidden)" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	command := fake.Commands[0]
+	if command.String() != "kubectl -n entando get pods" || command.Options.Timeout != 30*time.Second {
+		t.Fatalf("unexpected command %s %+v", command, command.Options)
+	}
+
+	t.Setenv(kubectlTimeoutEnv, "soon")
+	if _, err := runKubectl("get", "pods"); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+func TestGetKubectlConfig(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, `kubectl --context=prod "--namespace" 'entando apps'`)
+	t.Setenv(kubectlTimeoutEnv, "")
+
+	fake, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		return spawn.Res{}, errors.New("unexpected command")
+	})
+	defer restore()
+
+	config, err := GetKubectlConfig()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.Context != "prod" || config.Namespace != "entando apps" || config.Timeout != defaultKubectlTimeout || len(fake.Commands) != 0 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	t.Setenv(kubectlBaseCommandEnv, "kubectl")
+	_, restore = spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		if cmd.RawArgs()[1] == "current-context" {
+			return spawn.Res{Stdout: "dev\n"}, nil
+		}
+		return spawn.Res{}, nil
+	})
+	defer restore()
+
+	config, err = GetKubectlConfig()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.Context != "dev" || config.Namespace != "default" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+}
+
+func TestKubeConfigFlags(t *testing.T) {
+	t.Setenv(kubectlBaseCommandEnv, "")
+
+	fake, restore := spawn.UseFakeRunner(func(cmd spawn.Command) (spawn.Res, error) {
+		return spawn.Res{}, nil
+	})
+	defer restore()
+
+	defaultFlags := KubeConfigFlags
+	defer func() { KubeConfigFlags = defaultFlags }()
+	KubeConfigFlags = NewKubeConfigFlags()
+	*KubeConfigFlags.KubeConfig = "/tmp/kubeconfig"
+	*KubeConfigFlags.Namespace = "entando"
+
+	runKubectl("get", "pods")
+	if command := fake.Commands[0].String(); command != "kubectl --kubeconfig=/tmp/kubeconfig --namespace=entando get pods" {
+		t.Fatalf("unexpected command %s", command)
+	}
+
+	// the options set by the ent wrapper take precedence
+	t.Setenv(kubectlBaseCommandEnv, "kubectl -n test --context=dev")
+	*KubeConfigFlags.Context = "prod"
+
+	runKubectl("get", "pods")
+	if command := fake.Commands[1].String(); command != "kubectl -n test --context=dev --kubeconfig=/tmp/kubeconfig get pods" {
+		t.Fatalf("unexpected command %s", command)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	legacyEntandoAppResource = "entandoapps.entando.org"
+	legacyEntandoAppKind     = "EntandoApp"
+)
+
+// LegacyEntandoApp contains the fields of the EntandoApp (v1) resource created by the older operator used by the CLI
+type LegacyEntandoApp struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              LegacyEntandoAppSpec `json:"spec"`
+}
+
+type LegacyEntandoAppSpec struct {
+	Dbms                string `json:"dbms,omitempty"`
+	StandardServerImage string `json:"standardServerImage,omitempty"`
+	CustomServerImage   string `json:"customServerImage,omitempty"`
+	IngressHostName     string `json:"ingressHostName,omitempty"`
+	IngressPath         string `json:"ingressPath,omitempty"`
+	// all the fields of the spec, including the ones not listed above
+	Fields map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and keeps all the fields of the spec
+func (s *LegacyEntandoAppSpec) UnmarshalJSON(data []byte) error {
+	type plainSpec LegacyEntandoAppSpec
+	if err := json.Unmarshal(data, (*plainSpec)(s)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.Fields)
+}
+
+type legacyEntandoAppList struct {
+	Items []LegacyEntandoApp `json:"items"`
+}
+
+// GetLegacyEntandoApp retrieves the EntandoApp (v1) resource from the cluster.
+// It returns nil if the resource type is not installed or no resource exists in the namespace.
+func GetLegacyEntandoApp() (*LegacyEntandoApp, error) {
+	entandoApps := legacyEntandoAppList{}
+	if err := getResource(&entandoApps, legacyEntandoAppResource); err != nil {
+		if strings.Contains(err.Error(), missingResourceTypeError) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(entandoApps.Items) == 0 {
+		return nil, nil
+	}
+	if len(entandoApps.Items) > 1 {
+		return nil, fmt.Errorf("found multiple resources of type %s", legacyEntandoAppKind)
+	}
+	return &entandoApps.Items[0], nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"upgrade-cli/common"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+	"upgrade-cli/util/version"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	deAppComponent           = "DeApp"
+	eapServerImage           = "eap"
+	defaultLegacyIngressPath = "/entando-de-app"
+)
+
+// reasons of the legacy fields that can't be mapped, the other ones are reported as not supported
+var unmappedFieldReasons = map[string]string{
+	"dbms":                 "database settings are not part of the EntandoAppV2 API",
+	"tlsSecretName":        "TLS settings are not part of the EntandoAppV2 API",
+	"ingressPath":          "custom ingress paths are not supported",
+	"replicas":             "the number of replicas is managed by the operator",
+	"environmentVariables": "environment variables are not part of the EntandoAppV2 API",
+	"resourceRequirements": "resource requirements are not part of the EntandoAppV2 API",
+}
+
+// UnmappedField is a field of the legacy EntandoApp that has no equivalent in the EntandoAppV2 spec
+type UnmappedField struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+// Migration is the result of the mapping of a legacy EntandoApp (v1) to an EntandoAppV2
+type Migration struct {
+	Source     *LegacyEntandoApp
+	EntandoApp *images.EntandoApp
+	Unmapped   []UnmappedField
+}
+
+// GetMigration reads the legacy EntandoApp from the cluster and maps it to an EntandoAppV2.
+// If the version is empty, it is determined from the tag of the Entando DeApp image or of the entando-operator.
+// An error is returned if the namespace doesn't contain a legacy EntandoApp or already contains an EntandoAppV2.
+func GetMigration(targetVersion string, olm bool) (*Migration, error) {
+	if _, err := GetEntandoApp(); err == nil {
+		return nil, fmt.Errorf("a resource of type %s already exists, use the upgrade command instead", common.EntandoAppResourceName)
+	}
+
+	legacyApp, err := GetLegacyEntandoApp()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve the %s resource. %s", legacyEntandoAppKind, err.Error())
+	}
+	if legacyApp == nil {
+		return nil, fmt.Errorf("no resource of type %s found", legacyEntandoAppKind)
+	}
+
+	if targetVersion == "" {
+		targetVersion = getLegacyAppVersion()
+		if targetVersion == "" {
+			return nil, fmt.Errorf("unable to determine the version of the %s %s, please provide it explicitly", legacyEntandoAppKind, legacyApp.Name)
+		}
+	}
+
+	migration := MigrateLegacyEntandoApp(legacyApp, targetVersion, olm)
+
+	if migration.EntandoApp.Spec.IngressHostName == "" {
+		host, err := discoverIngressHostName(legacyApp.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to discover the ingress host name: %s\n", err.Error())
+		}
+		migration.EntandoApp.Spec.IngressHostName = host
+	}
+
+	return migration, nil
+}
+
+// getLegacyAppVersion returns the tag of the running DeApp image, if it's an Entando image, or the version of the
+// entando-operator. The tags of custom images (e.g. the customServerImage) are not related to the Entando version.
+func getLegacyAppVersion() string {
+	deployments, err := GetDeployments()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to retrieve the deployments: %s\n", err.Error())
+		return ""
+	}
+	return findLegacyAppVersion(deployments)
+}
+
+func findLegacyAppVersion(deployments []appsv1.Deployment) string {
+	if imageInfo := images.GetImageInfo(deAppComponent); imageInfo != nil {
+		defaultRepos := imageInfo.GetDefaultRepos()
+		if deployment, image := findComponentDeployment(deployments, defaultRepos); deployment != nil {
+			if tag := images.ExtractTag(image); isVersion(tag) {
+				return tag
+			}
+		}
+	}
+
+	for _, operator := range FindOperators(deployments) {
+		if operator.Name == EntandoOperatorName && isVersion(operator.Version) {
+			return operator.Version
+		}
+	}
+	return ""
+}
+
+func isVersion(value string) bool {
+	if value == "" {
+		return false
+	}
+	_, err := version.Parse(value)
+	return err == nil
+}
+
+// MigrateLegacyEntandoApp maps the version, the image overrides and the ingress of the legacy EntandoApp
+// to an EntandoAppV2 spec and reports the fields that can't be mapped, sorted by name
+func MigrateLegacyEntandoApp(legacyApp *LegacyEntandoApp, targetVersion string, olm bool) *Migration {
+	spec := legacyApp.Spec
+
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoApp.Spec.Version = targetVersion
+	entandoApp.Spec.EntandoAppName = legacyApp.Name
+	entandoApp.Spec.IngressHostName = spec.IngressHostName
+	entandoApp.Spec.ImageSetType = string(getLegacyImageSetType(spec.StandardServerImage, olm))
+
+	if spec.CustomServerImage != "" {
+		if imageInfo := images.GetImageInfo(deAppComponent); imageInfo != nil {
+			*imageInfo.GetImageOverride(entandoApp) = spec.CustomServerImage
+		}
+	}
+
+	migration := Migration{Source: legacyApp, EntandoApp: entandoApp, Unmapped: []UnmappedField{}}
+
+	for field, value := range spec.Fields {
+		if isMappedLegacyField(field, value) {
+			continue
+		}
+		reason, ok := unmappedFieldReasons[field]
+		if !ok {
+			reason = "not supported by the EntandoAppV2 API"
+		}
+		migration.Unmapped = append(migration.Unmapped, UnmappedField{Field: "spec." + field, Value: encodeLegacyValue(value), Reason: reason})
+	}
+	sort.Slice(migration.Unmapped, func(i, j int) bool { return migration.Unmapped[i].Field < migration.Unmapped[j].Field })
+
+	return &migration
+}
+
+// encodeLegacyValue returns the JSON value of an unmapped field with the sensitive values redacted, since fields like
+// environmentVariables can contain literal credentials that must not end up in terminal or CI logs
+func encodeLegacyValue(value interface{}) string {
+	encodedValue, _ := json.Marshal(redactLegacyValue(value, false))
+	return string(encodedValue)
+}
+
+// redactLegacyValue replaces the values of the keys that look like a password, a token or a secret and the values
+// of the environment variables having such names, including the nested ones. Strings are also passed through RedactSecrets, to redact
+// credentials embedded in values like JDBC URLs.
+func redactLegacyValue(value interface{}, sensitive bool) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		name, _ := typedValue["name"].(string)
+		redacted := map[string]interface{}{}
+		for key, item := range typedValue {
+			redacted[key] = redactLegacyValue(item, sensitive || sensitiveName.MatchString(key) || (key == "value" && sensitiveName.MatchString(name)))
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typedValue))
+		for i, item := range typedValue {
+			redacted[i] = redactLegacyValue(item, sensitive)
+		}
+		return redacted
+	case string:
+		if sensitive {
+			return redactedValue
+		}
+		return strings.TrimSuffix(string(RedactSecrets([]byte(typedValue))), "\n")
+	default:
+		if sensitive && value != nil {
+			return redactedValue
+		}
+		return value
+	}
+}
+
+// isMappedLegacyField returns true if the field is mapped to the EntandoAppV2 spec or has the default value
+func isMappedLegacyField(field string, value interface{}) bool {
+	switch field {
+	case "ingressHostName", "customServerImage", "standardServerImage":
+		return true
+	case "ingressPath":
+		return value == defaultLegacyIngressPath
+	case "replicas":
+		return value == float64(1)
+	default:
+		return value == nil
+	}
+}
+
+// getLegacyImageSetType maps the standard server image of the legacy EntandoApp to the image set type.
+// If it's not set, the image set type of the operator mode is used.
+func getLegacyImageSetType(standardServerImage string, olm bool) imagesettype.ImageSetType {
+	if standardServerImage == eapServerImage || (standardServerImage == "" && olm) {
+		return imagesettype.RedhatCertified
+	}
+	return imagesettype.Community
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const legacyEntandoApp = `{
+	"apiVersion": "entando.org/v1",
+	"kind": "EntandoApp",
+	"metadata": {"name": "quickstart"},
+	"spec": {
+		"dbms": "postgresql",
+		"standardServerImage": "eap",
+		"customServerImage": "registry.example.com/entando/my-de-app:7.1.1",
+		"ingressHostName": "quickstart.example.com",
+		"ingressPath": "/entando-de-app",
+		"replicas": 1,
+		"tlsSecretName": "quickstart-tls"
+	}
+}`
+
+func TestMigrateLegacyEntandoApp(t *testing.T) {
+	legacyApp := LegacyEntandoApp{}
+	if err := json.Unmarshal([]byte(legacyEntandoApp), &legacyApp); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	migration := MigrateLegacyEntandoApp(&legacyApp, "7.1.1", false)
+
+	spec := migration.EntandoApp.Spec
+	if spec.Version != "7.1.1" || spec.EntandoAppName != "quickstart" || spec.IngressHostName != "quickstart.example.com" {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+	if spec.ImageSetType != "RedhatCertified" || spec.DeApp.ImageOverride != "registry.example.com/entando/my-de-app:7.1.1" {
+		t.Fatalf("unexpected images %+v", spec)
+	}
+
+	if len(migration.Unmapped) != 2 {
+		t.Fatalf("expected 2 unmapped fields, found %+v", migration.Unmapped)
+	}
+	if migration.Unmapped[0].Field != "spec.dbms" || migration.Unmapped[0].Value != `"postgresql"` {
+		t.Fatalf("unexpected unmapped field %+v", migration.Unmapped[0])
+	}
+	if migration.Unmapped[1].Field != "spec.tlsSecretName" || migration.Unmapped[1].Reason != unmappedFieldReasons["tlsSecretName"] {
+		t.Fatalf("unexpected unmapped field %+v", migration.Unmapped[1])
+	}
+
+	// the migrated values take precedence over the app settings
+	t.Setenv(EntandoAppNameEnv, "other-app")
+	t.Setenv(EntandoIngressHostNameEnv, "other.example.com")
+	fileName := filepath.Join(t.TempDir(), "entandoapp.yaml")
+	if err := GenerateCustomResource(fileName, migration.EntandoApp, false); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	content, _ := os.ReadFile(fileName)
+	if !strings.Contains(string(content), "entandoAppName: quickstart") || !strings.Contains(string(content), "ingressHostName: quickstart.example.com") {
+		t.Fatalf("migrated values not kept\n%s", content)
+	}
+}
+
+func TestMigrateLegacySecretsAreRedacted(t *testing.T) {
+	legacyApp := LegacyEntandoApp{}
+	content := `{"metadata": {"name": "quickstart"}, "spec": {
+		"environmentVariables": [
+			{"name": "DB_PASSWORD", "value": "s3cr3t"},
+			{"name": "SPRING_PROFILES_ACTIVE", "value": "default"},
+			{"name": "KEYCLOAK_CLIENT_SECRET", "valueFrom": {"secretKeyRef": {"name": "keycloak-secret", "key": "clientSecret"}}}
+		],
+		"datasource": {"username": "entando", "password": "adm1n", "url": "jdbc:postgresql://db?password=adm1n"}
+	}}`
+	if err := json.Unmarshal([]byte(content), &legacyApp); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	migration := MigrateLegacyEntandoApp(&legacyApp, "7.1.1", false)
+
+	if len(migration.Unmapped) != 2 {
+		t.Fatalf("expected 2 unmapped fields, found %+v", migration.Unmapped)
+	}
+	for _, field := range migration.Unmapped {
+		if strings.Contains(field.Value, "s3cr3t") || strings.Contains(field.Value, "adm1n") {
+			t.Fatalf("the value of %s is not redacted: %s", field.Field, field.Value)
+		}
+	}
+	envValue := migration.Unmapped[1].Value
+	if !strings.Contains(envValue, `"value":"default"`) || !strings.Contains(envValue, `"name":"KEYCLOAK_CLIENT_SECRET"`) {
+		t.Fatalf("unexpected redacted value %s", envValue)
+	}
+}
+
+func TestFindLegacyAppVersion(t *testing.T) {
+	customDeApp := mkComponentDeployment("quickstart-deployment", "registry.example.com/entando/my-de-app:7.1.1", 1)
+	entandoOperator := mkComponentDeployment(EntandoOperatorName, "entando/entando-k8s-controller-coordinator:7.1.3", 1)
+
+	// the tag of a custom DeApp image is not the Entando version
+	if appVersion := findLegacyAppVersion([]appsv1.Deployment{customDeApp, entandoOperator}); appVersion != "7.1.3" {
+		t.Fatalf("expected the operator version, found %s", appVersion)
+	}
+
+	deApp := mkComponentDeployment("quickstart-deployment", "entando/entando-de-app-eap:7.1.2", 1)
+	if appVersion := findLegacyAppVersion([]appsv1.Deployment{deApp, entandoOperator}); appVersion != "7.1.2" {
+		t.Fatalf("expected the DeApp version, found %s", appVersion)
+	}
+
+	if appVersion := findLegacyAppVersion([]appsv1.Deployment{customDeApp}); appVersion != "" {
+		t.Fatalf("expected no version, found %s", appVersion)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	olmSubscriptionResource     = "subscriptions.operators.coreos.com"
+	olmCSVResource              = "clusterserviceversions.operators.coreos.com"
+	olmOperatorGroupResource    = "operatorgroups.operators.coreos.com"
+	olmInstallPlanResource      = "installplans.operators.coreos.com"
+	entandoPackagePrefix        = "entando"
+	manualApproval              = "Manual"
+	subscriptionUpToDate        = "AtLatestKnown"
+	installPlanRequiresApproval = "RequiresApproval"
+	olmUpgradeTimeout           = 10 * time.Minute
+
+	// error returned by kubectl when the OLM CRDs are not installed
+	missingResourceTypeError = "the server doesn't have a resource type"
+)
+
+// Subscription contains the fields of the OLM Subscription resource used by the CLI
+type Subscription struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              SubscriptionSpec   `json:"spec"`
+	Status            SubscriptionStatus `json:"status"`
+}
+
+type SubscriptionSpec struct {
+	Package             string `json:"name"`
+	Channel             string `json:"channel"`
+	Source              string `json:"source"`
+	InstallPlanApproval string `json:"installPlanApproval"`
+	StartingCSV         string `json:"startingCSV"`
+}
+
+type SubscriptionStatus struct {
+	State        string `json:"state"`
+	CurrentCSV   string `json:"currentCSV"`
+	InstalledCSV string `json:"installedCSV"`
+}
+
+type subscriptionList struct {
+	Items []Subscription `json:"items"`
+}
+
+// ClusterServiceVersion contains the fields of the OLM ClusterServiceVersion resource used by the CLI
+type ClusterServiceVersion struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Version string `json:"version"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+type clusterServiceVersionList struct {
+	Items []ClusterServiceVersion `json:"items"`
+}
+
+type operatorGroupList struct {
+	Items []metav1.PartialObjectMetadata `json:"items"`
+}
+
+// InstallPlan contains the fields of the OLM InstallPlan resource used by the CLI
+type InstallPlan struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Approval                   string   `json:"approval"`
+		Approved                   bool     `json:"approved"`
+		ClusterServiceVersionNames []string `json:"clusterServiceVersionNames"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+type installPlanList struct {
+	Items []InstallPlan `json:"items"`
+}
+
+// OlmInstallation describes the OLM objects managing the Entando operator in the namespace
+type OlmInstallation struct {
+	Subscription   *Subscription
+	CSV            *ClusterServiceVersion
+	OperatorGroups []string
+	// manual InstallPlans of Entando CSVs waiting for approval
+	PendingInstallPlans []InstallPlan
+}
+
+// GetOlmInstallation looks for the OLM objects of the Entando operator in the namespace.
+// It returns nil if OLM is not installed in the cluster or the Entando operator is not managed by OLM.
+func GetOlmInstallation() (*OlmInstallation, error) {
+	csvs := clusterServiceVersionList{}
+	if err := getResource(&csvs, olmCSVResource); err != nil {
+		if strings.Contains(err.Error(), missingResourceTypeError) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	subscriptions := subscriptionList{}
+	if err := getResource(&subscriptions, olmSubscriptionResource); err != nil {
+		return nil, err
+	}
+	operatorGroups := operatorGroupList{}
+	if err := getResource(&operatorGroups, olmOperatorGroupResource); err != nil {
+		return nil, err
+	}
+	installPlans := installPlanList{}
+	if err := getResource(&installPlans, olmInstallPlanResource); err != nil {
+		return nil, err
+	}
+	return FindOlmInstallation(csvs.Items, subscriptions.Items, operatorGroups.Items, installPlans.Items), nil
+}
+
+// FindOlmInstallation correlates the OLM objects of the namespace with the Entando operator.
+// It returns nil if neither an Entando Subscription nor an Entando CSV is found.
+func FindOlmInstallation(csvs []ClusterServiceVersion, subscriptions []Subscription,
+	operatorGroups []metav1.PartialObjectMetadata, installPlans []InstallPlan) *OlmInstallation {
+
+	installation := OlmInstallation{}
+
+	for i, subscription := range subscriptions {
+		if strings.HasPrefix(subscription.Spec.Package, entandoPackagePrefix) {
+			installation.Subscription = &subscriptions[i]
+			break
+		}
+	}
+
+	for i, csv := range csvs {
+		if installation.Subscription != nil && installation.Subscription.Status.InstalledCSV != "" {
+			if csv.Name == installation.Subscription.Status.InstalledCSV {
+				installation.CSV = &csvs[i]
+				break
+			}
+		} else if strings.HasPrefix(csv.Name, entandoPackagePrefix) {
+			installation.CSV = &csvs[i]
+			break
+		}
+	}
+
+	if installation.Subscription == nil && installation.CSV == nil {
+		return nil
+	}
+
+	for _, operatorGroup := range operatorGroups {
+		installation.OperatorGroups = append(installation.OperatorGroups, operatorGroup.Name)
+	}
+
+	for _, installPlan := range installPlans {
+		if installPlan.Spec.Approval != manualApproval || installPlan.Spec.Approved || installPlan.Status.Phase != installPlanRequiresApproval {
+			continue
+		}
+		for _, csvName := range installPlan.Spec.ClusterServiceVersionNames {
+			if strings.HasPrefix(csvName, entandoPackagePrefix) {
+				installation.PendingInstallPlans = append(installation.PendingInstallPlans, installPlan)
+				break
+			}
+		}
+	}
+
+	return &installation
+}
+
+// Lines returns the description of the OLM installation, with warnings for the detected issues
+func (i *OlmInstallation) Lines() []string {
+	lines := []string{}
+
+	if i.Subscription != nil {
+		lines = append(lines, fmt.Sprintf("OLM Subscription: %s (package %s, channel %s, approval %s)",
+			i.Subscription.Name, i.Subscription.Spec.Package, i.Subscription.Spec.Channel, getApproval(i.Subscription)))
+	} else {
+		lines = append(lines, "WARNING: no Entando OLM Subscription found, the operator will not be upgraded by OLM")
+	}
+
+	if i.CSV != nil {
+		lines = append(lines, fmt.Sprintf("Installed CSV: %s (version %s, phase %s)", i.CSV.Name, i.CSV.Spec.Version, i.CSV.Status.Phase))
+	} else {
+		lines = append(lines, "WARNING: no installed Entando CSV found")
+	}
+
+	if len(i.OperatorGroups) == 0 {
+		lines = append(lines, "WARNING: no OperatorGroup found in the namespace")
+	} else {
+		lines = append(lines, "OperatorGroup: "+strings.Join(i.OperatorGroups, ", "))
+	}
+
+	for _, installPlan := range i.PendingInstallPlans {
+		lines = append(lines, fmt.Sprintf("WARNING: InstallPlan %s installing %s is waiting for manual approval",
+			installPlan.Name, strings.Join(installPlan.Spec.ClusterServiceVersionNames, ", ")))
+	}
+
+	return lines
+}
+
+// getApproval returns the Subscription approval strategy. OLM defaults to Automatic when it is not set.
+func getApproval(subscription *Subscription) string {
+	if subscription.Spec.InstallPlanApproval == "" {
+		return "Automatic"
+	}
+	return subscription.Spec.InstallPlanApproval
+}
+
+// FindEntandoSubscription returns the OLM Subscription of the Entando operator in the namespace
+func FindEntandoSubscription() (*Subscription, error) {
+	subscriptions := subscriptionList{}
+	if err := getResource(&subscriptions, olmSubscriptionResource); err != nil {
+		return nil, err
+	}
+	for i, subscription := range subscriptions.Items {
+		if strings.HasPrefix(subscription.Spec.Package, entandoPackagePrefix) {
+			return &subscriptions.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no Entando Subscription found in the namespace")
+}
+
+// waitForSubscriptionUpgrade waits until the Subscription installs a CSV different from the given one
+func waitForSubscriptionUpgrade(name, previousCSV string) error {
+	deadline := time.Now().Add(olmUpgradeTimeout)
+	for {
+		subscription := Subscription{}
+		if err := getResource(&subscription, olmSubscriptionResource, name); err != nil {
+			return err
+		}
+		if subscription.Status.InstalledCSV != previousCSV && subscription.Status.State == subscriptionUpToDate {
+			fmt.Fprintf(os.Stderr, "Installed %s\n", subscription.Status.InstalledCSV)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the Subscription %s has not installed a new version after %s", name, olmUpgradeTimeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
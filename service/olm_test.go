@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+	operatormode "upgrade-cli/flag/operator_mode"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindOlmInstallation(t *testing.T) {
+
+	subscription := Subscription{}
+	subscription.Name = "entando-k8s-operator"
+	subscription.Spec = SubscriptionSpec{Package: "entando-k8s-operator", Channel: "7.1.x", InstallPlanApproval: manualApproval}
+	subscription.Status.InstalledCSV = "entando-k8s-operator.v7.1.1"
+
+	oldCSV := ClusterServiceVersion{}
+	oldCSV.Name = "entando-k8s-operator.v7.1.0"
+	installedCSV := ClusterServiceVersion{}
+	installedCSV.Name = "entando-k8s-operator.v7.1.1"
+
+	operatorGroup := metav1.PartialObjectMetadata{}
+	operatorGroup.Name = "entando-group"
+
+	pendingPlan := InstallPlan{}
+	pendingPlan.Name = "install-abcde"
+	pendingPlan.Spec.Approval = manualApproval
+	pendingPlan.Spec.ClusterServiceVersionNames = []string{"entando-k8s-operator.v7.1.2"}
+	pendingPlan.Status.Phase = installPlanRequiresApproval
+	completedPlan := InstallPlan{}
+	completedPlan.Name = "install-fghij"
+	completedPlan.Spec.Approval = manualApproval
+	completedPlan.Spec.Approved = true
+	completedPlan.Spec.ClusterServiceVersionNames = []string{"entando-k8s-operator.v7.1.1"}
+	completedPlan.Status.Phase = "Complete"
+
+	installation := FindOlmInstallation([]ClusterServiceVersion{oldCSV, installedCSV}, []Subscription{subscription},
+		[]metav1.PartialObjectMetadata{operatorGroup}, []InstallPlan{completedPlan, pendingPlan})
+
+	if installation == nil {
+		t.Fatalf("OLM installation not detected")
+	}
+	if installation.CSV == nil || installation.CSV.Name != installedCSV.Name {
+		t.Fatalf("unexpected CSV %+v", installation.CSV)
+	}
+	if len(installation.PendingInstallPlans) != 1 || installation.PendingInstallPlans[0].Name != pendingPlan.Name {
+		t.Fatalf("unexpected pending InstallPlans %+v", installation.PendingInstallPlans)
+	}
+
+	lines := installation.Lines()
+	expectedLine := "WARNING: InstallPlan install-abcde installing entando-k8s-operator.v7.1.2 is waiting for manual approval"
+	if lines[len(lines)-1] != expectedLine {
+		t.Fatalf("unexpected report %v", lines)
+	}
+
+	if installation := FindOlmInstallation(nil, nil, []metav1.PartialObjectMetadata{operatorGroup}, nil); installation != nil {
+		t.Fatalf("OLM installation detected without Entando Subscription and CSV")
+	}
+}
+
+func TestGetOperatorModeFromEnv(t *testing.T) {
+
+	deployment := appsv1.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{
+		{Name: "sidecar"},
+		{Name: "operator", Env: []corev1.EnvVar{{Name: operatorDeploymentType, Value: "helm"}}},
+	}
+
+	if mode, _ := getOperatorModeFromEnv(&deployment); mode != operatormode.Plain {
+		t.Fatalf("expected Plain mode, found %s", mode)
+	}
+
+	deployment.Spec.Template.Spec.Containers[1].Env[0].Value = "other"
+	if mode, value := getOperatorModeFromEnv(&deployment); mode != operatormode.Auto || value != "other" {
+		t.Fatalf("expected Auto mode for unknown value, found %s", mode)
+	}
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"upgrade-cli/util/images"
+	"upgrade-cli/util/version"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	EntandoOperatorName = "entando-operator"
+	UpgradeOperatorName = "upgrade-operator"
+
+	versionLabel = "app.kubernetes.io/version"
+
+	// manifest applied to upgrade the operator of plain installations. {version} is replaced with the target version
+	DefaultOperatorManifestUrl = "https://raw.githubusercontent.com/entando/entando-releases/v{version}/dist/ge-1-1-6/namespace-scoped-deployment/namespace-resources.yaml"
+)
+
+// OperatorInfo contains the image and the version of an operator installed in the namespace
+type OperatorInfo struct {
+	Name       string
+	Deployment string
+	Image      string
+	Version    string
+}
+
+// CompatibilityRule defines the minimum operators versions required by an Entando version
+type CompatibilityRule struct {
+	// Entando version in the format major.minor
+	EntandoVersion            string `json:"entandoVersion"`
+	MinOperatorVersion        string `json:"minOperatorVersion,omitempty"`
+	MinUpgradeOperatorVersion string `json:"minUpgradeOperatorVersion,omitempty"`
+	// OLM channel providing a compatible operator
+	OlmChannel string `json:"olmChannel,omitempty"`
+}
+
+// CompatibilityIssue describes an incompatibility between an installed operator and the target version
+type CompatibilityIssue struct {
+	Operator string
+	Message  string
+	// if false the issue is only a warning
+	Blocking bool
+}
+
+// OperatorsCheck is the result of the check of the installed operators against a target version
+type OperatorsCheck struct {
+	// nil if the operators can't be retrieved
+	Operators []OperatorInfo
+	Issues    []CompatibilityIssue
+	// compatibility rule of the target version, nil if not defined
+	Rule *CompatibilityRule
+}
+
+// default compatibility matrix, that can be replaced using a YAML file
+var CompatibilityMatrix = []CompatibilityRule{
+	{EntandoVersion: "7.1", MinOperatorVersion: "7.1.0", OlmChannel: "7.1.x"},
+	{EntandoVersion: "7.2", MinOperatorVersion: "7.2.0", OlmChannel: "7.2.x"},
+}
+
+// LoadCompatibilityMatrix reads the compatibility rules from a YAML file. If the file name is empty the default matrix is returned.
+func LoadCompatibilityMatrix(fileName string) ([]CompatibilityRule, error) {
+	if fileName == "" {
+		return CompatibilityMatrix, nil
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read compatibility matrix %s. %s", fileName, err.Error())
+	}
+
+	matrix := []CompatibilityRule{}
+	if err := yaml.UnmarshalStrict(content, &matrix); err != nil {
+		return nil, fmt.Errorf("unable to parse compatibility matrix %s. %s", fileName, err.Error())
+	}
+
+	return matrix, nil
+}
+
+// GetOperatorsInfo retrieves the entando-operator and the upgrade-operator (which reconciles EntandoAppV2) from the namespace.
+// Operators that are not found are not included in the result.
+func GetOperatorsInfo() ([]OperatorInfo, error) {
+	deployments, err := GetDeployments()
+	if err != nil {
+		return nil, err
+	}
+	return FindOperators(deployments), nil
+}
+
+// CheckOperators retrieves the installed operators and checks that they support the target version, using the
+// compatibility matrix read from matrixFile or the default one if empty. Only confirmed incompatibilities are blocking
+// issues: if the operators can't be retrieved the compatibility can't be determined, which is reported as a warning.
+func CheckOperators(targetVersion string, matrixFile string) (*OperatorsCheck, error) {
+	matrix, err := LoadCompatibilityMatrix(matrixFile)
+	if err != nil {
+		return nil, err
+	}
+
+	check := OperatorsCheck{}
+	check.Rule, _ = FindCompatibilityRule(targetVersion, matrix)
+
+	operators, err := GetOperatorsInfo()
+	if err != nil {
+		check.Issues = []CompatibilityIssue{{Message: fmt.Sprintf("unable to retrieve the installed operators: %s", err.Error())}}
+		return &check, nil
+	}
+
+	check.Operators = operators
+	check.Issues = CheckOperatorsCompatibility(targetVersion, operators, matrix)
+	return &check, nil
+}
+
+// Lines returns the installed operators as a table followed by the issues, blocking issues as errors and the others as warnings
+func (c *OperatorsCheck) Lines() []string {
+	lines := []string{}
+
+	if c.Operators != nil {
+		var buffer bytes.Buffer
+		writer := tabwriter.NewWriter(&buffer, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(writer, "OPERATOR\tDEPLOYMENT\tVERSION\tIMAGE")
+		for _, operator := range c.Operators {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", operator.Name, operator.Deployment, operator.Version, operator.Image)
+		}
+		writer.Flush()
+		lines = append(lines, strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")...)
+	}
+
+	for _, issue := range c.Issues {
+		prefix := "WARNING"
+		if issue.Blocking {
+			prefix = "ERROR"
+		}
+		if issue.Operator != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s %s", prefix, issue.Operator, issue.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", prefix, issue.Message))
+		}
+	}
+
+	return lines
+}
+
+// FindOperators looks for the Entando operators in the deployments. The entando-operator is identified by its deployment
+// name, while the upgrade-operator by its deployment name or image repository.
+func FindOperators(deployments []appsv1.Deployment) []OperatorInfo {
+	operators := []OperatorInfo{}
+	for _, deployment := range deployments {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			var name string
+			if deployment.Name == EntandoOperatorName {
+				name = EntandoOperatorName
+			} else if strings.Contains(deployment.Name, UpgradeOperatorName) || strings.Contains(images.ExtractRepo(container.Image), UpgradeOperatorName) {
+				name = UpgradeOperatorName
+			} else {
+				continue
+			}
+
+			operatorVersion := deployment.Labels[versionLabel]
+			if operatorVersion == "" {
+				operatorVersion = images.ExtractTag(container.Image)
+			}
+
+			operators = append(operators, OperatorInfo{
+				Name:       name,
+				Deployment: deployment.Name,
+				Image:      container.Image,
+				Version:    operatorVersion,
+			})
+			break
+		}
+	}
+	return operators
+}
+
+// FindCompatibilityRule returns the rule defined for the major.minor of the target version, or nil
+func FindCompatibilityRule(targetVersion string, matrix []CompatibilityRule) (*CompatibilityRule, error) {
+	target, err := version.Parse(targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range matrix {
+		if rule.EntandoVersion == target.MajorMinor() {
+			return &matrix[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CheckOperatorsCompatibility verifies that the installed operators satisfy the requirements of the target version
+func CheckOperatorsCompatibility(targetVersion string, operators []OperatorInfo, matrix []CompatibilityRule) []CompatibilityIssue {
+	issues := []CompatibilityIssue{}
+
+	installed := map[string]OperatorInfo{}
+	for _, operator := range operators {
+		installed[operator.Name] = operator
+	}
+
+	if _, ok := installed[UpgradeOperatorName]; !ok {
+		issues = append(issues, CompatibilityIssue{Operator: UpgradeOperatorName,
+			Message: "not found in the namespace, the EntandoAppV2 resource will not be reconciled unless it is installed cluster-wide"})
+	}
+
+	// issues preventing the check are only warnings, since no incompatibility has been confirmed
+	rule, err := FindCompatibilityRule(targetVersion, matrix)
+	if err != nil {
+		return append(issues, CompatibilityIssue{Message: fmt.Sprintf("unable to check the compatibility: %s", err.Error())})
+	}
+	if rule == nil {
+		return append(issues, CompatibilityIssue{Message: fmt.Sprintf("no compatibility information available for version %s", targetVersion)})
+	}
+
+	requirements := map[string]string{
+		EntandoOperatorName: rule.MinOperatorVersion,
+		UpgradeOperatorName: rule.MinUpgradeOperatorVersion,
+	}
+	for _, operatorName := range []string{EntandoOperatorName, UpgradeOperatorName} {
+		minVersion := requirements[operatorName]
+		operator, ok := installed[operatorName]
+		if minVersion == "" || !ok {
+			if minVersion != "" && operatorName == EntandoOperatorName {
+				issues = append(issues, CompatibilityIssue{Operator: operatorName,
+					Message: fmt.Sprintf("not found in the namespace, unable to check that its version is %s or later", minVersion)})
+			}
+			continue
+		}
+		if issue := checkOperatorVersion(operator, minVersion, targetVersion); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+
+	return issues
+}
+
+func checkOperatorVersion(operator OperatorInfo, minVersion, targetVersion string) *CompatibilityIssue {
+	installedVersion, err := version.Parse(operator.Version)
+	if err != nil {
+		return &CompatibilityIssue{Operator: operator.Name,
+			Message: fmt.Sprintf("unable to determine the version of image %s, version %s or later is required", operator.Image, minVersion)}
+	}
+	requiredVersion, err := version.Parse(minVersion)
+	if err != nil {
+		return &CompatibilityIssue{Operator: operator.Name, Message: fmt.Sprintf("invalid minimum version in the compatibility matrix: %s", err.Error())}
+	}
+	if installedVersion.Compare(requiredVersion) < 0 {
+		return &CompatibilityIssue{Operator: operator.Name, Blocking: true,
+			Message: fmt.Sprintf("version %s doesn't support Entando %s, version %s or later is required", operator.Version, targetVersion, minVersion)}
+	}
+	return nil
+}
+
+// HasBlockingIssues returns true if at least one of the issues is blocking
+func HasBlockingIssues(issues []CompatibilityIssue) bool {
+	for _, issue := range issues {
+		if issue.Blocking {
+			return true
+		}
+	}
+	return false
+}
+
+// OperatorUpgradeOptions contains the parameters used to upgrade the operators
+type OperatorUpgradeOptions struct {
+	TargetVersion string
+	Olm           bool
+	// manifest URL template used for plain installations
+	ManifestUrl string
+	// OLM channel, if empty the one defined in the compatibility rule is used
+	Channel string
+	Rule    *CompatibilityRule
+}
+
+// UpgradeOperators upgrades the Entando operators to a version compatible with the target one. For plain installations
+// the release manifest is applied, for OLM installations the channel of the Entando Subscription is updated.
+func UpgradeOperators(options OperatorUpgradeOptions) error {
+	if options.Olm {
+		channel := options.Channel
+		if channel == "" && options.Rule != nil {
+			channel = options.Rule.OlmChannel
+		}
+		if channel == "" {
+			return fmt.Errorf("unable to determine the OLM channel for version %s, please specify it", options.TargetVersion)
+		}
+		return updateSubscriptionChannel(channel)
+	}
+
+	manifestUrl := options.ManifestUrl
+	if manifestUrl == "" {
+		manifestUrl = DefaultOperatorManifestUrl
+	}
+	manifestUrl = strings.ReplaceAll(manifestUrl, "{version}", strings.TrimPrefix(options.TargetVersion, "v"))
+
+	fmt.Fprintf(os.Stderr, "Applying %s\n", manifestUrl)
+	if _, err := runKubectl("apply", "-f", manifestUrl); err != nil {
+		return fmt.Errorf("unable to apply operator manifest: %s", err.Error())
+	}
+
+	return waitForOperatorRollout()
+}
+
+func updateSubscriptionChannel(channel string) error {
+	subscription, err := FindEntandoSubscription()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Updating channel of Subscription %s from %s to %s\n", subscription.Name, subscription.Spec.Channel, channel)
+
+	patch, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"channel": channel}})
+	if _, err := runKubectl("patch", olmSubscriptionResource, subscription.Name, "--type", "merge", "-p", string(patch)); err != nil {
+		return fmt.Errorf("unable to update the Subscription channel: %s", err.Error())
+	}
+
+	if subscription.Spec.InstallPlanApproval == manualApproval {
+		fmt.Fprintln(os.Stderr, "WARNING: the Subscription has manual approval, the new InstallPlan must be approved to complete the operator upgrade")
+		return nil
+	}
+
+	if err := waitForSubscriptionUpgrade(subscription.Name, subscription.Status.InstalledCSV); err != nil {
+		return err
+	}
+	return waitForOperatorRollout()
+}
+
+func waitForOperatorRollout() error {
+	if _, err := runKubectl("rollout", "status", "deployment/"+EntandoOperatorName, "--timeout=5m"); err != nil {
+		return fmt.Errorf("the %s rollout is not completed: %s", EntandoOperatorName, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestFindOperators(t *testing.T) {
+
+	entandoOperator := mkComponentDeployment(EntandoOperatorName, "entando/entando-k8s-controller-coordinator:7.1.1", 1)
+	upgradeOperator := mkComponentDeployment("controller-manager", "entando/upgrade-operator:0.0.3", 1)
+	upgradeOperator.Labels = map[string]string{versionLabel: "0.0.4"}
+
+	operators := FindOperators([]appsv1.Deployment{
+		mkComponentDeployment("default-sso-in-namespace-deployment", "entando/entando-keycloak:7.1.0", 1),
+		entandoOperator,
+		upgradeOperator,
+	})
+
+	if len(operators) != 2 {
+		t.Fatalf("expected 2 operators, found %d", len(operators))
+	}
+	if operators[0].Name != EntandoOperatorName || operators[0].Version != "7.1.1" {
+		t.Fatalf("unexpected entando-operator info %+v", operators[0])
+	}
+	if operators[1].Name != UpgradeOperatorName || operators[1].Version != "0.0.4" {
+		t.Fatalf("unexpected upgrade-operator info %+v", operators[1])
+	}
+}
+
+func TestCheckOperatorsCompatibility(t *testing.T) {
+
+	matrix := []CompatibilityRule{{EntandoVersion: "7.2", MinOperatorVersion: "7.2.0", MinUpgradeOperatorVersion: "0.1.0"}}
+
+	operators := []OperatorInfo{
+		{Name: EntandoOperatorName, Image: "entando/entando-k8s-controller-coordinator:7.1.1", Version: "7.1.1"},
+		{Name: UpgradeOperatorName, Image: "entando/upgrade-operator:0.1.2", Version: "0.1.2"},
+	}
+
+	issues := CheckOperatorsCompatibility("7.2.1", operators, matrix)
+	if len(issues) != 1 || !issues[0].Blocking || issues[0].Operator != EntandoOperatorName {
+		t.Fatalf("unexpected issues %+v", issues)
+	}
+
+	check := OperatorsCheck{Operators: operators, Issues: issues}
+	lines := check.Lines()
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "OPERATOR") || !strings.HasPrefix(lines[3], "ERROR: entando-operator version 7.1.1") {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+
+	operators[0].Version = "7.2.0-fix.1"
+	if issues := CheckOperatorsCompatibility("v7.2.1", operators, matrix); len(issues) != 0 {
+		t.Fatalf("unexpected issues %+v", issues)
+	}
+
+	issues = CheckOperatorsCompatibility("7.3.0", operators[:1], matrix)
+	if HasBlockingIssues(issues) || len(issues) != 2 {
+		t.Fatalf("expected only warnings, found %+v", issues)
+	}
+
+	// the compatibility can't be determined, which is not blocking
+	if issues := CheckOperatorsCompatibility("latest", operators, matrix); HasBlockingIssues(issues) || len(issues) != 1 {
+		t.Fatalf("expected only warnings, found %+v", issues)
+	}
+	if issues := CheckOperatorsCompatibility("7.2.1", operators[1:], matrix); HasBlockingIssues(issues) || len(issues) != 1 {
+		t.Fatalf("expected only warnings, found %+v", issues)
+	}
+}
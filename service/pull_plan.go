@@ -0,0 +1,208 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"upgrade-cli/util/images"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageLayers contains the compressed size of the layers of the image of a component
+type ImageLayers struct {
+	Component string
+	Image     string
+	// compressed size of the config and of the layers, indexed by digest
+	Layers map[string]int64
+	// set if the manifest of the image can't be retrieved
+	Error string
+}
+
+// Size returns the compressed size of the image
+func (i ImageLayers) Size() int64 {
+	size := int64(0)
+	for _, layerSize := range i.Layers {
+		size += layerSize
+	}
+	return size
+}
+
+// NodePullEstimate is the amount of data that a node has to download to run all the images
+type NodePullEstimate struct {
+	Node     string
+	Bytes    int64
+	Duration time.Duration
+}
+
+// PullPlan estimates the time needed to pull the images of the upgrade
+type PullPlan struct {
+	Images []ImageLayers
+	// compressed size of the distinct layers of the images
+	TotalSize int64
+	// bandwidth in Mbit/s used for the estimates
+	Bandwidth float64
+	// estimates for each node; if the nodes can't be retrieved it contains a single estimate with empty name,
+	// assuming that no layers are already present
+	Nodes []NodePullEstimate
+	// components not included in the estimate since their image can't be determined
+	Skipped []string
+}
+
+// MaxDuration returns the longest pull time of the nodes
+func (p PullPlan) MaxDuration() time.Duration {
+	max := time.Duration(0)
+	for _, node := range p.Nodes {
+		if node.Duration > max {
+			max = node.Duration
+		}
+	}
+	return max
+}
+
+// GetPullPlan retrieves the layers of the images of the EntandoAppV2 and of the Entando images already present
+// on the nodes, and estimates the pull time of each node at the given bandwidth in Mbit/s.
+// The components without image override use the default images of the version, read from its release manifest.
+func GetPullPlan(entandoApp *images.EntandoApp, bandwidth float64) PullPlan {
+	imagesLayers := []ImageLayers{}
+	repos := map[string]bool{}
+
+	upgradeImages, unresolved := GetUpgradeImages(entandoApp)
+	for _, upgradeImage := range upgradeImages {
+		imageLayers := ImageLayers{Component: upgradeImage.Component, Image: upgradeImage.Image}
+		if layers, err := GetImageLayers(upgradeImage.Image); err != nil {
+			imageLayers.Error = err.Error()
+		} else {
+			imageLayers.Layers = layers
+		}
+		imagesLayers = append(imagesLayers, imageLayers)
+		repos[images.ExtractRepo(upgradeImage.Image)] = true
+	}
+
+	nodes := NodeLayers{}
+	if nodeList, err := getNodes(); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to retrieve the images present on the nodes, the estimate assumes that all the layers have to be pulled: %s\n", err.Error())
+	} else {
+		nodes = GetNodesLayers(nodeList, repos)
+	}
+
+	plan := ComputePullPlan(imagesLayers, nodes, bandwidth)
+	plan.Skipped = unresolved
+	return plan
+}
+
+// GetImageLayers returns the compressed size of the config and of the layers of the image, indexed by digest
+func GetImageLayers(image string) (map[string]int64, error) {
+	platformImage, err := CranePull(image, crane.WithPlatform(&defaultPlatform))
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := platformImage.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layers := map[string]int64{manifest.Config.Digest.String(): manifest.Config.Size}
+	for _, layer := range manifest.Layers {
+		layers[layer.Digest.String()] = layer.Size
+	}
+	return layers, nil
+}
+
+// NodeLayers contains the digests of the layers present on each node, indexed by node name
+type NodeLayers map[string]map[string]bool
+
+// GetNodesLayers determines the layers present on the nodes by retrieving the manifests of the images on the nodes
+// belonging to the given repositories. Images that can't be retrieved are ignored.
+func GetNodesLayers(nodes []corev1.Node, repos map[string]bool) NodeLayers {
+	nodeLayers := NodeLayers{}
+	cache := map[string]map[string]int64{}
+
+	for _, node := range nodes {
+		present := map[string]bool{}
+		for _, nodeImage := range node.Status.Images {
+			ref := getNodeImageReference(nodeImage)
+			if ref == "" || !repos[images.ExtractRepo(ref)] {
+				continue
+			}
+			layers, ok := cache[ref]
+			if !ok {
+				layers, _ = GetImageLayers(ref)
+				cache[ref] = layers
+			}
+			for digest := range layers {
+				present[digest] = true
+			}
+		}
+		nodeLayers[node.Name] = present
+	}
+
+	return nodeLayers
+}
+
+// getNodeImageReference returns the name of the node image pinned to a digest if available, otherwise the first name
+func getNodeImageReference(nodeImage corev1.ContainerImage) string {
+	for _, name := range nodeImage.Names {
+		if strings.Contains(name, "@") {
+			return name
+		}
+	}
+	if len(nodeImage.Names) > 0 {
+		return nodeImage.Names[0]
+	}
+	return ""
+}
+
+// ComputePullPlan sums the sizes of the distinct layers of the images and, for each node, the sizes of the layers
+// not already present. If no nodes are provided, all the layers are considered missing.
+func ComputePullPlan(imagesLayers []ImageLayers, nodes NodeLayers, bandwidth float64) PullPlan {
+	plan := PullPlan{Images: imagesLayers, Bandwidth: bandwidth}
+
+	layers := map[string]int64{}
+	for _, imageLayers := range imagesLayers {
+		for digest, size := range imageLayers.Layers {
+			layers[digest] = size
+		}
+	}
+	for _, size := range layers {
+		plan.TotalSize += size
+	}
+
+	if len(nodes) == 0 {
+		plan.Nodes = []NodePullEstimate{{Bytes: plan.TotalSize, Duration: estimatePullTime(plan.TotalSize, bandwidth)}}
+		return plan
+	}
+
+	for node, present := range nodes {
+		estimate := NodePullEstimate{Node: node}
+		for digest, size := range layers {
+			if !present[digest] {
+				estimate.Bytes += size
+			}
+		}
+		estimate.Duration = estimatePullTime(estimate.Bytes, bandwidth)
+		plan.Nodes = append(plan.Nodes, estimate)
+	}
+	sort.Slice(plan.Nodes, func(i, j int) bool { return plan.Nodes[i].Node < plan.Nodes[j].Node })
+
+	return plan
+}
+
+// estimatePullTime returns the time needed to download the bytes at the given bandwidth in Mbit/s
+func estimatePullTime(bytes int64, bandwidth float64) time.Duration {
+	if bandwidth <= 0 {
+		return 0
+	}
+	seconds := float64(bytes) * 8 / (bandwidth * 1000 * 1000)
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
+
+func getNodes() ([]corev1.Node, error) {
+	nodes := corev1.NodeList{}
+	if err := getResource(&nodes, "nodes"); err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputePullPlan(t *testing.T) {
+	imagesLayers := []ImageLayers{
+		{Component: "DeApp", Layers: map[string]int64{"sha256:base": 50_000_000, "sha256:de-app": 200_000_000}},
+		{Component: "AppBuilder", Layers: map[string]int64{"sha256:base": 50_000_000, "sha256:app-builder": 25_000_000}},
+		{Component: "Keycloak", Error: "manifest unknown"},
+	}
+	nodes := NodeLayers{
+		"worker-2": {"sha256:base": true, "sha256:app-builder": true},
+		"worker-1": {},
+	}
+
+	plan := ComputePullPlan(imagesLayers, nodes, 100)
+
+	if plan.TotalSize != 275_000_000 || imagesLayers[0].Size() != 250_000_000 {
+		t.Fatalf("unexpected total size %d", plan.TotalSize)
+	}
+	if len(plan.Nodes) != 2 || plan.Nodes[0].Node != "worker-1" || plan.Nodes[0].Bytes != 275_000_000 ||
+		plan.Nodes[1].Bytes != 200_000_000 || plan.Nodes[1].Duration != 16*time.Second {
+		t.Fatalf("unexpected nodes estimates %+v", plan.Nodes)
+	}
+	if plan.MaxDuration() != 22*time.Second {
+		t.Fatalf("unexpected max duration %s", plan.MaxDuration())
+	}
+
+	plan = ComputePullPlan(imagesLayers, NodeLayers{}, 0)
+	if len(plan.Nodes) != 1 || plan.Nodes[0].Bytes != 275_000_000 || plan.MaxDuration() != 0 {
+		t.Fatalf("unexpected nodes estimates %+v", plan.Nodes)
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"upgrade-cli/util/images"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var CranePull = crane.Pull
+
+const (
+	SbomFormatSpdx      = "SPDX"
+	SbomFormatCycloneDX = "CycloneDX"
+
+	// cosign tag suffixes of the SBOMs attached to an image and of its attestations
+	sbomTagSuffix        = ".sbom"
+	attestationTagSuffix = ".att"
+
+	spdxPredicateType      = "https://spdx.dev/Document"
+	cycloneDXPredicateType = "https://cyclonedx.org/bom"
+)
+
+// ErrSbomNotFound is returned when no SBOM is attached to an image
+var ErrSbomNotFound = errors.New("no SBOM attached to the image")
+
+// ImageSbom is the SBOM document attached to the image of an Entando component
+type ImageSbom struct {
+	Component string
+	// image reference pinned to the digest
+	Image  string
+	Digest string
+	Format string
+	// sbom if the document was attached with cosign attach sbom, attestation if it was read from an in-toto attestation
+	Source   string
+	Document map[string]interface{}
+}
+
+// SbomSummary is stored in the upgrade record when the upgrade SBOM is generated
+type SbomSummary struct {
+	File string `json:"file"`
+	// components whose image has no SBOM attached or whose SBOM can't be retrieved
+	Missing []string `json:"missing,omitempty"`
+}
+
+// dsseEnvelope is the envelope of the in-toto attestations stored by cosign
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+}
+
+type inTotoStatement struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// FetchImageSbom retrieves the SPDX or CycloneDX SBOM attached to the image, looking for the cosign SBOM attachment
+// and then for the SBOM attestations. ErrSbomNotFound is returned if the image has no SBOM.
+func FetchImageSbom(image string) (*ImageSbom, error) {
+	imageRef, err := images.ParseImage(image)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := imageRef.Digest
+	if digest == "" {
+		if digest, err = CraneDigest(image); err != nil {
+			return nil, fmt.Errorf("unable to fetch digest: %s", err.Error())
+		}
+	}
+
+	sbom := ImageSbom{Image: imageRef.Name() + "@" + digest, Digest: digest}
+	tagPrefix := imageRef.Name() + ":" + strings.Replace(digest, ":", "-", 1)
+
+	documents, err := pullArtifactLayers(tagPrefix + sbomTagSuffix)
+	if err != nil && err != ErrSbomNotFound {
+		return nil, err
+	}
+	for _, document := range documents {
+		if format := detectSbomFormat(document); format != "" {
+			sbom.Format, sbom.Source, sbom.Document = format, "sbom", document
+			return &sbom, nil
+		}
+	}
+
+	documents, err = pullArtifactLayers(tagPrefix + attestationTagSuffix)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if predicate := extractSbomPredicate(document); predicate != nil {
+			sbom.Format, sbom.Source, sbom.Document = detectSbomFormat(predicate), "attestation", predicate
+			return &sbom, nil
+		}
+	}
+
+	return nil, ErrSbomNotFound
+}
+
+// pullArtifactLayers pulls the artifact with the given tag and returns its JSON layers.
+// ErrSbomNotFound is returned if the tag doesn't exist.
+func pullArtifactLayers(ref string) ([]map[string]interface{}, error) {
+	artifact, err := CranePull(ref)
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return nil, ErrSbomNotFound
+		}
+		return nil, fmt.Errorf("unable to pull %s: %s", ref, err.Error())
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", ref, err.Error())
+	}
+
+	documents := []map[string]interface{}{}
+	for _, layer := range layers {
+		reader, err := layer.Uncompressed()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", ref, err.Error())
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", ref, err.Error())
+		}
+		document := map[string]interface{}{}
+		// layers not in JSON format (e.g. SPDX tag-value documents) are not supported
+		if json.Unmarshal(content, &document) == nil {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+func detectSbomFormat(document map[string]interface{}) string {
+	if _, ok := document["spdxVersion"]; ok {
+		return SbomFormatSpdx
+	}
+	if document["bomFormat"] == "CycloneDX" {
+		return SbomFormatCycloneDX
+	}
+	return ""
+}
+
+// extractSbomPredicate returns the SBOM of a DSSE envelope containing an SPDX or CycloneDX in-toto statement, or nil
+func extractSbomPredicate(envelope map[string]interface{}) map[string]interface{} {
+	payload, ok := envelope["payload"].(string)
+	if !ok {
+		return nil
+	}
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	statement := inTotoStatement{}
+	if err := json.Unmarshal(content, &statement); err != nil {
+		return nil
+	}
+	if statement.PredicateType != spdxPredicateType && statement.PredicateType != cycloneDXPredicateType {
+		return nil
+	}
+
+	predicate := map[string]interface{}{}
+	if err := json.Unmarshal(statement.Predicate, &predicate); err != nil {
+		return nil
+	}
+	// older cosign versions wrap the document in the Data field
+	if data, ok := predicate["Data"]; ok {
+		wrapped := map[string]interface{}{}
+		if text, ok := data.(string); ok && json.Unmarshal([]byte(text), &wrapped) == nil {
+			predicate = wrapped
+		} else if object, ok := data.(map[string]interface{}); ok {
+			predicate = object
+		}
+	}
+	if detectSbomFormat(predicate) == "" {
+		return nil
+	}
+	return predicate
+}
+
+// CollectSboms retrieves the SBOMs of the images that the components run after the upgrade, as returned by
+// GetUpgradeImages. It returns the SBOMs found and the components without SBOM, including the unresolved ones,
+// reporting the reason as a warning.
+func CollectSboms(upgradeImages []UpgradeImage, unresolved []string) ([]ImageSbom, []string) {
+	sboms := []ImageSbom{}
+	missing := []string{}
+
+	for _, component := range unresolved {
+		fmt.Fprintf(os.Stderr, "WARNING: SBOM of %s not available: unable to determine its image\n", component)
+		missing = append(missing, component)
+	}
+
+	for _, upgradeImage := range upgradeImages {
+		sbom, err := FetchImageSbom(upgradeImage.Image)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: SBOM of %s image %s not available: %s\n", upgradeImage.Component, upgradeImage.Image, err.Error())
+			missing = append(missing, upgradeImage.Component)
+			continue
+		}
+		sbom.Component = upgradeImage.Component
+		sboms = append(sboms, *sbom)
+	}
+
+	return sboms, missing
+}
+
+// cdxComponent is the subset of the CycloneDX component used to describe the images and their SPDX packages
+type cdxComponent struct {
+	Type       string            `json:"type"`
+	BomRef     string            `json:"bom-ref,omitempty"`
+	Name       string            `json:"name"`
+	Version    string            `json:"version,omitempty"`
+	Purl       string            `json:"purl,omitempty"`
+	Licenses   []cdxLicense      `json:"licenses,omitempty"`
+	Properties []cdxProperty     `json:"properties,omitempty"`
+	Components []json.RawMessage `json:"components,omitempty"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MergeSboms builds a CycloneDX document describing the Entando version with a container component for each image,
+// containing the components of the image CycloneDX SBOM or the packages of the image SPDX SBOM
+func MergeSboms(version string, sboms []ImageSbom, missing []string) map[string]interface{} {
+	imageComponents := []cdxComponent{}
+
+	for _, sbom := range sboms {
+		imageRef, _ := images.ParseImage(sbom.Image)
+		imageComponent := cdxComponent{
+			Type:    "container",
+			BomRef:  sbom.Image,
+			Name:    imageRef.Name(),
+			Version: sbom.Digest,
+			Purl:    fmt.Sprintf("pkg:oci/%s@%s?repository_url=%s", imageRef.Repo(), url.QueryEscape(sbom.Digest), url.QueryEscape(imageRef.Name())),
+			Properties: []cdxProperty{
+				{Name: "entando:component", Value: sbom.Component},
+				{Name: "entando:sbom-format", Value: sbom.Format},
+				{Name: "entando:sbom-source", Value: sbom.Source},
+			},
+		}
+		if sbom.Format == SbomFormatCycloneDX {
+			imageComponent.Components = getCycloneDXComponents(sbom.Document)
+		} else {
+			imageComponent.Components = convertSpdxPackages(sbom.Document)
+		}
+		imageComponents = append(imageComponents, imageComponent)
+	}
+
+	properties := []cdxProperty{}
+	for _, component := range missing {
+		properties = append(properties, cdxProperty{Name: "entando:missing-sbom", Value: component})
+	}
+
+	return map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.4",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"timestamp":  time.Now().UTC().Format(time.RFC3339),
+			"tools":      []map[string]string{{"vendor": "Entando", "name": "upgrade-cli"}},
+			"component":  cdxComponent{Type: "application", Name: "entando", Version: version},
+			"properties": properties,
+		},
+		"components": imageComponents,
+	}
+}
+
+func getCycloneDXComponents(document map[string]interface{}) []json.RawMessage {
+	components := []json.RawMessage{}
+	items, _ := document["components"].([]interface{})
+	for _, item := range items {
+		if component, err := json.Marshal(item); err == nil {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+func convertSpdxPackages(document map[string]interface{}) []json.RawMessage {
+	components := []json.RawMessage{}
+	packages, _ := document["packages"].([]interface{})
+	for _, item := range packages {
+		spdxPackage, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		component := cdxComponent{Type: "library"}
+		component.Name, _ = spdxPackage["name"].(string)
+		component.Version, _ = spdxPackage["versionInfo"].(string)
+		component.Purl = getSpdxPurl(spdxPackage)
+		for _, field := range []string{"licenseConcluded", "licenseDeclared"} {
+			if license, _ := spdxPackage[field].(string); license != "" && license != "NOASSERTION" && license != "NONE" {
+				component.Licenses = []cdxLicense{{Expression: license}}
+				break
+			}
+		}
+		if content, err := json.Marshal(component); err == nil {
+			components = append(components, content)
+		}
+	}
+	return components
+}
+
+func getSpdxPurl(spdxPackage map[string]interface{}) string {
+	refs, _ := spdxPackage["externalRefs"].([]interface{})
+	for _, item := range refs {
+		ref, _ := item.(map[string]interface{})
+		if ref["referenceType"] == "purl" {
+			purl, _ := ref["referenceLocator"].(string)
+			return purl
+		}
+	}
+	return ""
+}
+
+// WriteUpgradeSbom collects the SBOMs of the upgrade images and writes the merged document to the given file
+func WriteUpgradeSbom(fileName string, entandoApp *images.EntandoApp) (*SbomSummary, error) {
+	sboms, missing := CollectSboms(GetUpgradeImages(entandoApp))
+
+	content, err := json.MarshalIndent(MergeSboms(entandoApp.Spec.Version, sboms, missing), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return nil, fmt.Errorf("unable to write SBOM file %s. %s", fileName, err.Error())
+	}
+
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: the SBOM %s doesn't describe the images of %s\n", fileName, strings.Join(missing, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "SBOM of %d images saved to %s\n", len(sboms), fileName)
+
+	return &SbomSummary{File: fileName, Missing: missing}, nil
+}
+
+// GetRecordSbomPath returns the path of the SBOM stored in the history directory alongside the upgrade record
+func GetRecordSbomPath(record *UpgradeRecord) (string, error) {
+	historyFile, err := GetHistoryFilePath()
+	if err != nil {
+		return "", err
+	}
+	directory := filepath.Dir(historyFile)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(directory, "sbom-"+record.ID+".cdx.json"), nil
+}
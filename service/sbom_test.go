@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const testSpdxSbom = `{"spdxVersion": "SPDX-2.3", "packages": [
+	{"name": "openssl", "versionInfo": "1.1.1", "licenseConcluded": "Apache-2.0",
+	 "externalRefs": [{"referenceType": "purl", "referenceLocator": "pkg:apk/alpine/openssl@1.1.1"}]}]}`
+
+const testCycloneDXSbom = `{"bomFormat": "CycloneDX", "specVersion": "1.4", "components": [
+	{"type": "library", "name": "spring-core", "version": "5.3.20", "purl": "pkg:maven/org.springframework/spring-core@5.3.20"}]}`
+
+func TestCollectSboms(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	appBuilder := pushTestImage(t, host+"/entando/app-builder:7.1.2")
+	pushTestArtifact(t, appBuilder, ".sbom", testSpdxSbom, "text/spdx+json")
+
+	deApp := pushTestImage(t, host+"/entando/entando-de-app-eap:7.1.2")
+	statement := `{"_type": "https://in-toto.io/Statement/v0.1", "predicateType": "https://cyclonedx.org/bom", "predicate": ` + testCycloneDXSbom + `}`
+	envelope := `{"payloadType": "application/vnd.in-toto+json", "payload": "` + base64.StdEncoding.EncodeToString([]byte(statement)) + `"}`
+	pushTestArtifact(t, deApp, ".att", envelope, "application/vnd.dsse.envelope.v1+json")
+
+	pushTestImage(t, host+"/entando/entando-keycloak:7.1.2")
+
+	upgradeImages := []UpgradeImage{
+		{Component: "DeApp", Image: deApp},
+		{Component: "AppBuilder", Image: host + "/entando/app-builder:7.1.2"},
+		{Component: "Keycloak", Image: host + "/entando/entando-keycloak:7.1.2"},
+	}
+
+	sboms, missing := CollectSboms(upgradeImages, []string{"ComponentManager"})
+
+	if len(sboms) != 2 || sboms[0].Format != SbomFormatCycloneDX || sboms[0].Source != "attestation" ||
+		sboms[1].Format != SbomFormatSpdx || sboms[1].Source != "sbom" || sboms[1].Image != appBuilder {
+		t.Fatalf("unexpected SBOMs %+v", sboms)
+	}
+	if len(missing) != 2 || missing[0] != "ComponentManager" || missing[1] != "Keycloak" {
+		t.Fatalf("unexpected missing SBOMs %v", missing)
+	}
+	if _, err := FetchImageSbom(host + "/entando/entando-keycloak:7.1.2"); !errors.Is(err, ErrSbomNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	content, _ := json.Marshal(MergeSboms("7.1.2", sboms, missing))
+	merged := string(content)
+	for _, expected := range []string{`"purl":"pkg:maven/org.springframework/spring-core@5.3.20"`, `"purl":"pkg:apk/alpine/openssl@1.1.1"`,
+		`"licenses":[{"expression":"Apache-2.0"}]`, `{"name":"entando:missing-sbom","value":"ComponentManager"}`, `{"name":"entando:missing-sbom","value":"Keycloak"}`, `"type":"container"`} {
+		if !strings.Contains(merged, expected) {
+			t.Fatalf("merged SBOM doesn't contain %s\n%s", expected, merged)
+		}
+	}
+}
+
+// pushTestImage pushes a random image and returns its reference pinned to the digest
+func pushTestImage(t *testing.T, ref string) string {
+	image, _ := random.Image(100, 1)
+	if err := crane.Push(image, ref); err != nil {
+		t.Fatalf(err.Error())
+	}
+	digest, _ := image.Digest()
+	return ref[:strings.LastIndex(ref, ":")] + "@" + digest.String()
+}
+
+// pushTestArtifact pushes the artifact with a single layer to the cosign tag of the image
+func pushTestArtifact(t *testing.T, image, suffix, content string, mediaType types.MediaType) {
+	artifact, _ := mutate.AppendLayers(empty.Image, static.NewLayer([]byte(content), mediaType))
+	name, digest, _ := strings.Cut(image, "@")
+	if err := crane.Push(artifact, name+":"+strings.Replace(digest, ":", "-", 1)+suffix); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StallExitCode is the exit code used when the upgrade is interrupted because it is stalled
+const StallExitCode = 3
+
+// waitingReasonsGracePeriod is the time after which the blocking waiting reasons that are usually transient,
+// e.g. a failed first pull attempt or a secret not yet created by the operator, are considered a stall
+const waitingReasonsGracePeriod = 2 * time.Minute
+
+// container waiting reasons that prevent a component from starting
+var blockingWaitingReasons = map[string]string{
+	"CrashLoopBackOff":           "the container keeps crashing, check the logs of deployment %s",
+	"ImagePullBackOff":           "the image %s can't be pulled, check the image reference and the registry credentials",
+	"ErrImagePull":               "the image %s can't be pulled, check the image reference and the registry credentials",
+	"InvalidImageName":           "the image name %s is not valid",
+	"CreateContainerConfigError": "the container configuration of deployment %s is not valid, check the referenced secrets and config maps",
+}
+
+// back-off waiting reasons, that are reported only after repeated failures and are immediately considered a stall
+var backOffWaitingReasons = map[string]bool{
+	"CrashLoopBackOff": true,
+	"ImagePullBackOff": true,
+}
+
+// StallDetector notices when the upgrade progress doesn't advance for a configured duration
+// or when the pods of the Entando components can't start
+type StallDetector struct {
+	Timeout      time.Duration
+	lastProgress int
+	lastChange   time.Time
+	// time when each blocking waiting reason has been seen for the first time, indexed by pod and reason
+	waitingSince map[string]time.Time
+}
+
+// Stall describes why the upgrade is considered stalled
+type Stall struct {
+	Reason string
+	// likely cause for each component, in the order of images.EntandoImages
+	Causes []StallCause
+}
+
+// StallCause is the likely cause of the stall for a component
+type StallCause struct {
+	Component string
+	Cause     string
+}
+
+// StallError is returned when the upgrade is interrupted because it is stalled
+type StallError struct {
+	Stall *Stall
+}
+
+func (e *StallError) Error() string {
+	return "upgrade stalled: " + e.Stall.Reason
+}
+
+func (e *StallError) ExitCode() int {
+	return StallExitCode
+}
+
+func NewStallDetector(timeout time.Duration, now time.Time) *StallDetector {
+	return &StallDetector{Timeout: timeout, lastProgress: -1, lastChange: now, waitingSince: map[string]time.Time{}}
+}
+
+// Check updates the detector with the current progress and components status and returns the detected stall, or nil
+func (d *StallDetector) Check(progress int, components []ComponentStatus, now time.Time) *Stall {
+	if progress != d.lastProgress {
+		d.lastProgress = progress
+		d.lastChange = now
+	}
+
+	d.updateWaitingSince(components, now)
+
+	stall := Stall{}
+	blocked := false
+	for _, component := range components {
+		cause, isBlocking := d.getStallCause(component, now)
+		if cause != "" {
+			stall.Causes = append(stall.Causes, StallCause{Component: component.Component, Cause: cause})
+		}
+		blocked = blocked || isBlocking
+	}
+
+	unchangedFor := now.Sub(d.lastChange)
+	switch {
+	case blocked:
+		stall.Reason = "some component pods can't start"
+	case d.Timeout > 0 && unchangedFor >= d.Timeout:
+		stall.Reason = fmt.Sprintf("progress has not advanced for %s", unchangedFor.Round(time.Second))
+	default:
+		return nil
+	}
+
+	return &stall
+}
+
+// updateWaitingSince tracks since when the blocking waiting reasons are present, forgetting the resolved ones
+func (d *StallDetector) updateWaitingSince(components []ComponentStatus, now time.Time) {
+	current := map[string]time.Time{}
+	for _, component := range components {
+		for _, waiting := range component.Waiting {
+			key := waiting.Pod + "/" + waiting.Reason
+			if since, ok := d.waitingSince[key]; ok {
+				current[key] = since
+			} else {
+				current[key] = now
+			}
+		}
+	}
+	d.waitingSince = current
+}
+
+// getStallCause returns the likely reason for which the component is not ready and
+// true if the reason prevents the component from starting. Back-off reasons are blocking immediately,
+// while the other ones only when they persist for the grace period.
+func (d *StallDetector) getStallCause(component ComponentStatus, now time.Time) (string, bool) {
+	for _, waiting := range component.Waiting {
+		if template, ok := blockingWaitingReasons[waiting.Reason]; ok {
+			subject := component.Deployment
+			if strings.Contains(template, "image") {
+				subject = component.Image
+			}
+			cause := fmt.Sprintf("pod %s is in %s: %s", waiting.Pod, waiting.Reason, fmt.Sprintf(template, subject))
+			if waiting.Message != "" {
+				cause += " (" + waiting.Message + ")"
+			}
+			persisting := now.Sub(d.waitingSince[waiting.Pod+"/"+waiting.Reason]) >= waitingReasonsGracePeriod
+			return cause, backOffWaitingReasons[waiting.Reason] || persisting
+		}
+	}
+
+	switch component.Rollout {
+	case RolloutPending:
+		return "the deployment changes have not been processed yet", false
+	case RolloutUpdating:
+		return fmt.Sprintf("rollout in progress, %d/%d replicas updated", component.Updated, component.Desired), false
+	case RolloutStarting:
+		return fmt.Sprintf("waiting for the pods to be ready, %d/%d ready", component.Ready, component.Desired), false
+	}
+	return "", false
+}
+
+// Lines returns the description of the stall, one line per component
+func (s *Stall) Lines() []string {
+	lines := []string{"WARNING: upgrade stalled, " + s.Reason}
+	if len(s.Causes) == 0 {
+		lines = append(lines, "  no component issue detected, check the operator logs")
+	}
+	for _, cause := range s.Causes {
+		lines = append(lines, fmt.Sprintf("  - %s: %s", cause.Component, cause.Cause))
+	}
+	return lines
+}
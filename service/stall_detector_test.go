@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"upgrade-cli/common"
+)
+
+func TestStallDetectorTimeout(t *testing.T) {
+
+	start := time.Date(2022, 11, 10, 10, 0, 0, 0, time.UTC)
+	detector := NewStallDetector(5*time.Minute, start)
+
+	components := []ComponentStatus{
+		{Component: "DeApp", Rollout: RolloutStarting, Desired: 1},
+		{Component: "AppBuilder", Rollout: RolloutComplete, Desired: 1, Ready: 1},
+	}
+
+	if stall := detector.Check(2, components, start.Add(4*time.Minute)); stall != nil {
+		t.Fatalf("unexpected stall %+v", stall)
+	}
+	// progress advanced, the timer is reset
+	if stall := detector.Check(3, components, start.Add(8*time.Minute)); stall != nil {
+		t.Fatalf("unexpected stall %+v", stall)
+	}
+
+	stall := detector.Check(3, components, start.Add(13*time.Minute))
+	if stall == nil {
+		t.Fatalf("stall not detected")
+	}
+	if stall.Reason != "progress has not advanced for 5m0s" {
+		t.Fatalf("unexpected reason %s", stall.Reason)
+	}
+	if len(stall.Causes) != 1 || stall.Causes[0].Cause != "waiting for the pods to be ready, 0/1 ready" {
+		t.Fatalf("unexpected causes %+v", stall.Causes)
+	}
+}
+
+func TestStallDetectorBlockedPods(t *testing.T) {
+
+	start := time.Now()
+	detector := NewStallDetector(0, start)
+
+	components := []ComponentStatus{
+		{Component: "Keycloak", Deployment: "default-sso-in-namespace-deployment", Image: "registry.hub.docker.com/entando/entando-keycloak:wrong",
+			Rollout: RolloutUpdating, Desired: 1, Waiting: []ContainerWaiting{
+				{Pod: "default-sso-in-namespace-deployment-abc", Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+			}},
+	}
+
+	stall := detector.Check(1, components, start)
+	if stall == nil {
+		t.Fatalf("stall not detected")
+	}
+
+	expectedCause := "pod default-sso-in-namespace-deployment-abc is in ImagePullBackOff: the image registry.hub.docker.com/entando/entando-keycloak:wrong " +
+		"can't be pulled, check the image reference and the registry credentials (Back-off pulling image)"
+	if stall.Causes[0].Cause != expectedCause {
+		t.Fatalf("unexpected cause %s", stall.Causes[0].Cause)
+	}
+
+	var exitCodeErr common.ExitCodeError
+	if err := error(&StallError{Stall: stall}); !errors.As(err, &exitCodeErr) || exitCodeErr.ExitCode() != StallExitCode {
+		t.Fatalf("StallError should provide exit code %d", StallExitCode)
+	}
+}
+
+func TestStallDetectorTransientWaitingReasons(t *testing.T) {
+
+	start := time.Now()
+	detector := NewStallDetector(0, start)
+
+	components := []ComponentStatus{
+		{Component: "DeApp", Deployment: "my-app-deployment", Rollout: RolloutUpdating, Desired: 1, Waiting: []ContainerWaiting{
+			{Pod: "my-app-deployment-abc", Reason: "CreateContainerConfigError", Message: "secret not found"},
+		}},
+	}
+
+	if stall := detector.Check(1, components, start); stall != nil {
+		t.Fatalf("unexpected stall %+v", stall)
+	}
+	if stall := detector.Check(1, components, start.Add(time.Minute)); stall != nil {
+		t.Fatalf("unexpected stall %+v", stall)
+	}
+	if stall := detector.Check(1, components, start.Add(waitingReasonsGracePeriod)); stall == nil {
+		t.Fatalf("stall not detected after the grace period")
+	}
+
+	// the grace period restarts when the reason disappears
+	detector.Check(1, []ComponentStatus{}, start.Add(3*time.Minute))
+	if stall := detector.Check(1, components, start.Add(4*time.Minute)); stall != nil {
+		t.Fatalf("unexpected stall %+v", stall)
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+	"upgrade-cli/util/images"
+)
+
+const (
+	HistoryFileEnv          = "ENTANDO_CLI_UPGRADE_HISTORY_FILE"
+	LastUpgradeAnnotation   = "app.entando.org/last-upgrade"
+	defaultHistoryDir       = ".entando"
+	defaultHistoryFileName  = "upgrade-history.jsonl"
+	upgradeRecordTimeFormat = "20060102150405"
+
+	OutcomeSucceeded = "Succeeded"
+	OutcomeFailed    = "Failed"
+)
+
+// UpgradeRecord is the audit record stored for every execution of the upgrade command
+type UpgradeRecord struct {
+	ID            string            `json:"id"`
+	User          string            `json:"user"`
+	Timestamp     time.Time         `json:"timestamp"`
+	AppName       string            `json:"appName,omitempty"`
+	SourceVersion string            `json:"sourceVersion,omitempty"`
+	TargetVersion string            `json:"targetVersion,omitempty"`
+	Images        []RecordedImage   `json:"images,omitempty"`
+	Flags         map[string]string `json:"flags,omitempty"`
+	Backup        *BackupSummary    `json:"backup,omitempty"`
+	Sbom          *SbomSummary      `json:"sbom,omitempty"`
+	Outcome       string            `json:"outcome"`
+	Error         string            `json:"error,omitempty"`
+	Duration      string            `json:"duration"`
+	// name of the EntandoAppV2 resource, set only when the CR has been applied
+	ResourceName string `json:"resourceName,omitempty"`
+	// path of the diagnostics archive collected when the upgrade fails
+	DiagnosticsBundle string `json:"diagnosticsBundle,omitempty"`
+}
+
+// RecordedImage contains the image of a component and its digest, set if the image is pinned
+type RecordedImage struct {
+	Component string `json:"component"`
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+// NewUpgradeRecord initializes a record for an upgrade that is starting now
+func NewUpgradeRecord(flags map[string]string) *UpgradeRecord {
+	now := time.Now().UTC()
+	return &UpgradeRecord{
+		ID:        newUpgradeRecordID(now),
+		User:      getCurrentUser(),
+		Timestamp: now,
+		Flags:     flags,
+	}
+}
+
+// newUpgradeRecordID returns the timestamp followed by a random suffix, to keep the IDs of the upgrades
+// started in the same second distinct
+func newUpgradeRecordID(now time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return now.Format(upgradeRecordTimeFormat) + "-" + hex.EncodeToString(suffix)
+}
+
+// SetTarget fills the record with the target version and the images that the components run after the upgrade,
+// including the default images of the version for the components without image override
+func (r *UpgradeRecord) SetTarget(entandoAppV2 *images.EntandoApp) {
+	r.TargetVersion = entandoAppV2.Spec.Version
+	r.AppName = entandoAppV2.Spec.EntandoAppName
+	r.Images = nil
+	upgradeImages, _ := GetUpgradeImages(entandoAppV2)
+	for _, upgradeImage := range upgradeImages {
+		r.Images = append(r.Images, RecordedImage{
+			Component: upgradeImage.Component,
+			Image:     upgradeImage.Image,
+			Digest:    getPinnedDigest(upgradeImage.Image),
+		})
+	}
+}
+
+// CompleteUpgradeRecord sets the outcome of the upgrade and stores the record in the local history file
+// and, if the CR has been applied, as an annotation on the EntandoAppV2 resource.
+// Failures in storing the record are reported as warnings, to avoid hiding the upgrade result.
+func CompleteUpgradeRecord(record *UpgradeRecord, upgradeErr error) {
+	record.Duration = time.Since(record.Timestamp).Round(time.Second).String()
+	if upgradeErr == nil {
+		record.Outcome = OutcomeSucceeded
+	} else {
+		record.Outcome = OutcomeFailed
+		record.Error = upgradeErr.Error()
+	}
+
+	if err := AppendUpgradeRecord(record); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to store the upgrade record in the history file: %s\n", err.Error())
+	}
+
+	if record.ResourceName != "" {
+		value, err := json.Marshal(record)
+		if err == nil {
+			err = AnnotateEntandoApp(record.ResourceName, LastUpgradeAnnotation, string(value))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to annotate the %s resource with the upgrade record: %s\n", record.ResourceName, err.Error())
+		}
+	}
+}
+
+// AppendUpgradeRecord adds the record at the end of the history file
+func AppendUpgradeRecord(record *UpgradeRecord) error {
+	historyFile, err := GetHistoryFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(historyFile), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// ReadUpgradeRecords returns all the records stored in the history file, from the oldest to the newest
+func ReadUpgradeRecords() ([]UpgradeRecord, error) {
+	historyFile, err := GetHistoryFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(historyFile)
+	if os.IsNotExist(err) {
+		return []UpgradeRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []UpgradeRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record := UpgradeRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("invalid record at line %d of %s: %s", lineNumber, historyFile, err.Error())
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// FindUpgradeRecord returns the record having the given id
+func FindUpgradeRecord(id string) (*UpgradeRecord, error) {
+	records, err := ReadUpgradeRecords()
+	if err != nil {
+		return nil, err
+	}
+	// search from the newest, in case of duplicated ids
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ID == id {
+			return &records[i], nil
+		}
+	}
+	return nil, fmt.Errorf("upgrade record %s not found", id)
+}
+
+// GetHistoryFilePath returns the path of the history file, that can be customized using the related environment variable
+func GetHistoryFilePath() (string, error) {
+	if historyFile := os.Getenv(HistoryFileEnv); historyFile != "" {
+		return historyFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the home directory. You can set the history file path using the %s environment variable", HistoryFileEnv)
+	}
+	return filepath.Join(home, defaultHistoryDir, defaultHistoryFileName), nil
+}
+
+func getCurrentUser() string {
+	if currentUser, err := user.Current(); err == nil && currentUser.Username != "" {
+		return currentUser.Username
+	}
+	return os.Getenv("USER")
+}
+
+// getPinnedDigest returns the digest of an image referenced by digest, as pinned by AdaptImagesOverride,
+// without querying the registry. An empty string is returned for images referenced by tag.
+func getPinnedDigest(image string) string {
+	if index := strings.Index(image, "@"); index != -1 {
+		return image[index+1:]
+	}
+	return ""
+}
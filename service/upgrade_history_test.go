@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+)
+
+func TestUpgradeRecordsHistory(t *testing.T) {
+
+	historyFile := filepath.Join(t.TempDir(), "history", "upgrade-history.jsonl")
+	os.Setenv(HistoryFileEnv, historyFile)
+	defer os.Unsetenv(HistoryFileEnv)
+
+	records, err := ReadUpgradeRecords()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected empty history, found %d records", len(records))
+	}
+
+	first := NewUpgradeRecord(map[string]string{"version": "7.1.0"})
+	first.ID = "1"
+	CompleteUpgradeRecord(first, nil)
+
+	second := NewUpgradeRecord(map[string]string{"version": "7.1.1"})
+	second.ID = "2"
+	CompleteUpgradeRecord(second, errors.New("resource already exists"))
+
+	records, err = ReadUpgradeRecords()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, found %d", len(records))
+	}
+	if records[0].Outcome != OutcomeSucceeded || records[0].Flags["version"] != "7.1.0" {
+		t.Fatalf("unexpected first record %+v", records[0])
+	}
+
+	record, err := FindUpgradeRecord("2")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if record.Outcome != OutcomeFailed || record.Error != "resource already exists" {
+		t.Fatalf("unexpected second record %+v", record)
+	}
+
+	if _, err := FindUpgradeRecord("3"); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+func TestUpgradeRecordTarget(t *testing.T) {
+
+	entandoAppV2 := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoAppV2.Spec.Version = "7.1.1"
+	for _, imageInfo := range images.EntandoImages {
+		if imageInfo.ComponentName != "AppBuilder" {
+			*imageInfo.GetImageOverride(entandoAppV2) = "registry.hub.docker.com/entando/" + imageInfo.ComponentName + ":7.1.1"
+		}
+	}
+	entandoAppV2.Spec.DeApp.ImageOverride = "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1"
+	entandoAppV2.Spec.Keycloak.ImageOverride = "registry.hub.docker.com/entando/entando-keycloak@sha256:d550b07f5dd6d3e4b5a5f1e0cd1f41a3ea48f7a5ef33c83ef3d72b6a2fe8a2e9"
+
+	// the release manifest provides the default image of the component without override
+	appBuilderImage := images.GetImageInfo("AppBuilder")
+	manifestLocation := fmt.Sprintf(DefaultReleaseManifestUrl, "7.1.1")
+	releaseManifests[manifestLocation] = releaseManifest{versions: map[string]string{
+		images.ExtractRepo(appBuilderImage.DefaultImages[imagesettype.Community]): "7.1.1",
+	}}
+	defer delete(releaseManifests, manifestLocation)
+
+	record := NewUpgradeRecord(nil)
+	record.SetTarget(entandoAppV2)
+
+	if record.TargetVersion != "7.1.1" {
+		t.Fatalf("expected target version 7.1.1, found %s", record.TargetVersion)
+	}
+	if len(record.Images) != len(images.EntandoImages) {
+		t.Fatalf("expected %d images, found %d", len(images.EntandoImages), len(record.Images))
+	}
+	for _, image := range record.Images {
+		switch image.Component {
+		case "DeApp":
+			// the digest of images referenced by tag is not retrieved from the registry
+			if image.Image != "registry.hub.docker.com/entando/entando-de-app-eap:7.1.1" || image.Digest != "" {
+				t.Fatalf("unexpected image %+v", image)
+			}
+		case "AppBuilder":
+			if image.Image != appBuilderImage.GetDefaultImage(imagesettype.Community)+":7.1.1" {
+				t.Fatalf("unexpected default image %+v", image)
+			}
+		case "Keycloak":
+			if image.Digest != "sha256:d550b07f5dd6d3e4b5a5f1e0cd1f41a3ea48f7a5ef33c83ef3d72b6a2fe8a2e9" {
+				t.Fatalf("unexpected image %+v", image)
+			}
+		}
+	}
+}
+
+func TestUpgradeRecordIDsAreDistinct(t *testing.T) {
+	now := time.Now()
+	if first, second := newUpgradeRecordID(now), newUpgradeRecordID(now); first == second {
+		t.Fatalf("expected distinct IDs, found %s twice", first)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	imagesettype "upgrade-cli/flag/image_set_type"
+	"upgrade-cli/util/images"
+)
+
+// UpgradeImage is the image that a component runs after the upgrade
+type UpgradeImage struct {
+	Component string
+	Image     string
+}
+
+// GetUpgradeImages returns the images of the components after the upgrade: the image overrides of the EntandoAppV2
+// and, for the components without override, the default images of the version, read from its release manifest.
+// The components whose image can't be determined are returned separately.
+func GetUpgradeImages(entandoApp *images.EntandoApp) ([]UpgradeImage, []string) {
+	return resolveUpgradeImages(entandoApp, func() map[string]string {
+		return getVersionDefaultImages(entandoApp)
+	})
+}
+
+// resolveUpgradeImages works like GetUpgradeImages, loading the default images only if some component has no override
+func resolveUpgradeImages(entandoApp *images.EntandoApp, loadDefaultImages func() map[string]string) ([]UpgradeImage, []string) {
+	upgradeImages := []UpgradeImage{}
+	unresolved := []string{}
+	var defaultImages map[string]string
+
+	for _, imageInfo := range images.EntandoImages {
+		image := ""
+		if imageOverride := imageInfo.GetImageOverride(entandoApp); imageOverride != nil {
+			image = *imageOverride
+		}
+		if image == "" {
+			if defaultImages == nil {
+				defaultImages = loadDefaultImages()
+			}
+			image = defaultImages[imageInfo.ComponentName]
+		}
+		if image == "" {
+			unresolved = append(unresolved, imageInfo.ComponentName)
+			continue
+		}
+		upgradeImages = append(upgradeImages, UpgradeImage{Component: imageInfo.ComponentName, Image: image})
+	}
+
+	return upgradeImages, unresolved
+}
+
+// getVersionDefaultImages returns the default images of the version and image set of the EntandoAppV2.
+// If the release manifest can't be read a warning is printed and an empty set is returned.
+func getVersionDefaultImages(entandoApp *images.EntandoApp) map[string]string {
+	imageSet, err := GetVersionImageSet(entandoApp.Spec.Version, imagesettype.ImageSetType(entandoApp.Spec.ImageSetType), "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to determine the default images of version %s: %s\n", entandoApp.Spec.Version, err.Error())
+		return map[string]string{}
+	}
+	return imageSet
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"upgrade-cli/util/images"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+)
+
+func TestResolveUpgradeImages(t *testing.T) {
+
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	entandoApp.Spec.DeApp.ImageOverride = "registry.hub.docker.com/entando/entando-de-app-eap:7.1.2-fix1"
+
+	loads := 0
+	upgradeImages, unresolved := resolveUpgradeImages(entandoApp, func() map[string]string {
+		loads++
+		defaultImages := map[string]string{}
+		for _, imageInfo := range images.EntandoImages {
+			if imageInfo.ComponentName != "Keycloak" {
+				defaultImages[imageInfo.ComponentName] = "registry.hub.docker.com/entando/" + imageInfo.ComponentName + ":7.1.2"
+			}
+		}
+		return defaultImages
+	})
+
+	if loads != 1 {
+		t.Fatalf("expected the default images to be loaded once, loaded %d times", loads)
+	}
+	if len(unresolved) != 1 || unresolved[0] != "Keycloak" {
+		t.Fatalf("unexpected unresolved components %v", unresolved)
+	}
+	if len(upgradeImages) != len(images.EntandoImages)-1 {
+		t.Fatalf("unexpected images %+v", upgradeImages)
+	}
+	for _, upgradeImage := range upgradeImages {
+		if upgradeImage.Component == "DeApp" && upgradeImage.Image != "registry.hub.docker.com/entando/entando-de-app-eap:7.1.2-fix1" {
+			t.Fatalf("the image override was not used: %+v", upgradeImage)
+		}
+	}
+}
+
+func TestResolveUpgradeImagesWithAllOverrides(t *testing.T) {
+
+	entandoApp := images.NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	for _, imageInfo := range images.EntandoImages {
+		*imageInfo.GetImageOverride(entandoApp) = "registry.hub.docker.com/entando/" + imageInfo.ComponentName + ":7.1.2"
+	}
+
+	upgradeImages, unresolved := resolveUpgradeImages(entandoApp, func() map[string]string {
+		t.Fatalf("the default images should not be loaded")
+		return nil
+	})
+	if len(upgradeImages) != len(images.EntandoImages) || len(unresolved) != 0 {
+		t.Fatalf("unexpected images %+v, unresolved %v", upgradeImages, unresolved)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"upgrade-cli/util/version"
+)
+
+const (
+	verifyRequestTimeout = 15 * time.Second
+	verifyRetryInterval  = 5 * time.Second
+	certificateWarnDays  = 14
+)
+
+// VerifyEndpoint is an Entando endpoint probed after the upgrade
+type VerifyEndpoint struct {
+	Component string
+	Path      string
+	// true if the component reports the Entando version, that can be compared with the target one
+	ReleaseVersioned bool
+}
+
+// list of the endpoints checked by the verification
+var VerifyEndpoints = []VerifyEndpoint{
+	{Component: "AppBuilder", Path: "/app-builder/", ReleaseVersioned: true},
+	{Component: "DeApp", Path: "/entando-de-app/api/health", ReleaseVersioned: true},
+	{Component: "ComponentManager", Path: "/digital-exchange/actuator/health", ReleaseVersioned: true},
+	{Component: "Keycloak", Path: "/auth/realms/entando"},
+}
+
+// VerifyResult is the outcome of the check of a single endpoint
+type VerifyResult struct {
+	Component string
+	URL       string
+	Status    int
+	Version   string
+	TLS       string
+	Error     string
+	// set when the reported version differs from the expected one only in the patch number
+	Warning string
+	Passed  bool
+}
+
+// Verifier probes the Entando endpoints exposed on the ingress host
+type Verifier struct {
+	BaseURL string
+	Client  *http.Client
+	// Entando version expected from the components reporting it, not checked if empty
+	ExpectedVersion string
+}
+
+// NewVerifier creates a verifier for the given ingress host. If useTLS is false the endpoints are probed using plain HTTP.
+func NewVerifier(ingressHostName string, useTLS bool) (*Verifier, error) {
+	if ingressHostName == "" {
+		return nil, fmt.Errorf("the environment variable %s must be set", EntandoIngressHostNameEnv)
+	}
+	scheme := "https"
+	if !useTLS {
+		scheme = "http"
+	}
+	return &Verifier{
+		BaseURL: scheme + "://" + ingressHostName,
+		Client:  &http.Client{Timeout: verifyRequestTimeout},
+	}, nil
+}
+
+// Verify checks all the endpoints once
+func (v *Verifier) Verify() []VerifyResult {
+	results := []VerifyResult{}
+	for _, endpoint := range VerifyEndpoints {
+		results = append(results, v.checkEndpoint(endpoint))
+	}
+	return results
+}
+
+// VerifyUntil checks the endpoints repeatedly until all of them pass or the timeout expires,
+// since the applications may still be starting when the upgrade is completed
+func (v *Verifier) VerifyUntil(timeout time.Duration) []VerifyResult {
+	deadline := time.Now().Add(timeout)
+	for {
+		results := v.Verify()
+		if VerifyPassed(results) || time.Now().Add(verifyRetryInterval).After(deadline) {
+			return results
+		}
+		fmt.Fprintln(os.Stderr, "Some endpoints are not ready yet, retrying...")
+		time.Sleep(verifyRetryInterval)
+	}
+}
+
+// VerifyPassed returns true if all the checks passed
+func VerifyPassed(results []VerifyResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *Verifier) checkEndpoint(endpoint VerifyEndpoint) VerifyResult {
+	result := VerifyResult{
+		Component: endpoint.Component,
+		URL:       strings.TrimSuffix(v.BaseURL, "/") + endpoint.Path,
+		TLS:       "-",
+		Version:   "-",
+	}
+
+	resp, err := v.Client.Get(result.URL)
+	if err != nil {
+		if strings.HasPrefix(v.BaseURL, "https") {
+			result.TLS = "unknown"
+		}
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		notAfter := resp.TLS.PeerCertificates[0].NotAfter
+		result.TLS = "valid until " + notAfter.Format("2006-01-02")
+		if time.Until(notAfter) < certificateWarnDays*24*time.Hour {
+			result.TLS = "expiring on " + notAfter.Format("2006-01-02")
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	healthStatus, version := parseEndpointBody(body)
+	if version != "" {
+		result.Version = version
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		result.Error = fmt.Sprintf("unexpected HTTP status %d", resp.StatusCode)
+	} else if healthStatus != "" && healthStatus != "UP" {
+		result.Error = "health status is " + healthStatus
+	} else if endpoint.ReleaseVersioned {
+		result.Passed, result.Error, result.Warning = checkReportedVersion(version, v.ExpectedVersion)
+	} else {
+		result.Passed = true
+	}
+
+	return result
+}
+
+// checkReportedVersion compares the reported version with the expected one: a different major or minor version
+// means that an old instance is still answering, while a different patch is only reported as a warning,
+// since fix releases don't update all the components
+func checkReportedVersion(reported, expected string) (bool, string, string) {
+	if reported == "" || expected == "" {
+		return true, "", ""
+	}
+	reportedVersion, err := version.Parse(reported)
+	if err != nil {
+		return true, "", ""
+	}
+	expectedVersion, err := version.Parse(expected)
+	if err != nil {
+		return true, "", ""
+	}
+	if reportedVersion.MajorMinor() != expectedVersion.MajorMinor() {
+		return false, fmt.Sprintf("reported version %s, expected %s", reported, expected), ""
+	}
+	if reportedVersion.Compare(expectedVersion) != 0 {
+		return true, "", fmt.Sprintf("reported version %s, expected %s", reported, expected)
+	}
+	return true, "", ""
+}
+
+// parseEndpointBody extracts the health status and the version from a JSON response, when available
+func parseEndpointBody(body []byte) (string, string) {
+	parsedBody := map[string]interface{}{}
+	if err := json.Unmarshal(body, &parsedBody); err != nil {
+		return "", ""
+	}
+
+	status, _ := parsedBody["status"].(string)
+
+	version, _ := parsedBody["version"].(string)
+	if build, ok := parsedBody["build"].(map[string]interface{}); ok && version == "" {
+		version, _ = build["version"].(string)
+	}
+
+	return status, version
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app-builder/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/entando-de-app/api/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"UP"}`))
+	})
+	mux.HandleFunc("/digital-exchange/actuator/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"DOWN"}`))
+	})
+	mux.HandleFunc("/auth/realms/entando", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"realm":"entando","version":"18.0.2"}`))
+	})
+
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	verifier := Verifier{BaseURL: server.URL, Client: server.Client()}
+	results := verifier.Verify()
+
+	if len(results) != len(VerifyEndpoints) {
+		t.Fatalf("expected %d results, found %d", len(VerifyEndpoints), len(results))
+	}
+	if VerifyPassed(results) {
+		t.Fatalf("verification should fail")
+	}
+
+	for _, result := range results {
+		if !strings.HasPrefix(result.TLS, "valid until") {
+			t.Fatalf("unexpected TLS status for %s: %s", result.Component, result.TLS)
+		}
+		switch result.Component {
+		case "ComponentManager":
+			if result.Passed || result.Status != http.StatusServiceUnavailable {
+				t.Fatalf("unexpected result %+v", result)
+			}
+		case "Keycloak":
+			if !result.Passed || result.Version != "18.0.2" {
+				t.Fatalf("unexpected result %+v", result)
+			}
+		default:
+			if !result.Passed {
+				t.Fatalf("unexpected result %+v", result)
+			}
+		}
+	}
+}
+
+func TestVerifyUntrustedCertificate(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	verifier := Verifier{BaseURL: server.URL, Client: &http.Client{}}
+	results := verifier.Verify()
+
+	if results[0].Passed || results[0].TLS != "unknown" || !strings.Contains(results[0].Error, "certificate") {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestCheckReportedVersion(t *testing.T) {
+	if passed, _, warning := checkReportedVersion("7.1.2", "7.1.2"); !passed || warning != "" {
+		t.Fatalf("the same version should pass")
+	}
+	if passed, _, warning := checkReportedVersion("7.1.3", "v7.1.2"); !passed || warning == "" {
+		t.Fatalf("a different patch should pass with a warning")
+	}
+	if passed, err, _ := checkReportedVersion("7.0.2", "7.1.2"); passed || err != "reported version 7.0.2, expected 7.1.2" {
+		t.Fatalf("a different minor version should fail")
+	}
+	if passed, _, _ := checkReportedVersion("", "7.1.2"); !passed {
+		t.Fatalf("a missing version should not be checked")
+	}
+}
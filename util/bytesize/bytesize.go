@@ -0,0 +1,21 @@
+package bytesize
+
+import "fmt"
+
+// Format returns the size in human readable format, or a dash if it isn't known
+func Format(size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
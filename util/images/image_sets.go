@@ -0,0 +1,90 @@
+package images
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	imagesettype "upgrade-cli/flag/image_set_type"
+)
+
+// ImageSetDescriptor describes a custom image set, e.g. FIPS or hardened builds of the Entando images
+type ImageSetDescriptor struct {
+	Name string `json:"name"`
+	// registry and organization of the images of the set, e.g. registry.example.com/entando-fips
+	Registry string `json:"registry"`
+	// repository for each component; components not listed use the name of their Community repository
+	Repos map[string]string `json:"repos,omitempty"`
+}
+
+var imageSetNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// registered custom image sets
+var customImageSets = map[imagesettype.ImageSetType]ImageSetDescriptor{}
+
+// RegisterImageSet validates the descriptor and makes the image set selectable using the image-set-type flag
+func RegisterImageSet(descriptor ImageSetDescriptor) error {
+	imageSetType := imagesettype.ImageSetType(descriptor.Name)
+	if !imageSetNameRegexp.MatchString(descriptor.Name) {
+		return fmt.Errorf("invalid image set name '%s'", descriptor.Name)
+	}
+	if !imagesettype.IsCustom(imageSetType) {
+		return fmt.Errorf("the built-in image set %s can't be redefined, change the defaultRepos of the components instead", descriptor.Name)
+	}
+	if descriptor.Registry == "" || strings.HasSuffix(descriptor.Registry, "/") {
+		return fmt.Errorf("invalid registry '%s' for image set %s", descriptor.Registry, descriptor.Name)
+	}
+
+	customImageSets[imageSetType] = descriptor
+	imagesettype.AddImageSetType(imageSetType)
+	return nil
+}
+
+// validateImageSets checks that the repositories of the custom image sets refer to registered components
+func validateImageSets() error {
+	for _, imageSet := range customImageSets {
+		for componentName := range imageSet.Repos {
+			if GetImageInfo(componentName) == nil {
+				return fmt.Errorf("image set %s refers to unknown component %s", imageSet.Name, componentName)
+			}
+		}
+	}
+	return nil
+}
+
+// getImageSetDefaultImage returns the default image of the component in a custom image set, or an empty string
+// if the image set is not a custom one
+func getImageSetDefaultImage(imageInfo EntandoImageInfo, imageSetType imagesettype.ImageSetType) string {
+	imageSet, ok := customImageSets[imageSetType]
+	if !ok {
+		return ""
+	}
+	repo, ok := imageSet.Repos[imageInfo.ComponentName]
+	if !ok {
+		repo = ExtractRepo(imageInfo.DefaultImages[imagesettype.Community])
+	}
+	return imageSet.Registry + "/" + repo
+}
+
+// GetImageInfo returns the registered component with the given name, or nil
+func GetImageInfo(componentName string) *EntandoImageInfo {
+	for i, imageInfo := range EntandoImages {
+		if imageInfo.ComponentName == componentName {
+			return &EntandoImages[i]
+		}
+	}
+	return nil
+}
+
+// GetImageSetTypesOf returns the image set types whose default image of the component matches the provided image,
+// ignoring tags and digests. The image must include the registry.
+func GetImageSetTypesOf(image string, imageInfo EntandoImageInfo) []imagesettype.ImageSetType {
+	imageSetTypes := []imagesettype.ImageSetType{}
+	imageName := StripTagAndDigest(image)
+	for _, value := range imagesettype.GetImageSetTypeValues() {
+		imageSetType := imagesettype.ImageSetType(value)
+		if imageSetType != imagesettype.Auto && imageInfo.GetDefaultImage(imageSetType) == imageName {
+			imageSetTypes = append(imageSetTypes, imageSetType)
+		}
+	}
+	return imageSetTypes
+}
@@ -0,0 +1,44 @@
+package images
+
+import (
+	"reflect"
+	"testing"
+	imagesettype "upgrade-cli/flag/image_set_type"
+)
+
+func TestRegisterImageSet(t *testing.T) {
+
+	fips := imagesettype.ImageSetType("Fips")
+	defer delete(customImageSets, fips)
+
+	err := RegisterImageSet(ImageSetDescriptor{Name: "Fips", Registry: "registry.example.com/entando-fips",
+		Repos: map[string]string{"Keycloak": "entando-keycloak-fips"}})
+	if err != nil {
+		t.Fatalf("unable to register image set: %s", err.Error())
+	}
+	if err := validateImageSets(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err.Error())
+	}
+
+	keycloak := GetImageInfo("Keycloak")
+	if image := keycloak.GetDefaultImage(fips); image != "registry.example.com/entando-fips/entando-keycloak-fips" {
+		t.Fatalf("unexpected Keycloak image %s", image)
+	}
+	appBuilder := GetImageInfo("AppBuilder")
+	if image := appBuilder.GetDefaultImage(fips); image != "registry.example.com/entando-fips/app-builder" {
+		t.Fatalf("unexpected AppBuilder image %s", image)
+	}
+
+	imageSetTypes := GetImageSetTypesOf("registry.example.com/entando-fips/app-builder:7.1.1", *appBuilder)
+	if !reflect.DeepEqual(imageSetTypes, []imagesettype.ImageSetType{fips}) {
+		t.Fatalf("unexpected image set types %v", imageSetTypes)
+	}
+	imageSetTypes = GetImageSetTypesOf("registry.hub.docker.com/entando/app-builder@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", *appBuilder)
+	if !reflect.DeepEqual(imageSetTypes, []imagesettype.ImageSetType{imagesettype.RedhatCertified, imagesettype.Community}) {
+		t.Fatalf("unexpected image set types %v", imageSetTypes)
+	}
+
+	if err := RegisterImageSet(ImageSetDescriptor{Name: "Community", Registry: "registry.example.com/entando"}); err == nil {
+		t.Fatalf("built-in image sets should not be redefined")
+	}
+}
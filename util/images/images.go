@@ -2,11 +2,8 @@ package images
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	imagesettype "upgrade-cli/flag/image_set_type"
-
-	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
 )
 
 const (
@@ -29,129 +26,117 @@ type EntandoImageInfo struct {
 	ComponentName string
 	// name of the flag used to specify the image override
 	ImageOverrideFlag string
-	// true if the component supports different images depending on the imageSetType
+	// true if the component defines different default images depending on the imageSetType
 	IsMultiImage bool
-	// returns the default image according to the specified imageSetType
-	// if the component is not multi-image the function returns a constant value
-	GetDefaultImage func(imageSetType imagesettype.ImageSetType) string
-	// returns the reference to the related ImageOverride field in EntandoAppV2
-	GetImageOverride func(entandoApp *v1alpha1.EntandoAppV2) *string
+	// default image for each imageSetType
+	DefaultImages map[imagesettype.ImageSetType]string
+	// JSONPath of the image override field in the EntandoAppV2 resource
+	SpecPath string
+	specKeys []string
 }
 
-// list of all the Entando components images
-var EntandoImages = []EntandoImageInfo{
-
-	mkEntandoComponentInfoMultiImage("DeApp", "image-de-app",
-		defaultDeAppWildflyImage, defaultDeAppEapImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.DeApp.ImageOverride
-		}),
-
-	mkEntandoComponentInfoSingleImage("AppBuilder", "image-app-builder",
-		defaultAppBuilderImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.AppBuilder.ImageOverride
-		}),
-
-	mkEntandoComponentInfoSingleImage("ComponentManager", "image-component-manager",
-		defaultComponentManagerImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.ComponentManager.ImageOverride
-		}),
-
-	mkEntandoComponentInfoMultiImage("Keycloak", "image-keycloak",
-		defaultKeycloakImage, defaultRedHatSsoImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.Keycloak.ImageOverride
-		}),
-
-	mkEntandoComponentInfoSingleImage("K8sService", "image-k8s-service",
-		defaultK8sServiceImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.K8sService.ImageOverride
-		}),
+// list of all the Entando components images, built from the registered component descriptors
+var EntandoImages = []EntandoImageInfo{}
 
-	mkEntandoComponentInfoSingleImage("K8sPluginController", "image-k8s-plugin-controller",
-		defaultK8sPluginControllerImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.K8sPluginController.ImageOverride
-		}),
-
-	mkEntandoComponentInfoSingleImage("K8sAppPluginLinkController", "image-k8s-app-plugin-link-controller",
-		defaultK8sAppPluginLinkControllerImage,
-		func(entandoApp *v1alpha1.EntandoAppV2) *string {
-			return &entandoApp.Spec.K8sAppPluginLinkController.ImageOverride
-		}),
+// GetDefaultImage returns the default image according to the specified imageSetType.
+// Custom image sets provide the image from their registry, unless the component defines its own default repository.
+// If the component has no image for the imageSetType, the Community one is returned.
+func (i EntandoImageInfo) GetDefaultImage(imageSetType imagesettype.ImageSetType) string {
+	if image, ok := i.DefaultImages[imageSetType]; ok {
+		return image
+	}
+	if image := getImageSetDefaultImage(i, imageSetType); image != "" {
+		return image
+	}
+	return i.DefaultImages[imagesettype.Community]
 }
 
-func mkEntandoComponentInfoSingleImage(name, flag, defaultRepo string, getImageOverride func(entandoApp *v1alpha1.EntandoAppV2) *string) EntandoImageInfo {
-	return EntandoImageInfo{
-		ComponentName:     name,
-		ImageOverrideFlag: flag,
-		IsMultiImage:      false,
-		GetDefaultImage:   mkGetDefaultSingleImage(defaultRepo),
-		GetImageOverride:  getImageOverride,
+// GetDefaultRepos returns the repositories of the default images of the component, for all the image set types
+func (i EntandoImageInfo) GetDefaultRepos() []string {
+	repos := []string{}
+	for _, value := range imagesettype.GetImageSetTypeValues() {
+		if value == string(imagesettype.Auto) {
+			continue
+		}
+		repo := ExtractRepo(i.GetDefaultImage(imagesettype.ImageSetType(value)))
+		if !containsString(repos, repo) {
+			repos = append(repos, repo)
+		}
 	}
+	return repos
 }
 
-func mkEntandoComponentInfoMultiImage(name, flag, defaultRepoCommunity, defaultRepoCertified string, getImageOverride func(entandoApp *v1alpha1.EntandoAppV2) *string) EntandoImageInfo {
-	return EntandoImageInfo{
-		ComponentName:     name,
-		ImageOverrideFlag: flag,
-		IsMultiImage:      true,
-		GetDefaultImage:   mkGetDefaultMultiImage(defaultRepoCommunity, defaultRepoCertified),
-		GetImageOverride:  getImageOverride,
-	}
+// GetImageOverride returns the reference to the related image override field in EntandoAppV2
+func (i EntandoImageInfo) GetImageOverride(entandoApp *EntandoApp) *string {
+	return getSpecField(entandoApp, i.specKeys)
 }
 
-func mkGetDefaultMultiImage(repoCommunity, repoCertified string) func(imageSetType imagesettype.ImageSetType) string {
-	return func(imageSetType imagesettype.ImageSetType) string {
-		if imageSetType == imagesettype.Community {
-			return mkDefaultImage(repoCommunity)
+func mkDefaultImage(repo string) string {
+	if strings.Contains(repo, "/") {
+		if ContainsRegistry(repo) {
+			return repo
 		}
-		return mkDefaultImage(repoCertified)
+		return fmt.Sprintf("%s/%s", DefaultRegistry, repo)
 	}
+	return fmt.Sprintf("%s/%s/%s", DefaultRegistry, DefaultOrganization, repo)
 }
 
-func mkGetDefaultSingleImage(repo string) func(imageSetType imagesettype.ImageSetType) string {
-	return func(imageSetType imagesettype.ImageSetType) string {
-		return mkDefaultImage(repo)
+// ExtractRepo extracts the last component of the repository path from the image reference.
+// Returns an empty string if the reference is not valid
+func ExtractRepo(image string) string {
+	imageRef, err := ParseImage(image)
+	if err != nil {
+		return ""
 	}
+	return imageRef.Repo()
 }
 
-func mkDefaultImage(repo string) string {
-	return fmt.Sprintf("%s/%s/%s", DefaultRegistry, DefaultOrganization, repo)
+// ExtractTag extracts the tag from the image reference. Returns an empty string if the image has no tag
+func ExtractTag(image string) string {
+	imageRef, err := ParseImage(image)
+	if err != nil {
+		return ""
+	}
+	return imageRef.Tag
 }
 
-// ExtractRepo extracts repository name from image full URL
-func ExtractRepo(image string) string {
-	re := regexp.MustCompile(`^.+/([^@:]+)(?:@sha256)?:?.*$`)
-	matches := re.FindStringSubmatch(image)
-	if len(matches) == 2 {
-		return matches[1]
+// StripTagAndDigest removes the tag and the digest from an image reference.
+// Returns the provided value if the reference is not valid
+func StripTagAndDigest(image string) string {
+	imageRef, err := ParseImage(image)
+	if err != nil {
+		return image
 	}
-	return ""
+	return imageRef.Name()
 }
 
 // IsOfficialImage returns true if the provided image is an official Entando image
 func IsOfficialImage(image string) bool {
-	return strings.HasPrefix(image, DefaultRegistry+"/"+DefaultOrganization+"/")
+	imageRef, err := ParseImage(image)
+	if err != nil {
+		return false
+	}
+	return imageRef.Registry == DefaultRegistry && strings.HasPrefix(imageRef.Path, DefaultOrganization+"/")
 }
 
 // ContainsRegistry returns true if the provided image contains a registry
 func ContainsRegistry(image string) bool {
-	re := regexp.MustCompile(`^[\w-\.]+\.[\w-\.]+\/[\w-\/@\.:]+$`)
-	return re.MatchString(image)
+	imageRef, err := ParseImage(image)
+	return err == nil && imageRef.Registry != ""
 }
 
 // IsValidImageOverride returns true if the provided value can be used as image override flag
 // Accepted values are:
 // - <tag>
-// - <organization>/<repo>:<tag>
-// - <organization>/<repo>@sha256:<sha>
-// - <registry>/<organization>/<repo>:<tag>
-// - <registry>/<organization>/<repo>@sha256:<sha>
+// - [<registry>[:<port>]/]<organization>[/<path>]/<repo>[:<tag>][@<algorithm>:<digest>]
 func IsValidImageOverride(imageOverride string) bool {
-	re := regexp.MustCompile(`^([\w-\.]+\/)?([\w-]+\/[\w-]+(@sha256)?)?:?[\w-\.]+$`)
-	return re.MatchString(imageOverride)
+	if !strings.ContainsAny(imageOverride, "/:@") {
+		return IsValidTag(imageOverride)
+	}
+	imageRef, err := ParseImage(imageOverride)
+	if err != nil {
+		return false
+	}
+	// the organization is required
+	return strings.Contains(imageRef.Path, "/")
 }
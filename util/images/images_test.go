@@ -4,7 +4,7 @@ import "testing"
 
 func TestExtractRepoOLM(t *testing.T) {
 
-	extractedRepo := ExtractRepo("registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525")
+	extractedRepo := ExtractRepo("registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f")
 	expectedRepo := "entando-de-app-eap"
 	if extractedRepo != expectedRepo {
 		t.Fatalf("expected %s, found %s", expectedRepo, extractedRepo)
@@ -47,7 +47,7 @@ func TestIsValidImageOverride(t *testing.T) {
 	checkIsValidImageOverride(t, "7.1.0", true)
 	checkIsValidImageOverride(t, "entando/entando-de-app-wildfly:7.1.0", true)
 	checkIsValidImageOverride(t, "registry.hub.docker.com/entando/entando-de-app-wildfly:7.1.0", true)
-	checkIsValidImageOverride(t, "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525", true)
+	checkIsValidImageOverride(t, "registry.hub.docker.com/entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", true)
 	// Invalid
 	checkIsValidImageOverride(t, "entando-de-app-wildfly:7.1.0", false)
 	checkIsValidImageOverride(t, "https://registry.hub.docker.com/r/entando/entando-de-app-wildfly", false)
@@ -58,3 +58,15 @@ func checkIsValidImageOverride(t *testing.T, imageOverride string, expected bool
 		t.Fatalf("IsValidImageOverride returned %v for %s", !expected, imageOverride)
 	}
 }
+
+func TestExtractTag(t *testing.T) {
+	checkExtractTag(t, "registry.hub.docker.com/entando/entando-k8s-controller-coordinator:7.1.0", "7.1.0")
+	checkExtractTag(t, "localhost:5000/entando/entando-k8s-controller-coordinator", "")
+	checkExtractTag(t, "entando/entando-de-app-eap@sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f", "")
+}
+
+func checkExtractTag(t *testing.T, image, expected string) {
+	if tag := ExtractTag(image); tag != expected {
+		t.Fatalf("expected tag '%s' for %s, found '%s'", expected, image, tag)
+	}
+}
@@ -0,0 +1,83 @@
+package images
+
+import (
+	// digest algorithms supported in image references
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+var tagRegexp = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+
+// ImageReference is an image reference parsed according to the OCI distribution grammar
+type ImageReference struct {
+	// registry host with optional port, empty if not specified
+	Registry string
+	// repository path without registry, e.g. entando/app-builder or org/team/repo
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// ParseImage parses an image reference like [registry[:port]/]path[:tag][@digest].
+// The registry is recognized when the first path component contains a dot or a port or is localhost.
+func ParseImage(image string) (*ImageReference, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return nil, err
+	}
+
+	named, ok := ref.(reference.Named)
+	if !ok {
+		// the reference contains only a digest
+		return nil, reference.ErrNameEmpty
+	}
+
+	imageRef := ImageReference{Path: named.Name()}
+	if index := strings.Index(imageRef.Path, "/"); index != -1 {
+		first := imageRef.Path[:index]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			imageRef.Registry, imageRef.Path = first, imageRef.Path[index+1:]
+		}
+	}
+	if tagged, ok := ref.(reference.Tagged); ok {
+		imageRef.Tag = tagged.Tag()
+	}
+	if digested, ok := ref.(reference.Digested); ok {
+		imageRef.Digest = digested.Digest().String()
+	}
+	return &imageRef, nil
+}
+
+// Name returns the registry and the repository path, without tag and digest
+func (r ImageReference) Name() string {
+	if r.Registry == "" {
+		return r.Path
+	}
+	return r.Registry + "/" + r.Path
+}
+
+// Repo returns the last component of the repository path
+func (r ImageReference) Repo() string {
+	return r.Path[strings.LastIndex(r.Path, "/")+1:]
+}
+
+// String returns the full reference
+func (r ImageReference) String() string {
+	image := r.Name()
+	if r.Tag != "" {
+		image += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		image += "@" + r.Digest
+	}
+	return image
+}
+
+// IsValidTag returns true if the value is a valid image tag
+func IsValidTag(tag string) bool {
+	return tagRegexp.MatchString(tag)
+}
@@ -0,0 +1,80 @@
+package images
+
+import "testing"
+
+const (
+	testSha256 = "sha256:94af0fb4525e5d66bb39d6a3ec07dd97ce3a3a2b1bd1a4b6b6d6b1fc0b7d0a6f"
+	testSha512 = "sha512:cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"
+)
+
+func TestParseImage(t *testing.T) {
+
+	validReferences := []struct {
+		image    string
+		expected ImageReference
+	}{
+		{"entando/app-builder", ImageReference{Path: "entando/app-builder"}},
+		{"entando/app-builder:7.1.0", ImageReference{Path: "entando/app-builder", Tag: "7.1.0"}},
+		{"registry.hub.docker.com/entando/app-builder:7.1.0", ImageReference{Registry: "registry.hub.docker.com", Path: "entando/app-builder", Tag: "7.1.0"}},
+		{"localhost:5000/entando/app-builder:7.1.0", ImageReference{Registry: "localhost:5000", Path: "entando/app-builder", Tag: "7.1.0"}},
+		{"localhost/entando/app-builder", ImageReference{Registry: "localhost", Path: "entando/app-builder"}},
+		{"registry.example.com:8443/org/team/app-builder:v1", ImageReference{Registry: "registry.example.com:8443", Path: "org/team/app-builder", Tag: "v1"}},
+		{"entando/app-builder@" + testSha256, ImageReference{Path: "entando/app-builder", Digest: testSha256}},
+		{"quay.io/entando/app-builder:7.1.0@" + testSha256, ImageReference{Registry: "quay.io", Path: "entando/app-builder", Tag: "7.1.0", Digest: testSha256}},
+		{"quay.io/entando/app-builder@" + testSha512, ImageReference{Registry: "quay.io", Path: "entando/app-builder", Digest: testSha512}},
+		{"app-builder:7.1.1-ENG-4277-PR-1413", ImageReference{Path: "app-builder", Tag: "7.1.1-ENG-4277-PR-1413"}},
+	}
+
+	for _, test := range validReferences {
+		imageRef, err := ParseImage(test.image)
+		if err != nil {
+			t.Fatalf("unable to parse %s: %s", test.image, err.Error())
+		}
+		if *imageRef != test.expected {
+			t.Fatalf("unexpected reference for %s: %+v", test.image, imageRef)
+		}
+		if imageRef.String() != test.image {
+			t.Fatalf("expected %s, found %s", test.image, imageRef.String())
+		}
+	}
+
+	invalidReferences := []string{
+		"",
+		"https://registry.hub.docker.com/r/entando/app-builder",
+		"Entando/App-Builder:7.1.0",
+		"entando/app-builder:",
+		"entando/app-builder:tag with spaces",
+		"entando/app-builder@sha256:94af0fb4525",
+		"entando/app-builder@md5:d41d8cd98f00b204e9800998ecf8427e",
+		"entando//app-builder",
+		"@" + testSha256,
+	}
+
+	for _, image := range invalidReferences {
+		if _, err := ParseImage(image); err == nil {
+			t.Fatalf("%s should be invalid", image)
+		}
+	}
+}
+
+func TestIsValidImageOverrideCorpus(t *testing.T) {
+
+	overrides := map[string]bool{
+		"7.1.0":                  true,
+		"7.1.1-ENG-4277-PR-1413": true,
+		"entando/app-builder":    true,
+		"localhost:5000/entando/app-builder:7.1.0":                     true,
+		"registry.example.com/org/team/app-builder:7.1.0":              true,
+		"registry.example.com/entando/app-builder:7.1.0@" + testSha256: true,
+		"registry.example.com/entando/app-builder@" + testSha512:       true,
+		"app-builder:7.1.0":                              false,
+		"localhost:5000/app-builder:7.1.0":               false,
+		"-7.1.0":                                         false,
+		"entando/app-builder@sha256:94af0fb4525":         false,
+		"registry.example.com/entando/App-Builder:7.1.0": false,
+	}
+
+	for override, expected := range overrides {
+		checkIsValidImageOverride(t, override, expected)
+	}
+}
@@ -0,0 +1,165 @@
+package images
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	imagesettype "upgrade-cli/flag/image_set_type"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ComponentsFileEnv is the environment variable containing the path of a YAML descriptor of additional components
+const ComponentsFileEnv = "ENTANDO_CLI_COMPONENTS_FILE"
+
+// ComponentDescriptor describes an Entando component and how its image is set in the EntandoAppV2
+type ComponentDescriptor struct {
+	Name string `json:"name"`
+	// name of the flag used to specify the image override
+	Flag string `json:"flag"`
+	// default repository for each imageSetType. A repository without registry and organization refers to the official Entando images
+	DefaultRepos map[string]string `json:"defaultRepos"`
+	// JSONPath of the image override field in the EntandoAppV2 resource, e.g. {.spec.deApp.imageOverride}
+	SpecPath string `json:"specPath"`
+}
+
+// ComponentsDescriptor is the content of the YAML file used to extend the components registry
+type ComponentsDescriptor struct {
+	ImageSets  []ImageSetDescriptor  `json:"imageSets,omitempty"`
+	Components []ComponentDescriptor `json:"components,omitempty"`
+}
+
+var flagNameRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var builtinComponents = []ComponentDescriptor{
+	{Name: "DeApp", Flag: "image-de-app", SpecPath: "{.spec.deApp.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultDeAppWildflyImage, string(imagesettype.RedhatCertified): defaultDeAppEapImage}},
+	{Name: "AppBuilder", Flag: "image-app-builder", SpecPath: "{.spec.appBuilder.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultAppBuilderImage}},
+	{Name: "ComponentManager", Flag: "image-component-manager", SpecPath: "{.spec.componentManager.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultComponentManagerImage}},
+	{Name: "Keycloak", Flag: "image-keycloak", SpecPath: "{.spec.keycloak.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultKeycloakImage, string(imagesettype.RedhatCertified): defaultRedHatSsoImage}},
+	{Name: "K8sService", Flag: "image-k8s-service", SpecPath: "{.spec.k8sService.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultK8sServiceImage}},
+	{Name: "K8sPluginController", Flag: "image-k8s-plugin-controller", SpecPath: "{.spec.k8sPluginController.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultK8sPluginControllerImage}},
+	{Name: "K8sAppPluginLinkController", Flag: "image-k8s-app-plugin-link-controller", SpecPath: "{.spec.k8sAppPluginLinkController.imageOverride}", DefaultRepos: map[string]string{
+		string(imagesettype.Community): defaultK8sAppPluginLinkControllerImage}},
+}
+
+func init() {
+	for _, descriptor := range builtinComponents {
+		if err := RegisterComponent(descriptor); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LoadComponentsDescriptorFromEnv registers the components defined in the descriptor set in the environment, if any
+func LoadComponentsDescriptorFromEnv() error {
+	if fileName := os.Getenv(ComponentsFileEnv); fileName != "" {
+		return LoadComponentsDescriptor(fileName)
+	}
+	return nil
+}
+
+// LoadComponentsDescriptor registers the image sets and the components defined in a YAML file.
+// Components having the name of an already registered component replace it.
+func LoadComponentsDescriptor(fileName string) error {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("unable to read components descriptor %s. %s", fileName, err.Error())
+	}
+
+	descriptor := ComponentsDescriptor{}
+	if err := yaml.UnmarshalStrict(content, &descriptor); err != nil {
+		return fmt.Errorf("unable to parse components descriptor %s. %s", fileName, err.Error())
+	}
+
+	// image sets are registered first, since components can define their repositories for the custom image sets
+	for _, imageSet := range descriptor.ImageSets {
+		if err := RegisterImageSet(imageSet); err != nil {
+			return fmt.Errorf("invalid components descriptor %s. %s", fileName, err.Error())
+		}
+	}
+	for _, component := range descriptor.Components {
+		if err := RegisterComponent(component); err != nil {
+			return fmt.Errorf("invalid components descriptor %s. %s", fileName, err.Error())
+		}
+	}
+	if err := validateImageSets(); err != nil {
+		return fmt.Errorf("invalid components descriptor %s. %s", fileName, err.Error())
+	}
+	return nil
+}
+
+// RegisterComponent validates the descriptor and adds the component to EntandoImages
+func RegisterComponent(descriptor ComponentDescriptor) error {
+	imageInfo, err := newEntandoImageInfo(descriptor)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, registered := range EntandoImages {
+		if registered.ComponentName == imageInfo.ComponentName {
+			index = i
+		} else if registered.ImageOverrideFlag == imageInfo.ImageOverrideFlag {
+			return fmt.Errorf("flag %s of component %s is already used by component %s", imageInfo.ImageOverrideFlag, imageInfo.ComponentName, registered.ComponentName)
+		}
+	}
+
+	if index == -1 {
+		EntandoImages = append(EntandoImages, *imageInfo)
+	} else {
+		EntandoImages[index] = *imageInfo
+	}
+	return nil
+}
+
+func newEntandoImageInfo(descriptor ComponentDescriptor) (*EntandoImageInfo, error) {
+	if descriptor.Name == "" {
+		return nil, fmt.Errorf("component name is required")
+	}
+	if !flagNameRegexp.MatchString(descriptor.Flag) {
+		return nil, fmt.Errorf("invalid flag name '%s' for component %s", descriptor.Flag, descriptor.Name)
+	}
+	if _, ok := descriptor.DefaultRepos[string(imagesettype.Community)]; !ok {
+		return nil, fmt.Errorf("the %s default repository is required for component %s", imagesettype.Community, descriptor.Name)
+	}
+
+	specKeys, err := parseSpecPath(descriptor.SpecPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specPath for component %s. %s", descriptor.Name, err.Error())
+	}
+
+	imageInfo := EntandoImageInfo{
+		ComponentName:     descriptor.Name,
+		ImageOverrideFlag: descriptor.Flag,
+		DefaultImages:     map[imagesettype.ImageSetType]string{},
+		SpecPath:          descriptor.SpecPath,
+		specKeys:          specKeys,
+	}
+
+	for imageSetType, repo := range descriptor.DefaultRepos {
+		if !containsString(imagesettype.GetImageSetTypeValues(), imageSetType) || imageSetType == string(imagesettype.Auto) {
+			return nil, fmt.Errorf("unknown image set type %s for component %s", imageSetType, descriptor.Name)
+		}
+		imageInfo.DefaultImages[imagesettype.ImageSetType(imageSetType)] = mkDefaultImage(repo)
+	}
+	for _, image := range imageInfo.DefaultImages {
+		imageInfo.IsMultiImage = imageInfo.IsMultiImage || image != imageInfo.DefaultImages[imagesettype.Community]
+	}
+
+	return &imageInfo, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	imagesettype "upgrade-cli/flag/image_set_type"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+)
+
+const componentsDescriptor = `
+components:
+  - name: K8sFooController
+    flag: image-k8s-foo-controller
+    defaultRepos:
+      Community: entando-k8s-foo-controller
+      RedhatCertified: quay.io/acme/foo-controller-certified
+    specPath: "{.spec.k8sFooController.imageOverride}"
+  - name: AppBuilder
+    flag: image-app-builder
+    defaultRepos:
+      Community: acme/app-builder
+    specPath: "{.spec.appBuilder.imageOverride}"
+`
+
+func TestLoadComponentsDescriptor(t *testing.T) {
+
+	builtinImages := append([]EntandoImageInfo{}, EntandoImages...)
+	defer func() { EntandoImages = builtinImages }()
+
+	fileName := filepath.Join(t.TempDir(), "components.yaml")
+	os.WriteFile(fileName, []byte(componentsDescriptor), 0644)
+
+	if err := LoadComponentsDescriptor(fileName); err != nil {
+		t.Fatalf("unable to load descriptor: %s", err.Error())
+	}
+
+	if len(EntandoImages) != len(builtinImages)+1 {
+		t.Fatalf("expected %d components, found %d", len(builtinImages)+1, len(EntandoImages))
+	}
+
+	appBuilder := EntandoImages[1]
+	if appBuilder.GetDefaultImage(imagesettype.RedhatCertified) != "registry.hub.docker.com/acme/app-builder" {
+		t.Fatalf("unexpected AppBuilder default image %s", appBuilder.GetDefaultImage(imagesettype.RedhatCertified))
+	}
+
+	foo := EntandoImages[len(EntandoImages)-1]
+	if !foo.IsMultiImage || foo.GetDefaultImage(imagesettype.RedhatCertified) != "quay.io/acme/foo-controller-certified" {
+		t.Fatalf("unexpected component %+v", foo)
+	}
+
+	entandoApp := NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	*appBuilder.GetImageOverride(entandoApp) = "7.1.2"
+	if entandoApp.Spec.AppBuilder.ImageOverride != "7.1.2" {
+		t.Fatalf("the AppBuilder override should be set in the EntandoAppV2 field")
+	}
+
+	*foo.GetImageOverride(entandoApp) = "7.1.3"
+	extraOverrides := GetExtraOverrides(entandoApp)
+	if len(extraOverrides) != 1 || extraOverrides[0].Value != "7.1.3" || len(extraOverrides[0].Keys) != 3 {
+		t.Fatalf("unexpected extra overrides %+v", extraOverrides)
+	}
+	if copiedApp := *entandoApp; *foo.GetImageOverride(&copiedApp) != "7.1.3" {
+		t.Fatalf("extra override lost copying the resource")
+	}
+	if otherApp := NewEntandoApp(&v1alpha1.EntandoAppV2{}); *foo.GetImageOverride(otherApp) != "" {
+		t.Fatalf("extra override shared with another resource")
+	}
+
+	loadedApp := NewEntandoApp(&v1alpha1.EntandoAppV2{})
+	LoadExtraOverrides(loadedApp, map[string]interface{}{
+		"spec": map[string]interface{}{"k8sFooController": map[string]interface{}{"imageOverride": "7.1.4"}},
+	})
+	if *foo.GetImageOverride(loadedApp) != "7.1.4" {
+		t.Fatalf("extra override not loaded")
+	}
+}
+
+func TestRegisterComponentErrors(t *testing.T) {
+
+	builtinImages := append([]EntandoImageInfo{}, EntandoImages...)
+	defer func() { EntandoImages = builtinImages }()
+
+	invalidDescriptors := []ComponentDescriptor{
+		{Name: "Foo", Flag: "image-de-app", SpecPath: "{.spec.foo.imageOverride}", DefaultRepos: map[string]string{"Community": "foo"}},
+		{Name: "Foo", Flag: "image-foo", SpecPath: "{.metadata.name}", DefaultRepos: map[string]string{"Community": "foo"}},
+		{Name: "Foo", Flag: "image-foo", SpecPath: "{.spec.foo.imageOverride}", DefaultRepos: map[string]string{"Community": "foo", "Unknown": "foo"}},
+		{Name: "Foo", Flag: "Image Foo", SpecPath: "{.spec.foo.imageOverride}", DefaultRepos: map[string]string{"Community": "foo"}},
+	}
+
+	for _, descriptor := range invalidDescriptors {
+		if err := RegisterComponent(descriptor); err == nil {
+			t.Fatalf("descriptor %+v should be invalid", descriptor)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package images
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/entgigi/upgrade-operator.git/api/v1alpha1"
+)
+
+var specKeyRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// EntandoApp is an EntandoAppV2 resource together with the image overrides of the registered components whose specPath
+// is not a field of the EntandoAppV2 API. These overrides are stored separately and merged in the generated CR.
+type EntandoApp struct {
+	*v1alpha1.EntandoAppV2
+	// image overrides keyed by the dot separated path of their field
+	ExtraOverrides map[string]*string
+}
+
+// NewEntandoApp wraps the resource, which has no extra overrides
+func NewEntandoApp(entandoAppV2 *v1alpha1.EntandoAppV2) *EntandoApp {
+	return &EntandoApp{EntandoAppV2: entandoAppV2, ExtraOverrides: map[string]*string{}}
+}
+
+// ExtraOverride is an image override whose field is not part of the EntandoAppV2 API
+type ExtraOverride struct {
+	// keys of the field, starting with spec
+	Keys  []string
+	Value string
+}
+
+// parseSpecPath converts a JSONPath like {.spec.deApp.imageOverride} in the list of the field keys
+func parseSpecPath(specPath string) ([]string, error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(specPath, "{"), "}")
+	path = strings.TrimPrefix(path, ".")
+
+	keys := strings.Split(path, ".")
+	if len(keys) < 2 || keys[0] != "spec" {
+		return nil, fmt.Errorf("the path %s must refer to a field of the EntandoAppV2 spec", specPath)
+	}
+	for _, key := range keys {
+		if !specKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("the path %s contains the invalid key '%s'", specPath, key)
+		}
+	}
+	return keys, nil
+}
+
+// getSpecField returns the reference to the string field identified by the keys. The struct fields are matched using
+// their JSON names; if the keys don't match a field of the EntandoAppV2 API, an extra override is returned.
+func getSpecField(entandoApp *EntandoApp, keys []string) *string {
+	value := reflect.ValueOf(entandoApp.EntandoAppV2).Elem()
+	for _, key := range keys {
+		value = getFieldByJsonName(value, key)
+		if !value.IsValid() {
+			return getExtraOverride(entandoApp, keys)
+		}
+	}
+	if value.Kind() != reflect.String {
+		return getExtraOverride(entandoApp, keys)
+	}
+	return value.Addr().Interface().(*string)
+}
+
+func getFieldByJsonName(value reflect.Value, name string) reflect.Value {
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		jsonName := strings.Split(valueType.Field(i).Tag.Get("json"), ",")[0]
+		if jsonName == name {
+			return value.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func getExtraOverride(entandoApp *EntandoApp, keys []string) *string {
+	if entandoApp.ExtraOverrides == nil {
+		entandoApp.ExtraOverrides = map[string]*string{}
+	}
+	path := strings.Join(keys, ".")
+	if _, ok := entandoApp.ExtraOverrides[path]; !ok {
+		entandoApp.ExtraOverrides[path] = new(string)
+	}
+	return entandoApp.ExtraOverrides[path]
+}
+
+// GetExtraOverrides returns the non empty image overrides of the resource whose fields are not part of the EntandoAppV2 API
+func GetExtraOverrides(entandoApp *EntandoApp) []ExtraOverride {
+	result := []ExtraOverride{}
+	for _, imageInfo := range EntandoImages {
+		if isApiField(imageInfo.specKeys) {
+			continue
+		}
+		if value := *getExtraOverride(entandoApp, imageInfo.specKeys); value != "" {
+			result = append(result, ExtraOverride{Keys: imageInfo.specKeys, Value: value})
+		}
+	}
+	return result
+}
+
+// LoadExtraOverrides reads the image overrides whose fields are not part of the EntandoAppV2 API from the
+// generic representation of the resource
+func LoadExtraOverrides(entandoApp *EntandoApp, content map[string]interface{}) {
+	for _, imageInfo := range EntandoImages {
+		if isApiField(imageInfo.specKeys) {
+			continue
+		}
+		var value interface{} = content
+		for _, key := range imageInfo.specKeys {
+			valuesMap, _ := value.(map[string]interface{})
+			value = valuesMap[key]
+		}
+		if stringValue, ok := value.(string); ok {
+			*getExtraOverride(entandoApp, imageInfo.specKeys) = stringValue
+		}
+	}
+}
+
+func isApiField(keys []string) bool {
+	value := reflect.ValueOf(v1alpha1.EntandoAppV2{})
+	for _, key := range keys {
+		value = getFieldByJsonName(value, key)
+		if !value.IsValid() {
+			return false
+		}
+	}
+	return value.Kind() == reflect.String
+}
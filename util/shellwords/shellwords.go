@@ -0,0 +1,100 @@
+package shellwords
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Split splits the string in words following the POSIX shell rules for quoting and escaping:
+// words are separated by unquoted blanks, single quotes preserve the literal value of the characters,
+// double quotes preserve it except for the backslash escaping ", \, $ and `, and outside quotes
+// a backslash preserves the literal value of the following character.
+// Variables, globs and other shell expansions are not supported.
+func Split(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			i++
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated escape at the end of '%s'", s)
+			}
+			// an escaped newline is a line continuation
+			if runes[i] != '\n' {
+				word.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inWord = true
+			end := indexRune(runes, i+1, '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote in '%s'", s)
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inWord = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated double quote in '%s'", s)
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Join quotes the words that need it and joins them with spaces, so that Split returns the original words
+func Join(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, Quote(word))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quote returns the word enclosed in single quotes if it contains characters having a special meaning for the shell
+func Quote(word string) string {
+	if word == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(word, " \t\n'\"\\$`|&;<>()*?[]#~{}!") {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,41 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"kubectl -n entando", []string{"kubectl", "-n", "entando"}},
+		{"  sudo   k3s\tkubectl  ", []string{"sudo", "k3s", "kubectl"}},
+		{`kubectl --kubeconfig "/path with space/config"`, []string{"kubectl", "--kubeconfig", "/path with space/config"}},
+		{`kubectl --kubeconfig '/it'\''s/config'`, []string{"kubectl", "--kubeconfig", "/it's/config"}},
+		{`kubectl --context my\ context`, []string{"kubectl", "--context", "my context"}},
+		{`kubectl "-n" "" "a \"b\" \c"`, []string{"kubectl", "-n", "", `a "b" \c`}},
+		{`kubectl --context=a"b c"d`, []string{"kubectl", "--context=ab cd"}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		words, err := Split(test.input)
+		if err != nil {
+			t.Fatalf("unable to split %s: %s", test.input, err.Error())
+		}
+		if !reflect.DeepEqual(words, test.expected) {
+			t.Fatalf("unexpected words for %s: %q", test.input, words)
+		}
+		if joined, _ := Split(Join(words)); !reflect.DeepEqual(joined, test.expected) {
+			t.Fatalf("%s was not joined correctly: %s", test.input, Join(words))
+		}
+	}
+
+	for _, input := range []string{`kubectl "-n entando`, `kubectl '-n`, `kubectl \`} {
+		if _, err := Split(input); err == nil {
+			t.Fatalf("an error was expected for %s", input)
+		}
+	}
+}
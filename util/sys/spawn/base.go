@@ -2,6 +2,7 @@ package spawn
 
 import (
 	"fmt"
+	"strings"
 )
 
 const SwitchPrefixShort = "-"
@@ -65,9 +66,18 @@ func ComposeArgs(argsArr ...[]interface{}) []interface{} {
 	return toThis
 }
 
-func addEnv(toThisEnv []string, thisEnv Environ) []string {
+// mergeEnv returns the base environment with the variables of the given Environ,
+// replacing the base variables having the same name
+func mergeEnv(baseEnv []string, thisEnv Environ) []string {
+	merged := make([]string, 0, len(baseEnv)+len(thisEnv))
+	for _, variable := range baseEnv {
+		name, _, _ := strings.Cut(variable, "=")
+		if _, overridden := thisEnv[name]; !overridden {
+			merged = append(merged, variable)
+		}
+	}
 	for k, v := range thisEnv {
-		return append(toThisEnv, fmt.Sprintf("%s=%s", k, v))
+		merged = append(merged, fmt.Sprintf("%s=%s", k, v))
 	}
-	return toThisEnv
+	return merged
 }
@@ -0,0 +1,63 @@
+package spawn
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeRunner is a Runner for tests: it records the commands and returns the results of the Handler without
+// executing any process. The output returned by the Handler is also sent to the line callbacks.
+type FakeRunner struct {
+	Handler  func(cmd Command) (Res, error)
+	Commands []Command
+	mutex    sync.Mutex
+}
+
+func (r *FakeRunner) Run(ctx context.Context, cmd Command) (Res, error) {
+	r.mutex.Lock()
+	r.Commands = append(r.Commands, cmd)
+	r.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return Res{}, err
+	}
+
+	res := Res{}
+	var err error
+	if r.Handler != nil {
+		res, err = r.Handler(cmd)
+	}
+
+	streamLines(res.Stdout, cmd.Options.OnStdoutLine)
+	streamLines(res.Stderr, cmd.Options.OnStderrLine)
+	if !cmd.Options.CaptureStdout {
+		res.Stdout = ""
+	}
+	if !cmd.Options.CaptureStderr {
+		res.Stderr = ""
+	}
+	return res, err
+}
+
+// LookPath returns the name, since the FakeRunner doesn't execute any program
+func (r *FakeRunner) LookPath(name string) (string, error) {
+	return name, nil
+}
+
+func streamLines(output string, callback func(line string)) {
+	if callback == nil || output == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		callback(line)
+	}
+}
+
+// UseFakeRunner replaces the DefaultRunner with a FakeRunner using the handler and returns a function restoring it
+func UseFakeRunner(handler func(cmd Command) (Res, error)) (*FakeRunner, func()) {
+	original := DefaultRunner
+	fake := &FakeRunner{Handler: handler}
+	DefaultRunner = fake
+	return fake, func() { DefaultRunner = original }
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package spawn
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs the command in a new process group, so that its children can be killed with it
+func setProcessGroup(gocmd *exec.Cmd) {
+	gocmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcess kills the process group of the command, if it has its own, or only the command process
+func killProcess(gocmd *exec.Cmd) {
+	if gocmd.SysProcAttr != nil && gocmd.SysProcAttr.Setpgid {
+		syscall.Kill(-gocmd.Process.Pid, syscall.SIGKILL)
+	}
+	gocmd.Process.Kill()
+}
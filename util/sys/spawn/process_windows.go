@@ -0,0 +1,16 @@
+//go:build windows
+
+package spawn
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op, since process groups are not supported
+func setProcessGroup(gocmd *exec.Cmd) {
+}
+
+// killProcess kills the command process
+func killProcess(gocmd *exec.Cmd) {
+	gocmd.Process.Kill()
+}
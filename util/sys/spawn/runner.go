@@ -0,0 +1,182 @@
+package spawn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Command is a command to be executed by a Runner
+type Command struct {
+	Name    string
+	Args    []interface{}
+	Env     Environ
+	Options Options
+}
+
+// RawArgs returns the arguments of the command flattened to strings
+func (c Command) RawArgs() []string {
+	return MkRawSpawnArgs(c.Args)
+}
+
+// String returns the command line
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.RawArgs()...), " ")
+}
+
+// Runner executes commands
+type Runner interface {
+	Run(ctx context.Context, cmd Command) (Res, error)
+	// LookPath returns the path of the executable, searching it in the PATH if it isn't a path
+	LookPath(name string) (string, error)
+}
+
+// DefaultRunner is the runner used by Spawn
+var DefaultRunner Runner = ExecRunner{}
+
+// ErrTimeout is returned, wrapped, when a command is killed because its timeout expired
+var ErrTimeout = errors.New("timeout expired")
+
+// ExecRunner executes the commands as local processes
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, cmd Command) (Res, error) {
+	opts := cmd.Options
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// PREPARE THE COMMAND AND ITS ARGS
+	var gocmd *exec.Cmd
+	if opts.WithSudo {
+		gocmd = exec.Command("sudo", MkRawSpawnArgs(PrependToArgs(cmd.Args, cmd.Name))...)
+	} else {
+		gocmd = exec.Command(cmd.Name, cmd.RawArgs()...)
+	}
+
+	// children started by the command (e.g. by the shell of a hook) keep the output pipes open, so the whole
+	// process group is killed when the context is done. Commands that may read from the terminal (interactive
+	// ones and sudo, asking for the password) stay in the foreground process group, and only the command process is killed.
+	if !opts.Interactive && !opts.WithSudo {
+		setProcessGroup(gocmd)
+	}
+
+	// SET THE SPAWN ENVIRONMENT
+	if len(cmd.Env) > 0 {
+		gocmd.Env = mergeEnv(os.Environ(), cmd.Env)
+	}
+
+	if opts.Interactive {
+		gocmd.Stdin = os.Stdin
+	} else if opts.Stdin != nil {
+		gocmd.Stdin = opts.Stdin
+	}
+
+	// stdout and stderr are copied concurrently by exec.Cmd when they are not files,
+	// so a command filling one of the pipes can't block
+	var capturedStdout, capturedStderr bytes.Buffer
+	stdoutLines := newLineWriter(opts.OnStdoutLine)
+	stderrLines := newLineWriter(opts.OnStderrLine)
+	gocmd.Stdout = getOutputWriter(opts.CaptureStdout, &capturedStdout, stdoutLines, os.Stdout)
+	gocmd.Stderr = getOutputWriter(opts.CaptureStderr, &capturedStderr, stderrLines, os.Stderr)
+
+	// START THE PROCESS AND WAIT FOR IT TO COMPLETE
+	if err := ctx.Err(); err != nil {
+		return Res{}, err
+	}
+	if err := gocmd.Start(); err != nil {
+		return Res{}, err
+	}
+	waitDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcess(gocmd)
+		case <-waitDone:
+		}
+	}()
+	err := gocmd.Wait()
+	close(waitDone)
+
+	stdoutLines.Flush()
+	stderrLines.Flush()
+	res := Res{capturedStdout.String(), capturedStderr.String()}
+
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return res, fmt.Errorf("%s: %w after %s", cmd.Name, ErrTimeout, opts.Timeout)
+		}
+		return res, ctx.Err()
+	}
+	return res, err
+}
+
+func (ExecRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func getOutputWriter(capture bool, captured *bytes.Buffer, lines *lineWriter, terminal io.Writer) io.Writer {
+	writers := []io.Writer{}
+	if capture {
+		writers = append(writers, captured)
+	}
+	if lines != nil {
+		writers = append(writers, lines)
+	}
+	if len(writers) == 0 {
+		return terminal
+	}
+	return io.MultiWriter(writers...)
+}
+
+// lineWriter calls the callback for each line written, without the line terminator
+type lineWriter struct {
+	callback func(line string)
+	buffer   []byte
+	mutex    sync.Mutex
+}
+
+func newLineWriter(callback func(line string)) *lineWriter {
+	if callback == nil {
+		return nil
+	}
+	return &lineWriter{callback: callback}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, p...)
+	for {
+		index := bytes.IndexByte(w.buffer, '\n')
+		if index == -1 {
+			break
+		}
+		w.callback(strings.TrimSuffix(string(w.buffer[:index]), "\r"))
+		w.buffer = w.buffer[index+1:]
+	}
+	return len(p), nil
+}
+
+// Flush sends the last line if it isn't terminated
+func (w *lineWriter) Flush() {
+	if w == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.buffer) > 0 {
+		w.callback(string(w.buffer))
+		w.buffer = nil
+	}
+}
@@ -1,19 +1,20 @@
 package spawn
 
 import (
+	"context"
 	"io"
-	"io/ioutil"
-	"os"
-	"os/exec"
+	"time"
 )
 
-// Spawns a process and optionally captures standard output and standard error
-//   - gocmd             receiver of the "&exec.Cmd" created and used for the execution or nil if your don't care
+// Spawns a process and optionally captures or streams standard output and standard error
+//   - ctx               the process is killed when the context is done
 //   - baseCmd           the program to execute
 //   - args              the arguments in the spawn package special format [*1]
-//   - env               a string->string map that specifies the spawn execution environment
+//   - env               a string->string map that is merged with the current environment
 //   - opts              activation of optional functions (see Options)
 //
+// The command is executed by the DefaultRunner, that can be replaced with a FakeRunner in tests.
+//
 // Notes:
 //   - [*1] Allows:
 //   - simple strings
@@ -21,74 +22,24 @@ import (
 //   - known objects like the SubOptionArg (check the spawn.SOA function).
 //
 // noinspection GoNameStartsWithPackageName
-func Spawn(gocmd **exec.Cmd, baseCmd string, args []interface{}, env Environ, opts Options) (Res, error) {
-	if gocmd == nil {
-		tmpCmd := &exec.Cmd{}
-		gocmd = &tmpCmd
-	}
-
-	// PREPARE THE COMMAND AND ITS ARGS
-	if opts.WithSudo {
-		args = PrependToArgs(args, baseCmd)
-		*gocmd = exec.Command("sudo", MkRawSpawnArgs(args)...)
-	} else {
-		args := MkRawSpawnArgs(args)
-		*gocmd = exec.Command(baseCmd, args...)
-	}
-
-	// SET THE SPAWN ENVIRONMENT
-	if len(env) > 0 {
-		(*gocmd).Env = os.Environ()
-		(*gocmd).Env = addEnv((*gocmd).Env, env)
-	}
-
-	if opts.Interactive {
-		(*gocmd).Stdin = os.Stdin
-	}
-
-	var stdoutPipe, stderrPipe io.ReadCloser
-	var stdoutErr, stderrErr error
-	if opts.CaptureStdout {
-		stdoutPipe, stdoutErr = (*gocmd).StdoutPipe()
-	} else {
-		(*gocmd).Stdout = os.Stdout
-		stdoutPipe = nil
-	}
-	if opts.CaptureStderr {
-		stderrPipe, stderrErr = (*gocmd).StderrPipe()
-	} else {
-		(*gocmd).Stderr = os.Stdout
-		stderrPipe = nil
-	}
-
-	// START THE PROCESS
-	err := (*gocmd).Start()
-	if err != nil {
-		return Res{}, err
-	}
-
-	// COLLECT THE OUTPUT
-	var capturedStdout []byte
-	var capturedStderr []byte
-	if stdoutErr == nil && opts.CaptureStdout {
-		capturedStdout, _ = ioutil.ReadAll(stdoutPipe)
-	}
-	if stderrErr == nil && opts.CaptureStderr {
-		capturedStderr, _ = ioutil.ReadAll(stderrPipe)
-	}
-
-	// WAIT FOR PROCESS TO COMPLETE
-	err = (*gocmd).Wait()
-
-	return Res{string(capturedStdout), string(capturedStderr)}, err
+func Spawn(ctx context.Context, baseCmd string, args []interface{}, env Environ, opts Options) (Res, error) {
+	return DefaultRunner.Run(ctx, Command{Name: baseCmd, Args: args, Env: env, Options: opts})
 }
 
 // Optional functionalities activation flags
 type Options struct {
-	WithSudo      bool // the command is run using sudo (in the platforms that supports it)
-	Interactive   bool // the command stdin is attached to the tty
-	CaptureStdout bool // the command standard output is intercepted (see Res)
-	CaptureStderr bool // the command standard error is intercepted (see Res)
+	WithSudo      bool      // the command is run using sudo (in the platforms that supports it)
+	Interactive   bool      // the command stdin is attached to the tty
+	CaptureStdout bool      // the command standard output is intercepted (see Res)
+	CaptureStderr bool      // the command standard error is intercepted (see Res)
+	Stdin         io.Reader // data provided to the command standard input (ignored when Interactive is set)
+
+	Timeout time.Duration // the command is killed if it doesn't terminate within this duration (0 means no timeout)
+
+	// callbacks receiving each line of the standard output and of the standard error while the command is running.
+	// Streamed output is not forwarded to the terminal, but it is still captured if requested.
+	OnStdoutLine func(line string)
+	OnStderrLine func(line string)
 }
 
 // Composes a simple sub-option assignment argument:
@@ -0,0 +1,103 @@
+package spawn
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpawnCapturesLargeOutputs(t *testing.T) {
+	// writing more than the pipe buffer on stderr before stdout blocks if the outputs are read sequentially
+	script := "head -c 200000 /dev/zero >&2; echo out"
+
+	res, err := Spawn(context.Background(), "sh", []interface{}{"-c", script}, Environ{},
+		Options{CaptureStdout: true, CaptureStderr: true, Timeout: 10 * time.Second})
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res.Stdout != "out\n" || len(res.Stderr) != 200000 {
+		t.Fatalf("unexpected output: %d bytes on stdout, %d bytes on stderr", len(res.Stdout), len(res.Stderr))
+	}
+}
+
+func TestSpawnTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := Spawn(context.Background(), "sleep", []interface{}{"10"}, Environ{}, Options{Timeout: 100 * time.Millisecond})
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("the command was not killed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Spawn(ctx, "sleep", []interface{}{"10"}, Environ{}, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSpawnTimeoutKillsChildren(t *testing.T) {
+	// the background sleep keeps the output pipe open after the shell is killed
+	start := time.Now()
+	_, err := Spawn(context.Background(), "sh", []interface{}{"-c", "sleep 10 & wait"}, Environ{},
+		Options{CaptureStdout: true, CaptureStderr: true, Timeout: 100 * time.Millisecond})
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("the children of the command were not killed")
+	}
+}
+
+func TestSpawnEnvAndStreaming(t *testing.T) {
+	t.Setenv("SPAWN_TEST_A", "original")
+
+	lines := []string{}
+	res, err := Spawn(context.Background(), "sh", []interface{}{"-c", "echo $SPAWN_TEST_A; echo $SPAWN_TEST_B; printf last"},
+		Environ{"SPAWN_TEST_A": "a", "SPAWN_TEST_B": "b"},
+		Options{CaptureStdout: true, OnStdoutLine: func(line string) { lines = append(lines, line) }})
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if strings.Join(lines, ",") != "a,b,last" || res.Stdout != "a\nb\nlast" {
+		t.Fatalf("unexpected output %v %q", lines, res.Stdout)
+	}
+
+	env := mergeEnv([]string{"A=1", "B=2", "C=3"}, Environ{"B": "x", "D": "y"})
+	if len(env) != 4 || strings.Contains(strings.Join(env, ","), "B=2") {
+		t.Fatalf("unexpected environment %v", env)
+	}
+}
+
+func TestFakeRunner(t *testing.T) {
+	fake, restore := UseFakeRunner(func(cmd Command) (Res, error) {
+		if cmd.RawArgs()[0] == "fail" {
+			return Res{Stderr: "failure\n"}, errors.New("exit status 1")
+		}
+		return Res{Stdout: "line1\nline2\n"}, nil
+	})
+	defer restore()
+
+	lines := []string{}
+	res, err := Spawn(context.Background(), "kubectl", []interface{}{"get", []interface{}{"pods", SOA("l", "app", "x")}}, Environ{},
+		Options{CaptureStdout: true, OnStdoutLine: func(line string) { lines = append(lines, line) }})
+	if err != nil || res.Stdout != "line1\nline2\n" || len(lines) != 2 {
+		t.Fatalf("unexpected result %+v %v %v", res, lines, err)
+	}
+
+	res, err = Spawn(context.Background(), "kubectl", []interface{}{"fail"}, Environ{}, Options{CaptureStderr: true})
+	if err == nil || res.Stderr != "failure\n" {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+
+	if len(fake.Commands) != 2 || fake.Commands[0].String() != "kubectl get pods -l app=x" {
+		t.Fatalf("unexpected commands %v", fake.Commands)
+	}
+}
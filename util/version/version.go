@@ -0,0 +1,62 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed version in the format [v]major[.minor[.patch]][-suffix]
+type Version struct {
+	Major  int
+	Minor  int
+	Patch  int
+	Suffix string
+}
+
+var versionRegexp = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:[-+](.+))?$`)
+
+// Parse converts a version string (e.g. 7.1.0, v7.1.0-fix1) in a Version
+func Parse(value string) (Version, error) {
+	matches := versionRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return Version{}, fmt.Errorf("invalid version '%s'", value)
+	}
+	parsed := Version{Suffix: matches[4]}
+	parsed.Major, _ = strconv.Atoi(matches[1])
+	if matches[2] != "" {
+		parsed.Minor, _ = strconv.Atoi(matches[2])
+	}
+	if matches[3] != "" {
+		parsed.Patch, _ = strconv.Atoi(matches[3])
+	}
+	return parsed, nil
+}
+
+// Compare returns -1, 0 or 1 if v is respectively lower, equal or greater than other.
+// Suffixes are not considered, since they are used for fixes and custom builds of the same version.
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// MajorMinor returns the version in the format major.minor
+func (v Version) MajorMinor() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v Version) String() string {
+	value := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Suffix != "" {
+		value += "-" + v.Suffix
+	}
+	return value
+}
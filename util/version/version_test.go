@@ -0,0 +1,39 @@
+package version
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	checkParse(t, "7.1.0", Version{Major: 7, Minor: 1, Patch: 0})
+	checkParse(t, "v7.2.1-fix1", Version{Major: 7, Minor: 2, Patch: 1, Suffix: "fix1"})
+	checkParse(t, "7.1", Version{Major: 7, Minor: 1})
+
+	if _, err := Parse("latest"); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+func checkParse(t *testing.T, value string, expected Version) {
+	parsed, err := Parse(value)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if parsed != expected {
+		t.Fatalf("expected %+v, found %+v", expected, parsed)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	checkCompare(t, "7.1.0", "7.1.0", 0)
+	checkCompare(t, "7.1.0-fix1", "7.1.0", 0)
+	checkCompare(t, "7.1.1", "7.1.0", 1)
+	checkCompare(t, "7.0.2", "7.1.0", -1)
+	checkCompare(t, "v7.10.0", "7.9.0", 1)
+}
+
+func checkCompare(t *testing.T, a, b string, expected int) {
+	va, _ := Parse(a)
+	vb, _ := Parse(b)
+	if result := va.Compare(vb); result != expected {
+		t.Fatalf("comparing %s and %s: expected %d, found %d", a, b, expected, result)
+	}
+}